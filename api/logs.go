@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// sender sends events to a client of a stream, over Server-Sent Events or a WebSocket.
+type sender interface {
+	send(event string, v interface{}) error
+}
+
+// errSlowSubscriber ends a log stream whose client fell behind too far.
+var errSlowSubscriber = errors.New("client fell behind the log")
+
+// streamLogs returns the lines of the log of a run selected by the since (RFC 3339) and
+// tail query parameters, or streams them and then every new line as Server-Sent Events
+// or WebSocket messages named log until the run finishes.
+func (s *server) streamLogs(w http.ResponseWriter, r *http.Request, id string) {
+	run, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	var q runlog.Query
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("since: %w", err))
+			return
+		}
+		q.Since = since
+	}
+	if v := r.URL.Query().Get("tail"); v != "" {
+		tail, err := strconv.Atoi(v)
+		if err != nil || tail < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("tail: invalid line count %q", v))
+			return
+		}
+		q.Tail = tail
+	}
+	dir := filepath.Join(s.workspace, run.Container)
+	websocket := isWebSocket(r)
+	if !websocket && !acceptsEventStream(r) {
+		lines, err := runlog.Read(dir, q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if lines == nil {
+			lines = []runlog.Line{}
+		}
+		writeJSON(w, http.StatusOK, lines)
+		return
+	}
+
+	lines, sub, err := s.broker.Subscribe(dir, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer sub.Cancel()
+	ctx := logging.WithFields(r.Context(), logging.RunID, run.ID, logging.Factor, run.Factor)
+	logger := s.log.Ctx(ctx)
+
+	var out sender
+	if websocket {
+		ws, ok := upgradeWebSocket(w, r)
+		if !ok {
+			return
+		}
+		// the request context is not cancelled once the connection is hijacked
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go ws.readLoop(cancel)
+		out = ws
+	} else {
+		stream, ok := newEventStream(w)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+			return
+		}
+		out = stream
+	}
+
+	err = s.followLog(ctx, run, lines, sub, out)
+	switch {
+	case errors.Is(err, errSlowSubscriber):
+		logger.Warn("dropped log stream of a slow client")
+	case err != nil && ctx.Err() == nil:
+		logger.Error("failed to stream run log", "error", err)
+	}
+	if ws, ok := out.(*webSocket); ok {
+		code := uint16(closeNormal)
+		if errors.Is(err, errSlowSubscriber) {
+			code = closeTryAgain
+		}
+		ws.close(code)
+	}
+}
+
+// followLog sends lines, then the lines of sub until the run finishes and then an end
+// event holding the run.
+func (s *server) followLog(ctx context.Context, run runs.Run, lines []runlog.Line, sub *runlog.Subscription, out sender) error {
+	for _, line := range lines {
+		if err := out.send("log", line); err != nil {
+			return err
+		}
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-sub.Lines:
+			if !ok {
+				return errSlowSubscriber
+			}
+			if err := out.send("log", line); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			latest, err := s.runs.Get(run.ID)
+			if err != nil {
+				return err
+			}
+			if !latest.Finished() {
+				continue
+			}
+			// the run wrote its last line before it finished
+			if err := sub.Sync(); err != nil {
+				return err
+			}
+			if err := drain(sub, out); err != nil {
+				return err
+			}
+			return out.send("end", latest)
+		}
+	}
+}
+
+// drain sends the lines sub received so far.
+func drain(sub *runlog.Subscription, out sender) error {
+	for {
+		select {
+		case line, ok := <-sub.Lines:
+			if !ok {
+				return errSlowSubscriber
+			}
+			if err := out.send("log", line); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
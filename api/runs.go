@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/export"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// listRuns filters on the factor, status, since and until query parameters, the times
+// being RFC 3339.
+func (s *server) listRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := runs.Filter{Factor: q.Get("factor"), Status: runs.Status(q.Get("status"))}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*t = parsed
+		}
+	}
+	list, err := s.runs.Query(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if list == nil {
+		list = []runs.Run{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) getRun(w http.ResponseWriter, _ *http.Request, id string) {
+	run, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+type exportRequest struct {
+	Format          export.Format `json:"format"`
+	PartitionByDate bool          `json:"partition_by_date"`
+	Timezone        string        `json:"timezone"`
+}
+
+type exportResponse struct {
+	Files []string `json:"files"`
+}
+
+// exportRun exports into a directory of the run under exportDir rather than a directory
+// named by the client, so the API cannot write anywhere else.
+func (s *server) exportRun(w http.ResponseWriter, r *http.Request, id string) {
+	run, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	if run.Status != runs.StatusSucceeded {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s, only succeeded runs can be exported", run.ID, run.Status))
+		return
+	}
+	var body exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req := export.ForRun(run)
+	req.Format = body.Format
+	req.PartitionByDate = body.PartitionByDate
+	req.Timezone = body.Timezone
+	req.Dir = filepath.Join(s.exportDir, run.ID)
+	ctx := logging.WithFields(r.Context(), logging.RunID, run.ID, logging.Factor, run.Factor)
+	files, err := s.exporter.Export(ctx, req)
+	if err != nil {
+		s.log.Ctx(ctx).Error("failed to export run", "error", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, exportResponse{Files: files})
+}
+
+// lookup writes the error response itself when the run cannot be returned.
+func (s *server) lookup(w http.ResponseWriter, id string) (runs.Run, bool) {
+	run, err := s.runs.Get(id)
+	if errors.Is(err, runs.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return runs.Run{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return runs.Run{}, false
+	}
+	return run, true
+}
+
+// streamStats returns the resource samples of a run recorded so far, or streams them as
+// Server-Sent Events named sample until the run finishes.
+func (s *server) streamStats(w http.ResponseWriter, r *http.Request, id string) {
+	run, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	dir := filepath.Join(s.workspace, run.Container)
+	if !acceptsEventStream(r) {
+		samples, _, err := containerize.ReadResourceSamples(dir, 0)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if samples == nil {
+			samples = []containerize.ResourceSample{}
+		}
+		writeJSON(w, http.StatusOK, samples)
+		return
+	}
+
+	var offset int64
+	s.follow(w, r, run, func(stream *eventStream) error {
+		var samples []containerize.ResourceSample
+		var err error
+		if samples, offset, err = containerize.ReadResourceSamples(dir, offset); err != nil {
+			return err
+		}
+		for _, sample := range samples {
+			if err := stream.send("sample", sample); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// streamProgress returns the progress a run reported last, or streams every change of it
+// as Server-Sent Events named progress until the run finishes.
+func (s *server) streamProgress(w http.ResponseWriter, r *http.Request, id string) {
+	run, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	dir := filepath.Join(s.workspace, run.Container)
+	if !acceptsEventStream(r) {
+		progress, ok, err := factor.ReadProgress(dir)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("run %s reported no progress", run.ID))
+			return
+		}
+		writeJSON(w, http.StatusOK, progress)
+		return
+	}
+
+	var last time.Time
+	s.follow(w, r, run, func(stream *eventStream) error {
+		progress, ok, err := factor.ReadProgress(dir)
+		if err != nil || !ok || !progress.UpdatedAt.After(last) {
+			return err
+		}
+		last = progress.UpdatedAt
+		return stream.send("progress", progress)
+	})
+}
@@ -0,0 +1,87 @@
+// Package api serves runs and their outputs over HTTP.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/export"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+type server struct {
+	runs     runs.Interface
+	exporter export.Interface
+	// workspace holds the directory of every run, named after its container.
+	workspace string
+	// exportDir holds one directory of exported files per run.
+	exportDir string
+	// broker follows the logs of runs for all their streams.
+	broker *runlog.Broker
+	log    *logging.Logger
+}
+
+// ServeHTTP routes
+//
+//	GET  /runs               the runs, most recent first, filtered by ?factor=&status=&since=&until=
+//	GET  /runs/{id}          a run
+//	GET  /runs/{id}/stats    resource samples of a run, streamed as Server-Sent Events on request
+//	GET  /runs/{id}/progress the progress a run reported, streamed as Server-Sent Events on request
+//	GET  /runs/{id}/logs     the log of a run by ?since=&tail=, streamed as Server-Sent Events or over a WebSocket on request
+//	POST /runs/{id}/export   exports the output of a succeeded run
+//	GET  /metrics            metrics in the Prometheus text format, with those pushed by other commands
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "metrics":
+		s.get(w, r, metrics.Handler(filepath.Join(s.workspace, metrics.Filename)).ServeHTTP)
+	case len(parts) == 1 && parts[0] == "runs":
+		s.get(w, r, s.listRuns)
+	case len(parts) == 2 && parts[0] == "runs":
+		s.get(w, r, func(w http.ResponseWriter, r *http.Request) { s.getRun(w, r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "stats":
+		s.get(w, r, func(w http.ResponseWriter, r *http.Request) { s.streamStats(w, r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "progress":
+		s.get(w, r, func(w http.ResponseWriter, r *http.Request) { s.streamProgress(w, r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "logs":
+		s.get(w, r, func(w http.ResponseWriter, r *http.Request) { s.streamLogs(w, r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "export":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		s.exportRun(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *server) get(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	h(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Default().Error("failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func New(runs runs.Interface, exporter export.Interface, workspace string, exportDir string, logger *logging.Logger) http.Handler {
+	return &server{runs: runs, exporter: exporter, workspace: workspace, exportDir: exportDir, broker: runlog.NewBroker(pollInterval), log: logger}
+}
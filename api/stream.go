@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// pollInterval is how often streams check for what a run wrote to its workspace since.
+const pollInterval = time.Second
+
+// eventStream writes Server-Sent Events, flushing every event.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// acceptsEventStream reports whether the client asked for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// newEventStream starts the response; it fails when w cannot flush.
+func newEventStream(w http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{w: w, flusher: flusher}, true
+}
+
+// send writes v as the JSON data of an event named event.
+func (s *eventStream) send(event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// follow streams what poll sends about run every pollInterval until the run finishes and
+// then sends an end event holding the run. poll runs once more after the run finished,
+// so nothing written before is missed.
+func (s *server) follow(w http.ResponseWriter, r *http.Request, run runs.Run, poll func(stream *eventStream) error) {
+	stream, ok := newEventStream(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	logger := s.log.Ctx(logging.WithFields(r.Context(), logging.RunID, run.ID, logging.Factor, run.Factor))
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		// the run is looked up before polling so that the last poll follows its end
+		latest, err := s.runs.Get(run.ID)
+		if err != nil {
+			logger.Error("failed to get run", "error", err)
+			return
+		}
+		if err := poll(stream); err != nil {
+			if r.Context().Err() == nil {
+				logger.Error("failed to stream run", "error", err)
+			}
+			return
+		}
+		if latest.Finished() {
+			_ = stream.send("end", latest)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the GUID RFC 6455 has the server append to the key of the handshake.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// maxClientFrame bounds the frames read from clients, which have nothing to send but
+// control frames.
+const maxClientFrame = 1 << 16
+
+// Status codes of close frames.
+const (
+	closeNormal   = 1000
+	closeProtocol = 1002
+	closeTooBig   = 1009
+	closeTryAgain = 1013
+)
+
+// webSocket is the server end of a WebSocket connection, sending events as JSON text
+// messages {"event": ..., "data": ...}.
+type webSocket struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// mu serializes frames written by the handler and by the read loop
+	mu sync.Mutex
+}
+
+type webSocketMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// isWebSocket reports whether the client asked to upgrade to a WebSocket.
+func isWebSocket(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether the request comes from a page of the server itself, or from
+// a client other than a browser, which sends no Origin. Browsers send the cookies of the
+// server with WebSocket requests of any page, so those of other sites are refused.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebSocket completes the opening handshake, writing the error response itself
+// when it cannot.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*webSocket, bool) {
+	if !sameOrigin(r) {
+		writeError(w, http.StatusForbidden, errors.New("cross-origin WebSocket request"))
+		return nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, errors.New("unsupported WebSocket version"))
+		return nil, false
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing Sec-WebSocket-Key"))
+		return nil, false
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("WebSockets are not supported"))
+		return nil, false
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, false
+	}
+	return &webSocket{conn: conn, rw: rw}, true
+}
+
+// send writes v as the data of a message of event.
+func (ws *webSocket) send(event string, v interface{}) error {
+	b, err := json.Marshal(webSocketMessage{Event: event, Data: v})
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(opText, b)
+}
+
+// writeFrame writes a single final frame; frames of servers are not masked.
+func (ws *webSocket) writeFrame(op byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	header := []byte{0x80 | op, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	n := 2
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+		n += 8
+	}
+	if _, err := ws.rw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// close sends a close frame with code and closes the connection without waiting for
+// the client to answer it.
+func (ws *webSocket) close(code uint16) {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	_ = ws.writeFrame(opClose, payload)
+	ws.conn.Close()
+}
+
+// readLoop reads the frames of the client, answering pings and dropping messages, until
+// the client closes the connection or it fails; then it calls done.
+func (ws *webSocket) readLoop(done func()) {
+	defer done()
+	for {
+		op, payload, err := ws.readFrame()
+		if err != nil {
+			switch {
+			case errors.Is(err, errFrameTooBig):
+				ws.close(closeTooBig)
+			case errors.Is(err, errFrameUnmasked):
+				ws.close(closeProtocol)
+			}
+			return
+		}
+		switch op {
+		case opClose:
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			_ = ws.writeFrame(opClose, payload)
+			return
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var (
+	errFrameTooBig = errors.New("WebSocket frame too big")
+	// errFrameUnmasked is a frame of a client not masked, as RFC 6455 requires them all to be
+	errFrameUnmasked = errors.New("WebSocket frame of the client not masked")
+)
+
+func (ws *webSocket) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+	op := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, errFrameUnmasked
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	}
+	if size > maxClientFrame {
+		return 0, nil, errFrameTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webSocketServer upgrades every request, sends a hello message and reads the frames of
+// the client until it is done.
+func webSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, ok := upgradeWebSocket(w, r)
+		if !ok {
+			return
+		}
+		if err := ws.send("hello", "world"); err != nil {
+			t.Errorf("send() error = %v", err)
+		}
+		done := make(chan struct{})
+		go ws.readLoop(func() { close(done) })
+		<-done
+		ws.conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialWebSocket sends the opening handshake to srv with header added and returns the
+// connection and the response.
+func dialWebSocket(t *testing.T, srv *httptest.Server, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func writeClientFrame(t *testing.T, w io.Writer, op byte, payload []byte, masked bool) {
+	t.Helper()
+	frame := []byte{0x80 | op, byte(len(payload))}
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("frame of the server is masked")
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			t.Fatal(err)
+		}
+		size = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			t.Fatal(err)
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := webSocketServer(t)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"no origin", nil, http.StatusSwitchingProtocols},
+		{"same origin", http.Header{"Origin": {"http://" + host}}, http.StatusSwitchingProtocols},
+		{"same origin other case", http.Header{"Origin": {"HTTP://" + strings.ToUpper(host)}}, http.StatusSwitchingProtocols},
+		{"cross origin", http.Header{"Origin": {"https://attacker.example"}}, http.StatusForbidden},
+		{"origin of another port", http.Header{"Origin": {"http://127.0.0.1:1"}}, http.StatusForbidden},
+		{"invalid origin", http.Header{"Origin": {"http://%zz"}}, http.StatusForbidden},
+		{"unsupported version", http.Header{"Sec-WebSocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"missing key", http.Header{"Sec-WebSocket-Key": {""}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, resp := dialWebSocket(t, srv, tt.header)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusSwitchingProtocols {
+				return
+			}
+			// the example of RFC 6455, section 1.3
+			if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Errorf("Sec-WebSocket-Accept = %q", got)
+			}
+		})
+	}
+}
+
+func TestWebSocketFraming(t *testing.T) {
+	srv := webSocketServer(t)
+	conn, br, resp := dialWebSocket(t, srv, nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	op, payload := readServerFrame(t, br)
+	if op != opText {
+		t.Fatalf("opcode = %#x, want text", op)
+	}
+	var msg webSocketMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "hello" || msg.Data != "world" {
+		t.Errorf("message = %+v", msg)
+	}
+
+	writeClientFrame(t, conn, opPing, []byte("ping"), true)
+	if op, payload := readServerFrame(t, br); op != opPong || string(payload) != "ping" {
+		t.Errorf("answer to ping = %#x %q, want pong \"ping\"", op, payload)
+	}
+
+	writeClientFrame(t, conn, opClose, []byte{0x03, 0xe8}, true)
+	op, payload = readServerFrame(t, br)
+	if op != opClose || binary.BigEndian.Uint16(payload) != closeNormal {
+		t.Errorf("answer to close = %#x %v, want close 1000", op, payload)
+	}
+}
+
+func TestWebSocketRejectsUnmaskedFrames(t *testing.T) {
+	srv := webSocketServer(t)
+	conn, br, _ := dialWebSocket(t, srv, nil)
+	readServerFrame(t, br)
+
+	writeClientFrame(t, conn, opPing, []byte("ping"), false)
+	op, payload := readServerFrame(t, br)
+	if op != opClose || binary.BigEndian.Uint16(payload) != closeProtocol {
+		t.Errorf("answer to unmasked frame = %#x %v, want close 1002", op, payload)
+	}
+}
+
+func TestWebSocketRejectsBigFrames(t *testing.T) {
+	srv := webSocketServer(t)
+	conn, br, _ := dialWebSocket(t, srv, nil)
+	readServerFrame(t, br)
+
+	header := []byte{0x80 | opText, 0x80 | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(header[2:], maxClientFrame+1)
+	if _, err := conn.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	op, payload := readServerFrame(t, br)
+	if op != opClose || binary.BigEndian.Uint16(payload) != closeTooBig {
+		t.Errorf("answer to big frame = %#x %v, want close 1009", op, payload)
+	}
+}
+
+func TestWebSocketLargeMessages(t *testing.T) {
+	for _, size := range []int{125, 126, 0xffff, 0x10000} {
+		server, client := net.Pipe()
+		ws := &webSocket{conn: server, rw: bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))}
+		payload := strings.Repeat("x", size)
+		go func() {
+			_ = ws.writeFrame(opText, []byte(payload))
+		}()
+		_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+		op, got := readServerFrame(t, client)
+		if op != opText || string(got) != payload {
+			t.Errorf("frame of %d bytes read back as %#x of %d bytes", size, op, len(got))
+		}
+		server.Close()
+		client.Close()
+	}
+}
@@ -0,0 +1,8 @@
+package bars
+
+import "github.com/nathanusask/docker-go-demo/interval"
+
+// CollectionName is the collection caching the bars of collection at iv.
+func CollectionName(collection string, iv interval.Interval) string {
+	return "bars." + collection + "." + iv.String()
+}
@@ -0,0 +1,13 @@
+package bars
+
+import (
+	"context"
+
+	"github.com/nathanusask/docker-go-demo/interval"
+)
+
+type Interface interface {
+	// Materialize makes sure bars.<collection>.<interval> holds OHLCV bars of the trades in
+	// collection within [start, end) and returns the name of the bars collection.
+	Materialize(ctx context.Context, image string, collection string, iv interval.Interval, start, end int64) (string, error)
+}
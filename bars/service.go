@@ -0,0 +1,83 @@
+package bars
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/interval"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/query"
+)
+
+type builder struct {
+	runner containerize.Interface
+	mongo  config.Mongo
+	log    *logging.Logger
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (b *builder) Materialize(ctx context.Context, image string, collection string, iv interval.Interval, start, end int64) (string, error) {
+	logger := b.log.Ctx(ctx).With(logging.Phase, "bars")
+	ms, ok := iv.Milliseconds()
+	if !ok {
+		err := fmt.Errorf("bars need a fixed-width interval, got %s", iv)
+		logger.Error("invalid bar interval", "error", err)
+		return "", err
+	}
+	target := CollectionName(collection, iv)
+	// bars are only cached whole: a bar built from the trades after a start falling inside
+	// it would be served as is to later runs starting on its open
+	if start > 0 {
+		start -= start % ms
+	}
+
+	// concurrent nodes asking for the same bars wait for a single build; builds of other
+	// orchestrators sharing the workspace and Docker daemon run under other container names
+	lock := b.lock(target)
+	lock.Lock()
+	defer lock.Unlock()
+
+	stages := append(query.Build(query.Spec{Needs: factor.Needs{BucketMs: ms}}), query.Merge(target))
+	pipeline, err := query.JSON(stages)
+	if err != nil {
+		logger.Error("failed to encode bar pipeline", "error", err)
+		return "", err
+	}
+	args := append(b.mongo.Args(),
+		"--collection", collection,
+		"--target", target,
+		"--pipeline", pipeline,
+		"--start", strconv.FormatInt(start, 10),
+		"--end", strconv.FormatInt(end, 10),
+	)
+	logger.Info("materializing bars", "target", target)
+	containerName := strings.ToLower(target) + "-" + containerize.BootID()
+	if err := b.runner.RunFactor(ctx, image, BarsMainTemplate, containerName, args); err != nil {
+		logger.Error("failed to materialize bars", "target", target, "error", err)
+		return "", err
+	}
+	return target, nil
+}
+
+func (b *builder) lock(target string) *sync.Mutex {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l, ok := b.locks[target]
+	if !ok {
+		l = &sync.Mutex{}
+		b.locks[target] = l
+	}
+	return l
+}
+
+func New(runner containerize.Interface, mongo config.Mongo, logger *logging.Logger) Interface {
+	return &builder{runner: runner, mongo: mongo, log: logger, locks: make(map[string]*sync.Mutex)}
+}
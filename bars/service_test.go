@@ -0,0 +1,156 @@
+package bars
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/interval"
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+// fakeRunner records the runs of the bar builder, and how many overlapped.
+type fakeRunner struct {
+	containerize.Interface
+
+	mu         sync.Mutex
+	names      []string
+	args       [][]string
+	running    int
+	maxRunning int
+}
+
+func (f *fakeRunner) RunFactor(_ context.Context, image, code, containerName string, args []string) error {
+	f.mu.Lock()
+	f.names = append(f.names, containerName)
+	f.args = append(f.args, args)
+	f.running++
+	if f.running > f.maxRunning {
+		f.maxRunning = f.running
+	}
+	f.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	f.mu.Lock()
+	f.running--
+	f.mu.Unlock()
+	return nil
+}
+
+// arg is the value of flag in args.
+func arg(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func newTestBuilder(runner *fakeRunner) Interface {
+	mongo := config.Mongo{Host: "mongo", Port: 27017, Database: "quant"}
+	return New(runner, mongo, logging.New(io.Discard, "text", logging.LevelInfo))
+}
+
+func TestMaterialize(t *testing.T) {
+	runner := &fakeRunner{}
+	fiveMinutes := interval.Interval{N: 5, Unit: interval.Minute}
+	target, err := newTestBuilder(runner).Materialize(context.Background(), "factor-bars", "btc_trades", fiveMinutes, 1000, 3_600_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "bars.btc_trades.5min" {
+		t.Errorf("Materialize() = %s", target)
+	}
+	if len(runner.args) != 1 {
+		t.Fatalf("%d runs", len(runner.args))
+	}
+	// the container of another orchestrator building the same bars has another name
+	if want := "bars.btc_trades.5min-" + containerize.BootID(); runner.names[0] != want {
+		t.Errorf("container name = %s, want %s", runner.names[0], want)
+	}
+	args := runner.args[0]
+	for flag, want := range map[string]string{
+		"--host":       "mongo",
+		"--collection": "btc_trades",
+		"--target":     target,
+		// the start is floored to the open of its bar
+		"--start": "0",
+		"--end":   "3600000",
+	} {
+		if got := arg(args, flag); got != want {
+			t.Errorf("%s = %q, want %q", flag, got, want)
+		}
+	}
+	pipeline := arg(args, "--pipeline")
+	for _, want := range []string{`"$mod":["$ts",300000]`, `"$merge":{"into":"bars.btc_trades.5min"`} {
+		if !strings.Contains(pipeline, want) {
+			t.Errorf("pipeline %s lacks %s", pipeline, want)
+		}
+	}
+	if strings.Contains(pipeline, `"$match"`) {
+		t.Error("pipeline matches ts, which main.py does after looking at the cached bars")
+	}
+}
+
+func TestMaterializeFloorsStart(t *testing.T) {
+	minute := interval.Interval{N: 1, Unit: interval.Minute}
+	for start, want := range map[int64]string{0: "0", 60_000: "60000", 119_999: "60000", 120_001: "120000"} {
+		runner := &fakeRunner{}
+		if _, err := newTestBuilder(runner).Materialize(context.Background(), "", "trades", minute, start, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := arg(runner.args[0], "--start"); got != want {
+			t.Errorf("--start of %d = %s, want %s", start, got, want)
+		}
+	}
+}
+
+func TestMaterializeCalendarInterval(t *testing.T) {
+	runner := &fakeRunner{}
+	month := interval.Interval{N: 1, Unit: interval.Month}
+	if _, err := newTestBuilder(runner).Materialize(context.Background(), "", "trades", month, 0, 0); err == nil {
+		t.Error("Materialize() of monthly bars succeeded")
+	}
+	if len(runner.args) != 0 {
+		t.Error("monthly bars were built")
+	}
+}
+
+func TestMaterializeOnce(t *testing.T) {
+	runner := &fakeRunner{}
+	b := newTestBuilder(runner)
+	minute := interval.Interval{N: 1, Unit: interval.Minute}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.Materialize(context.Background(), "", "trades", minute, 0, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runner.maxRunning != 1 {
+		t.Errorf("%d builds of the same bars overlapped", runner.maxRunning)
+	}
+	if _, err := b.Materialize(context.Background(), "", "quotes", minute, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.names) != 4 {
+		t.Errorf("%d builds, want 4", len(runner.names))
+	}
+}
+
+func TestCollectionName(t *testing.T) {
+	if got := CollectionName("btc_trades", interval.Interval{N: 1, Unit: interval.Hour}); got != "bars.btc_trades.1h" {
+		t.Errorf("CollectionName() = %s", got)
+	}
+}
@@ -0,0 +1,56 @@
+package bars
+
+import "github.com/nathanusask/docker-go-demo/factor"
+
+// BarsMainTemplate is the main.py materializing bars. When the cached bars already cover the
+// start of the requested range, it only recomputes bars from the last cached bar onwards,
+// which is rebuilt since it may have been built from a partial interval.
+const BarsMainTemplate = `import argparse
+import json
+import os
+from urllib.parse import quote_plus, urlencode
+from pymongo import MongoClient, ASCENDING, DESCENDING
+
+parser = argparse.ArgumentParser(description="build OHLCV bars")
+parser.add_argument("--host")
+parser.add_argument("--port", type=int)
+parser.add_argument("--database")
+parser.add_argument("--auth_source")
+parser.add_argument("--replica_set")
+parser.add_argument("--tls")
+parser.add_argument("--tls_ca_file")
+parser.add_argument("--collection")
+parser.add_argument("--target")
+parser.add_argument("--pipeline")
+parser.add_argument("--start", type=int, default=0)
+parser.add_argument("--end", type=int, default=-1)
+
+args = parser.parse_args()
+
+` + factor.MongoConnection + `db = mongo_client[args.database]
+
+source = db[args.collection]
+target = db[args.target]
+target.create_index([("ts", ASCENDING)], unique=True)
+
+lower = args.start
+if lower <= 0:
+    first_trade = source.find_one(sort=[("ts", ASCENDING)], projection={"ts": 1})
+    if first_trade is not None:
+        lower = first_trade["ts"]
+
+start = args.start
+first = target.find_one(sort=[("ts", ASCENDING)])
+last = target.find_one(sort=[("ts", DESCENDING)])
+if first is not None and first["ts"] <= lower and last["ts"] > start:
+    start = last["ts"]
+
+match = {"$gte": start}
+if args.start < args.end:
+    match["$lt"] = args.end
+pipeline = [{"$match": {"ts": match}}] + json.loads(args.pipeline)
+source.aggregate(pipeline)
+print("bars up to date in", args.target)
+
+mongo_client.close()
+`
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/factortest"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/manifest"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+func factorCreate(_ context.Context, a *app, args []string) error {
+	fs := newFlagSet("factor create")
+	file := fs.String("f", "", "factor manifest")
+	dir := fs.String("d", "", "directory searched for factor.yaml, factor.yml and factor.json manifests")
+	_ = fs.Parse(args)
+
+	var factors []factor.Factor
+	switch {
+	case *file != "" && *dir == "":
+		f, err := manifest.Load(*file)
+		if err != nil {
+			return err
+		}
+		factors = append(factors, f)
+	case *dir != "" && *file == "":
+		var err error
+		if factors, err = manifest.LoadDir(*dir); err != nil {
+			return err
+		}
+	default:
+		return errors.New("factor create: exactly one of -f and -d is required")
+	}
+	for _, f := range factors {
+		if err := a.registry.Put(f); err != nil {
+			return err
+		}
+		fmt.Println("created factor", f.FactorName)
+	}
+	return nil
+}
+
+func factorList(_ context.Context, a *app, args []string) error {
+	fs := newFlagSet("factor list")
+	_ = fs.Parse(args)
+
+	factors, err := a.registry.List()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPARAMS\tDESCRIPTION")
+	for _, f := range factors {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", f.FactorName, len(f.ParamTypes), f.Description)
+	}
+	return w.Flush()
+}
+
+func factorRender(_ context.Context, a *app, args []string) error {
+	fs := newFlagSet("factor render")
+	name := fs.String("factor", "", "factor name")
+	storage := storageFlags(fs)
+	_ = fs.Parse(args)
+
+	f, err := a.registry.Get(*name)
+	if err != nil {
+		return err
+	}
+	return factor.Render(os.Stdout, f, a.cfg.Mongo, storage())
+}
+
+func imageBuild(ctx context.Context, a *app, args []string) (err error) {
+	fs := newFlagSet("image build")
+	name := fs.String("factor", "", "factor name")
+	_ = fs.Parse(args)
+
+	f, err := a.registry.Get(*name)
+	if err != nil {
+		return err
+	}
+	ctx = logging.WithFields(ctx, logging.Factor, f.FactorName, logging.FactorVersion, f.Version())
+	ctx, span := tracing.Start(ctx, "image build", "factor", f.FactorName, "factor.version", f.Version())
+	defer func() { span.End(err) }()
+
+	dir, err := factor.BuildContext(ctx, f, a.cfg)
+	if err != nil {
+		return err
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	return runner.BuildImage(ctx, dir, a.cfg.Image.ImageName(strings.ToLower(f.FactorName)))
+}
+
+func factorTest(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("factor test")
+	name := fs.String("factor", "", "factor name")
+	fixture := fs.String("fixture", "", "CSV or JSON lines fixture of single-input factors")
+	golden := fs.String("golden", "", "CSV or JSON lines file of the expected output")
+	tolerance := fs.Float64("tolerance", 1e-9, "relative tolerance of numbers, absolute below 1")
+	update := fs.Bool("update", false, "rewrite the golden file with the output")
+	image := fs.String("image", "", "image to run in, defaults to the image built for the factor or else the configured base image")
+	params := keyValues{}
+	fs.Var(params, "param", "factor parameter as name=value, repeatable")
+	fixtures := keyValues{}
+	fs.Var(fixtures, "input", "fixture of a named input as name=file, repeatable")
+	_ = fs.Parse(args)
+
+	f, err := a.registry.Get(*name)
+	if err != nil {
+		return err
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	if *image == "" {
+		*image = a.factorImage(ctx, runner, f)
+	}
+	diffs, err := factortest.Run(ctx, runner, a.cfg, factortest.Case{
+		Factor:    f,
+		Params:    params,
+		Fixture:   *fixture,
+		Fixtures:  fixtures,
+		Image:     *image,
+		Golden:    *golden,
+		Tolerance: *tolerance,
+		Update:    *update,
+	})
+	if err != nil {
+		return err
+	}
+	if *update {
+		fmt.Println("updated", *golden)
+		return nil
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("factor %s: output differs from %s", f.FactorName, *golden)
+	}
+	fmt.Println("factor", f.FactorName, "matches", *golden)
+	return nil
+}
@@ -0,0 +1,239 @@
+// Command factorctl manages factors, their images and their runs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/registry"
+	"github.com/nathanusask/docker-go-demo/runs"
+	"github.com/nathanusask/docker-go-demo/secrets"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+// commands is filled in init since the commands refer back to it for their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"config dump":   {"config dump", configDump},
+		"factor create": {"factor create -f factor.yaml | -d DIR", factorCreate},
+		"factor list":   {"factor list", factorList},
+		"factor render": {"factor render --factor NAME [--source KIND] [--sink KIND]", factorRender},
+		"factor test":   {"factor test --factor NAME (--fixture F | --input name=F...) --golden G [--param k=v]... [--tolerance X] [--update]", factorTest},
+		"image build":   {"image build --factor NAME", imageBuild},
+		"run":           {"run --factor NAME [--param k=v]... [--collection C | --input name=C...] [--from T] [--to T] [--image I] [--source KIND --source-option k=v...] [--sink KIND --sink-option k=v...] [--max-attempts N]", runFactor},
+		"runs list":     {"runs list [--factor NAME] [--status S] [--since T] [--until T]", runsList},
+		"runs logs":     {"runs logs [--follow] [--since TIME] [--tail N] RUN_ID", runsLogs},
+		"runs cancel":   {"runs cancel RUN_ID", runsCancel},
+		"runs rerun":    {"runs rerun [--tolerance X] RUN_ID", runsRerun},
+		"runs export":   {"runs export --dir DIR [--format parquet|csv] [--partition-by-date] [--timezone TZ] RUN_ID", runsExport},
+		"reconcile":     {"reconcile", reconcileRuns},
+		"serve":         {"serve [--addr ADDR]", serve},
+	}
+}
+
+// app holds what commands share; the runner is only created for commands needing it.
+type app struct {
+	cfg      config.Config
+	registry registry.Interface
+	runs     runs.Interface
+	runner   containerize.Interface
+	log      *logging.Logger
+}
+
+// factorImage is the image image build built for f, or empty, standing for the configured
+// base image, when there is none.
+func (a *app) factorImage(ctx context.Context, runner containerize.Interface, f factor.Factor) string {
+	image := a.cfg.Image.ImageName(strings.ToLower(f.FactorName))
+	if _, err := runner.ImageDigest(ctx, image); err != nil {
+		return ""
+	}
+	return image
+}
+
+func (a *app) containerize() (containerize.Interface, error) {
+	if a.runner != nil {
+		return a.runner, nil
+	}
+	// containers and runs are this process's while it holds its boot ID
+	if err := containerize.Hold(a.cfg.Workspace); err != nil {
+		return nil, fmt.Errorf("hold boot ID: %w", err)
+	}
+	provider, err := secrets.New(a.cfg.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	if a.cfg.Executor == config.ExecutorLocal {
+		a.runner = containerize.NewLocal(a.cfg, provider, a.log)
+		return a.runner, nil
+	}
+	if a.cfg.Executor == config.ExecutorKubernetes {
+		kube, err := containerize.NewKubeClient(a.cfg.Kubernetes)
+		if err != nil {
+			return nil, err
+		}
+		a.runner = containerize.NewKubernetes(kube, a.cfg, provider, a.log)
+		return a.runner, nil
+	}
+	cli, err := containerize.NewClient(a.cfg.Docker)
+	if err != nil {
+		return nil, err
+	}
+	a.runner = containerize.New(cli, a.cfg, provider, a.log)
+	return a.runner, nil
+}
+
+func main() {
+	fs := flag.NewFlagSet("factorctl", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file")
+	fs.Usage = func() { usage(fs) }
+	_ = fs.Parse(os.Args[1:])
+
+	cmd, args, ok := lookup(fs.Args())
+	if !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a := &app{
+		cfg:      cfg,
+		registry: registry.New(filepath.Join(cfg.Workspace, "factors")),
+		runs:     runs.New(filepath.Join(cfg.Workspace, "runs")),
+		log:      logging.New(os.Stderr, cfg.Log.Format, level),
+	}
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing, a.log)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = cmd.run(ctx, a, args)
+	stop()
+	// keep the metrics of the command for serve to expose, also when it failed
+	if err := metrics.Push(filepath.Join(cfg.Workspace, metrics.Filename)); err != nil {
+		a.log.Error("failed to push metrics", "error", err)
+	}
+	// export the spans of the command, also when it failed
+	flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		a.log.Error("failed to export spans", "error", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// lookup finds the command named by the first one or two arguments.
+func lookup(args []string) (command, []string, bool) {
+	if len(args) >= 2 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd, args[2:], true
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd, args[1:], true
+		}
+	}
+	return command{}, nil, false
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "Usage: factorctl [-config FILE] COMMAND [FLAGS]")
+	fmt.Fprintln(out, "\nCommands:")
+	var usages []string
+	for _, cmd := range commands {
+		usages = append(usages, cmd.usage)
+	}
+	sort.Strings(usages)
+	for _, u := range usages {
+		fmt.Fprintln(out, "  factorctl", u)
+	}
+	fmt.Fprintln(out, "\nGlobal flags:")
+	fs.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of the named command.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("factorctl "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: factorctl", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// keyValues is a repeatable k=v flag.
+type keyValues map[string]string
+
+func (kv keyValues) String() string {
+	var pairs []string
+	for k, v := range kv {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (kv keyValues) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	kv[k] = v
+	return nil
+}
+
+// storageFlags defines the source and sink flags on fs and returns a function
+// building the storage from them once fs is parsed.
+func storageFlags(fs *flag.FlagSet) func() factor.Storage {
+	source := fs.String("source", "", "source kind: mongo (default), file or sql")
+	sourceOptions := keyValues{}
+	fs.Var(sourceOptions, "source-option", "source option as name=value, e.g. dir, format or dsn, repeatable")
+	sink := fs.String("sink", "", "sink kind: mongo (default) or file")
+	sinkOptions := keyValues{}
+	fs.Var(sinkOptions, "sink-option", "sink option as name=value, e.g. dir or format, repeatable")
+	return func() factor.Storage {
+		return factor.Storage{
+			Source: factor.Source{Kind: factor.SourceKind(*source), Options: sourceOptions},
+			Sink:   factor.Sink{Kind: factor.SinkKind(*sink), Options: sinkOptions},
+		}
+	}
+}
+
+func configDump(_ context.Context, a *app, args []string) error {
+	fs := newFlagSet("config dump")
+	_ = fs.Parse(args)
+	return config.Dump(os.Stdout, a.cfg)
+}
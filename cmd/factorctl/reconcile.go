@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/reconcile"
+)
+
+// reconcileRuns cleans up after the orchestrators of this instance that exited mid-run,
+// waiting for the runs it re-attaches to.
+func reconcileRuns(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reconcile")
+	_ = fs.Parse(args)
+
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	report, err := reconcile.New(runner, a.runs, a.cfg, a.log).Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("re-attached:", strings.Join(report.Reattached, " "))
+	fmt.Println("orphaned:   ", strings.Join(report.Orphaned, " "))
+	fmt.Println("lost:       ", strings.Join(report.Lost, " "))
+	fmt.Println("workspaces: ", strings.Join(report.Workspaces, " "))
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/export"
+	"github.com/nathanusask/docker-go-demo/factortest"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/pipeline"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// runsRerun reproduces a run from its provenance into a new output and reports how the new
+// output drifted from the original one.
+func runsRerun(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("runs rerun")
+	tolerance := fs.Float64("tolerance", 1e-9, "relative tolerance of numbers, absolute below 1")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("runs rerun: expected a run ID")
+	}
+
+	orig, err := a.runs.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if orig.Status != runs.StatusSucceeded {
+		return fmt.Errorf("run %s is %s, only succeeded runs can be rerun", orig.ID, orig.Status)
+	}
+	if orig.FactorVersion == "" {
+		return fmt.Errorf("run %s predates provenance and cannot be reproduced", orig.ID)
+	}
+	f, err := a.registry.GetVersion(orig.Factor, orig.FactorVersion)
+	if err != nil {
+		return err
+	}
+	image := orig.ImageDigest
+	if image == "" {
+		image = orig.Image
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+
+	node := pipeline.Node{
+		ID:         strings.ToLower(f.FactorName),
+		Factor:     f,
+		Image:      image,
+		Collection: orig.Collection,
+		Inputs:     orig.Inputs,
+		Start:      orig.Start,
+		End:        orig.End,
+		Params:     orig.Params,
+		Source:     orig.Source,
+		Sink:       orig.Sink,
+	}
+	if orig.Retry != nil {
+		node.Retry = *orig.Retry
+	}
+	run, err := a.launch(ctx, runner, runs.NewID(), node, orig.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Println("rerun", run.ID, "of", orig.ID, "succeeded, output in", run.Output)
+	if run.CodeHash != orig.CodeHash {
+		fmt.Println("generated main.py differs from the original run, the orchestrator changed in between")
+	}
+	if run.RowsIn != orig.RowsIn {
+		fmt.Printf("read %d rows, the original run read %d\n", run.RowsIn, orig.RowsIn)
+	}
+
+	diffs, err := a.drift(ctx, runner, run, orig, *tolerance)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("output of rerun %s drifted from run %s", run.ID, orig.ID)
+	}
+	fmt.Println("no drift")
+	return nil
+}
+
+// drift exports both outputs to CSV and compares them on ts, or row by row for outputs
+// without ts.
+func (a *app) drift(ctx context.Context, runner containerize.Interface, run, orig runs.Run, tolerance float64) ([]string, error) {
+	dir, err := os.MkdirTemp("", "factorctl-rerun-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	exporter := export.New(runner, a.cfg, a.log)
+	var outputs [2][]factortest.Row
+	for i, r := range []runs.Run{run, orig} {
+		req := export.ForRun(r)
+		req.Image = run.ImageDigest
+		req.Format = export.FormatCSV
+		req.Dir = filepath.Join(dir, r.ID)
+		files, err := exporter.Export(ctx, req)
+		if err != nil {
+			a.log.Ctx(ctx).Error("failed to export run", logging.RunID, r.ID, "error", err)
+			return nil, err
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("export of run %s wrote %d files", r.ID, len(files))
+		}
+		if outputs[i], err = factortest.ReadRows(files[0]); err != nil {
+			return nil, err
+		}
+	}
+	got, want := outputs[0], outputs[1]
+	if len(got) > 0 && len(want) > 0 && hasColumn(got[0], "ts") && hasColumn(want[0], "ts") {
+		return factortest.CompareBy(got, want, "ts", tolerance), nil
+	}
+	return factortest.Compare(got, want, tolerance), nil
+}
+
+func hasColumn(row factortest.Row, col string) bool {
+	_, ok := row[col]
+	return ok
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/pipeline"
+	"github.com/nathanusask/docker-go-demo/runs"
+	"github.com/nathanusask/docker-go-demo/version"
+)
+
+func runFactor(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("run")
+	name := fs.String("factor", "", "factor name")
+	collection := fs.String("collection", "", "input collection of single-input factors")
+	from := fs.String("from", "", "start of the time range, RFC 3339 or milliseconds")
+	to := fs.String("to", "", "end of the time range, RFC 3339 or milliseconds")
+	image := fs.String("image", "", "image to run in, defaults to the image built for the factor or else the configured base image")
+	params := keyValues{}
+	fs.Var(params, "param", "factor parameter as name=value, repeatable")
+	inputs := keyValues{}
+	fs.Var(inputs, "input", "named input as name=collection, repeatable")
+	storage := storageFlags(fs)
+	maxAttempts := fs.Int("max-attempts", 0, "attempts of runs failing transiently, defaults to the configured retry policy")
+	_ = fs.Parse(args)
+
+	f, err := a.registry.Get(*name)
+	if err != nil {
+		return err
+	}
+	start, err := parseTime(*from)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	end, err := parseTime(*to)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	if *image == "" {
+		*image = a.factorImage(ctx, runner, f)
+	}
+
+	node := pipeline.Node{
+		ID:         strings.ToLower(f.FactorName),
+		Factor:     f,
+		Image:      *image,
+		Collection: *collection,
+		Inputs:     inputs,
+		Start:      start,
+		End:        end,
+		Params:     params,
+		Source:     storage().Source,
+		Sink:       storage().Sink,
+	}
+	if *maxAttempts > 0 {
+		node.Retry = a.cfg.Retry
+		node.Retry.MaxAttempts = *maxAttempts
+	}
+	run, err := a.launch(ctx, runner, runs.NewID(), node, "")
+	if err != nil {
+		return err
+	}
+	output := run.Output
+	if !run.Sink.IsMongo() {
+		output = run.Sink.Path(run.Output)
+	}
+	fmt.Println("run", run.ID, "succeeded, output in", output)
+	return nil
+}
+
+// launch runs node as the single node of pipeline id, recording it as a run with its
+// provenance. It returns an error unless the run succeeded.
+func (a *app) launch(ctx context.Context, runner containerize.Interface, id string, node pipeline.Node, rerunOf string) (runs.Run, error) {
+	// factors registered before versions were kept have no copy of their version yet,
+	// which reruns need
+	if err := a.registry.Put(node.Factor); err != nil {
+		return runs.Run{}, err
+	}
+	if node.Retry.MaxAttempts == 0 {
+		node.Retry = a.cfg.Retry
+	}
+	host, _ := os.Hostname()
+	run := runs.Run{
+		ID:                  id,
+		Factor:              node.Factor.FactorName,
+		FactorVersion:       node.Factor.Version(),
+		Params:              node.Params,
+		Collection:          node.Collection,
+		Inputs:              node.Inputs,
+		Host:                host,
+		OrchestratorVersion: version.String(),
+		Instance:            a.cfg.InstanceName(),
+		BootID:              containerize.BootID(),
+		Start:               node.Start,
+		End:                 node.End,
+		Image:               node.Image,
+		Source:              node.Source,
+		Sink:                node.Sink,
+		Container:           pipeline.ContainerName(id, node),
+		Output:              pipeline.OutputCollection(id, node),
+		RerunOf:             rerunOf,
+		Retry:               &node.Retry,
+		Status:              runs.StatusRunning,
+		CreatedAt:           time.Now(),
+	}
+	if err := a.runs.Create(run); err != nil {
+		return run, err
+	}
+	a.log.Ctx(ctx).Info("run started", logging.RunID, id, logging.Factor, run.Factor, logging.FactorVersion, run.FactorVersion)
+
+	report, runErr := pipeline.New(runner, a.cfg, a.log).Run(ctx, id, pipeline.Pipeline{Nodes: []pipeline.Node{node}})
+	if len(report.Nodes) == 1 {
+		st := report.Nodes[0]
+		run.StartedAt = st.StartedAt
+		run.CodeHash = st.Provenance.CodeHash
+		run.ImageDigest = st.Provenance.ImageDigest
+		run.ExitCode = st.Provenance.ExitCode
+		run.RowsIn = st.Provenance.Stats.RowsIn
+		run.RowsOut = st.Provenance.Stats.RowsOut
+		run.PeakMemoryBytes = st.Provenance.Usage.PeakMemoryBytes
+		run.CPUSeconds = st.Provenance.Usage.CPUSeconds
+		run.Attempts = st.Provenance.Attempts
+	}
+
+	// runs cancel may have finished the run from another process
+	if latest, err := a.runs.Get(id); err == nil && latest.Status == runs.StatusCancelled {
+		return latest, fmt.Errorf("run %s was cancelled", id)
+	}
+	run.FinishedAt = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		run.Status = runs.StatusCancelled
+		if err := runner.Stop(context.Background(), run.Container); err != nil {
+			a.log.Error("failed to stop container of cancelled run", logging.RunID, id, "error", err)
+		}
+	case runErr != nil:
+		run.Status = runs.StatusFailed
+		run.Error = runErr.Error()
+	default:
+		run.Status = runs.StatusSucceeded
+	}
+	if err := a.runs.Update(run); err != nil {
+		return run, err
+	}
+	if run.Status != runs.StatusSucceeded {
+		return run, fmt.Errorf("run %s %s", id, run.Status)
+	}
+	return run, nil
+}
+
+// parseTime parses RFC 3339 timestamps or Unix milliseconds; empty means 0.
+func parseTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, errors.New("expected RFC 3339 or milliseconds since the epoch")
+	}
+	return t.UnixMilli(), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/export"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+func runsList(_ context.Context, a *app, args []string) error {
+	fs := newFlagSet("runs list")
+	name := fs.String("factor", "", "only runs of this factor")
+	status := fs.String("status", "", "only runs in this status")
+	since := fs.String("since", "", "only runs created at or after, RFC 3339 or milliseconds")
+	until := fs.String("until", "", "only runs created before, RFC 3339 or milliseconds")
+	_ = fs.Parse(args)
+
+	filter := runs.Filter{Factor: *name, Status: runs.Status(*status)}
+	var err error
+	if filter.Since, err = parseFilterTime(*since); err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	if filter.Until, err = parseFilterTime(*until); err != nil {
+		return fmt.Errorf("--until: %w", err)
+	}
+	list, err := a.runs.Query(filter)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFACTOR\tVERSION\tSTATUS\tCREATED\tROWS IN\tROWS OUT\tOUTPUT")
+	for _, r := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", r.ID, r.Factor, r.FactorVersion, a.status(r), r.CreatedAt.Format(time.RFC3339), r.RowsIn, r.RowsOut, r.Output)
+	}
+	return w.Flush()
+}
+
+// status adds the progress running runs last reported to their status.
+func (a *app) status(r runs.Run) string {
+	if r.Finished() {
+		return string(r.Status)
+	}
+	p, ok, err := factor.ReadProgress(filepath.Join(a.cfg.Workspace, r.Container))
+	if err != nil || !ok {
+		return string(r.Status)
+	}
+	return fmt.Sprintf("%s (%s %.0f%%)", r.Status, p.Phase, p.Percent)
+}
+
+// parseFilterTime is parseTime for time filters, where empty means unbounded.
+func parseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	ms, err := parseTime(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func runsLogs(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("runs logs")
+	follow := fs.Bool("follow", false, "follow the log until the run finishes")
+	since := fs.String("since", "", "only lines written at or after, RFC 3339 or milliseconds")
+	tail := fs.Int("tail", 0, "only the last lines, all when 0")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("runs logs: expected a run ID")
+	}
+
+	q := runlog.Query{Tail: *tail}
+	var err error
+	if q.Since, err = parseFilterTime(*since); err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	run, err := a.runs.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	// the log of a finished run is kept after its container is removed
+	return runner.Logs(ctx, run.Container, q, *follow && !run.Finished(), os.Stdout)
+}
+
+func runsCancel(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("runs cancel")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("runs cancel: expected a run ID")
+	}
+
+	run, err := a.runs.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if run.Finished() {
+		return fmt.Errorf("run %s is already %s", run.ID, run.Status)
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	run.Status = runs.StatusCancelled
+	run.FinishedAt = time.Now()
+	if err := a.runs.Update(run); err != nil {
+		return err
+	}
+	if err := runner.Stop(ctx, run.Container); err != nil {
+		return err
+	}
+	fmt.Println("cancelled run", run.ID)
+	return nil
+}
+
+func runsExport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("runs export")
+	format := fs.String("format", string(export.FormatParquet), "parquet or csv")
+	dir := fs.String("dir", "", "directory the files are written to")
+	byDate := fs.Bool("partition-by-date", false, "write one date=YYYY-MM-DD directory per day")
+	timezone := fs.String("timezone", "UTC", "timezone of the datetime columns and date partitions")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("runs export: expected a run ID")
+	}
+
+	run, err := a.runs.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if run.Status != runs.StatusSucceeded {
+		return fmt.Errorf("run %s is %s, only succeeded runs can be exported", run.ID, run.Status)
+	}
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	req := export.ForRun(run)
+	req.Format = export.Format(*format)
+	req.Dir = *dir
+	req.PartitionByDate = *byDate
+	req.Timezone = *timezone
+	files, err := export.New(runner, a.cfg, a.log).Export(ctx, req)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/api"
+	"github.com/nathanusask/docker-go-demo/export"
+	"github.com/nathanusask/docker-go-demo/reconcile"
+)
+
+func serve(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	_ = fs.Parse(args)
+
+	runner, err := a.containerize()
+	if err != nil {
+		return err
+	}
+	// runs of orchestrators that exited mid-run are attended to while serving
+	go func() {
+		report, err := reconcile.New(runner, a.runs, a.cfg, a.log).Reconcile(ctx)
+		if err != nil {
+			a.log.Error("failed to reconcile", "error", err)
+			return
+		}
+		a.log.Info("reconciled", "reattached", len(report.Reattached), "orphaned", len(report.Orphaned), "lost", len(report.Lost), "workspaces", len(report.Workspaces))
+	}()
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: api.New(a.runs, export.New(runner, a.cfg, a.log), a.cfg.Workspace, filepath.Join(a.cfg.Workspace, "exports"), a.log),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			a.log.Error("failed to shut down server", "error", err)
+		}
+	}()
+	a.log.Info("listening", "addr", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the orchestrator configuration. Defaults match the values the orchestrator
+// used before it was configurable.
+type Config struct {
+	// Executor is docker, running factors in containers, kubernetes, running them as
+	// Jobs, or local, running them with a host Python interpreter for quick iteration.
+	Executor  string    `yaml:"executor" json:"executor"`
+	Local     Local     `yaml:"local" json:"local"`
+	Docker    Docker    `yaml:"docker" json:"docker"`
+	Image     Image     `yaml:"image" json:"image"`
+	Mongo     Mongo     `yaml:"mongo" json:"mongo"`
+	Resources Resources `yaml:"resources" json:"resources"`
+	Timeouts  Timeouts  `yaml:"timeouts" json:"timeouts"`
+	Retry     Retry     `yaml:"retry" json:"retry"`
+	Reconcile Reconcile `yaml:"reconcile" json:"reconcile"`
+	Secrets   Secrets   `yaml:"secrets" json:"secrets"`
+	Log       Log       `yaml:"log" json:"log"`
+	Tracing   Tracing   `yaml:"tracing" json:"tracing"`
+	// Workspace is the directory generated main.py files are written to.
+	Workspace string `yaml:"workspace" json:"workspace"`
+	// Instance tells the containers of this orchestrator from those of others sharing the
+	// Docker daemon; empty means the host name. Orchestrators on different hosts need
+	// different instances.
+	Instance string `yaml:"instance" json:"instance"`
+	// Kubernetes configures the kubernetes executor.
+	Kubernetes Kubernetes `yaml:"kubernetes" json:"kubernetes"`
+}
+
+// InstanceName is Instance or, without one, the host name.
+func (c Config) InstanceName() string {
+	if c.Instance != "" {
+		return c.Instance
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+type Docker struct {
+	// Host is the Docker endpoint, e.g. unix:///var/run/docker.sock; empty means DOCKER_HOST.
+	Host string `yaml:"host" json:"host"`
+	// APIVersion pins the API version; empty means negotiation.
+	APIVersion string   `yaml:"api_version" json:"api_version"`
+	ExtraHosts []string `yaml:"extra_hosts" json:"extra_hosts"`
+	// Volumes are bind mounts of every factor container as host:container[:ro], e.g. the
+	// directories of file sources and sinks.
+	Volumes []string `yaml:"volumes" json:"volumes"`
+	// StatsInterval is how often the resource usage of running factor containers is
+	// sampled; zero turns sampling off.
+	StatsInterval Duration `yaml:"stats_interval" json:"stats_interval"`
+}
+
+const (
+	ExecutorDocker     = "docker"
+	ExecutorKubernetes = "kubernetes"
+	ExecutorLocal      = "local"
+)
+
+// Kubernetes configures the kubernetes executor. Empty connection settings mean those of
+// the service account of the pod the orchestrator runs in.
+type Kubernetes struct {
+	// Host is the URL of the API server.
+	Host string `yaml:"host" json:"host"`
+	// TokenFile holds the bearer token, read again periodically as it may be rotated.
+	TokenFile string `yaml:"token_file" json:"token_file"`
+	// CAFile is the CA bundle of the API server.
+	CAFile string `yaml:"ca_file" json:"ca_file"`
+	// Namespace is where Jobs are created.
+	Namespace string `yaml:"namespace" json:"namespace"`
+	// ServiceAccount runs the factor pods; empty means the namespace default.
+	ServiceAccount string `yaml:"service_account" json:"service_account"`
+	// WorkspaceClaim is a PersistentVolumeClaim also mounted at Workspace; a run's directory
+	// of it is the working directory of main.py, so row counts, spans and file sinks reach
+	// the orchestrator. Without one, runs work in an emptyDir and report no row counts.
+	WorkspaceClaim string `yaml:"workspace_claim" json:"workspace_claim"`
+	// PollInterval is how often the status of running Jobs is polled.
+	PollInterval Duration `yaml:"poll_interval" json:"poll_interval"`
+}
+
+// Local configures the local executor.
+type Local struct {
+	// Python is the interpreter creating the virtualenv.
+	Python string `yaml:"python" json:"python"`
+	// VenvDir is where virtualenvs are created; empty means the system temp dir.
+	VenvDir string `yaml:"venv_dir" json:"venv_dir"`
+	// MongoHost replaces Mongo.Host, which is usually only resolvable from containers.
+	MongoHost string `yaml:"mongo_host" json:"mongo_host"`
+}
+
+type Image struct {
+	// Base is the image factors run in when a run does not name one.
+	Base string `yaml:"base" json:"base"`
+	// Prefix is prepended to the lowercase factor name when naming factor images.
+	Prefix string `yaml:"prefix" json:"prefix"`
+	Tag    string `yaml:"tag" json:"tag"`
+}
+
+// Mongo is the MongoDB connection as seen from inside factor containers.
+type Mongo struct {
+	Host       string `yaml:"host" json:"host"`
+	Port       int    `yaml:"port" json:"port"`
+	Database   string `yaml:"database" json:"database"`
+	AuthSource string `yaml:"auth_source" json:"auth_source"`
+	ReplicaSet string `yaml:"replica_set" json:"replica_set"`
+	TLS        bool   `yaml:"tls" json:"tls"`
+	// TLSCAFile is the CA bundle path inside factor containers.
+	TLSCAFile string `yaml:"tls_ca_file" json:"tls_ca_file"`
+}
+
+// Args are the connection arguments of scripts using factor.MongoConnection.
+func (m Mongo) Args() []string {
+	return []string{
+		"--host", m.Host,
+		"--port", strconv.Itoa(m.Port),
+		"--database", m.Database,
+		"--auth_source", m.AuthSource,
+		"--replica_set", m.ReplicaSet,
+		"--tls", strconv.FormatBool(m.TLS),
+		"--tls_ca_file", m.TLSCAFile,
+	}
+}
+
+const (
+	SecretsEnv   = "env"
+	SecretsFile  = "file"
+	SecretsVault = "vault"
+
+	InjectFile = "file"
+	InjectEnv  = "env"
+)
+
+// Secrets configures where credentials come from and how they reach factor containers.
+type Secrets struct {
+	// Provider is one of env, file or vault.
+	Provider string `yaml:"provider" json:"provider"`
+	// Path is the secrets directory of the file provider or the JSON file of the vault provider.
+	Path string `yaml:"path" json:"path"`
+	// Inject is file, mounting a read-only credentials file, or env.
+	Inject string `yaml:"inject" json:"inject"`
+	// Dir is the host directory credentials files are written to; it should be a tmpfs.
+	Dir string `yaml:"dir" json:"dir"`
+}
+
+// Resources are the default limits of factor containers; zero means unlimited.
+type Resources struct {
+	CPUs     float64 `yaml:"cpus" json:"cpus"`
+	MemoryMB int64   `yaml:"memory_mb" json:"memory_mb"`
+}
+
+// Log configures the orchestrator's own log lines, not the output of factors.
+type Log struct {
+	// Format is text or json.
+	Format string `yaml:"format" json:"format"`
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" json:"level"`
+}
+
+// Tracing configures the export of spans of image builds and runs.
+type Tracing struct {
+	// Exporter is none, stdout, writing spans as JSON lines, or otlp.
+	Exporter string `yaml:"exporter" json:"exporter"`
+	// Endpoint is the base URL of an OTLP/HTTP collector; spans are posted to <endpoint>/v1/traces.
+	Endpoint    string `yaml:"endpoint" json:"endpoint"`
+	ServiceName string `yaml:"service_name" json:"service_name"`
+}
+
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingOTLP   = "otlp"
+)
+
+type Timeouts struct {
+	Run   Duration `yaml:"run" json:"run"`
+	Build Duration `yaml:"build" json:"build"`
+}
+
+// Retry is the retry policy of runs failing transiently, e.g. on a lost MongoDB connection.
+type Retry struct {
+	// MaxAttempts is how often a run is attempted at most; 1 turns retries off.
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts"`
+	// InitialBackoff is the wait before the second attempt, doubled before every further
+	// attempt up to MaxBackoff. Waits are jittered so that runs failing together spread out.
+	InitialBackoff Duration `yaml:"initial_backoff" json:"initial_backoff"`
+	MaxBackoff     Duration `yaml:"max_backoff" json:"max_backoff"`
+}
+
+const (
+	OrphansRemove = "remove"
+	OrphansStop   = "stop"
+	OrphansKeep   = "keep"
+)
+
+// Reconcile configures the cleanup after orchestrators that exited mid-run.
+type Reconcile struct {
+	// Orphans is what happens to containers of no run in flight: remove, stop, keeping
+	// them for inspection, or keep.
+	Orphans string `yaml:"orphans" json:"orphans"`
+	// WorkspaceRetention is how long the workspace directories of finished runs, holding
+	// their logs, are kept; zero keeps them.
+	WorkspaceRetention Duration `yaml:"workspace_retention" json:"workspace_retention"`
+}
+
+// Duration is a time.Duration written as a string such as "1h30m" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		Executor: ExecutorDocker,
+		Local: Local{
+			Python:    "python3",
+			MongoHost: "localhost",
+		},
+		Docker: Docker{
+			ExtraHosts:    []string{"host.docker.internal:host-gateway"},
+			StatsInterval: Duration(5 * time.Second),
+		},
+		Kubernetes: Kubernetes{
+			PollInterval: Duration(2 * time.Second),
+		},
+		Image: Image{
+			Base:   "poc",
+			Prefix: "factor-",
+			Tag:    "latest",
+		},
+		Mongo: Mongo{
+			Host:     "host.docker.internal",
+			Port:     27017,
+			Database: "quant",
+		},
+		Timeouts: Timeouts{
+			Run:   Duration(time.Hour),
+			Build: Duration(10 * time.Minute),
+		},
+		Retry: Retry{
+			MaxAttempts:    3,
+			InitialBackoff: Duration(5 * time.Second),
+			MaxBackoff:     Duration(time.Minute),
+		},
+		Reconcile: Reconcile{
+			Orphans:            OrphansRemove,
+			WorkspaceRetention: Duration(7 * 24 * time.Hour),
+		},
+		Secrets: Secrets{
+			Provider: SecretsEnv,
+			Inject:   InjectFile,
+			Dir:      "/dev/shm",
+		},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Tracing: Tracing{
+			Exporter:    TracingNone,
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "factorctl",
+		},
+		Workspace: ".",
+	}
+}
+
+// ImageName is the name of the image built for a factor.
+func (i Image) ImageName(factorNameLowercase string) string {
+	return i.Prefix + factorNameLowercase + ":" + i.Tag
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the config file at path on top of the defaults, applies environment overrides
+// and validates the result. An empty path skips the file. Files ending in .json are read as
+// JSON, anything else as YAML.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			err = json.Unmarshal(b, &cfg)
+		} else {
+			err = yaml.Unmarshal(b, &cfg)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// envOverrides maps environment variables to the setting they override.
+var envOverrides = map[string]func(cfg *Config, v string) error{
+	"FACTOR_EXECUTOR":           func(cfg *Config, v string) error { cfg.Executor = v; return nil },
+	"FACTOR_LOCAL_PYTHON":       func(cfg *Config, v string) error { cfg.Local.Python = v; return nil },
+	"FACTOR_LOCAL_VENV_DIR":     func(cfg *Config, v string) error { cfg.Local.VenvDir = v; return nil },
+	"FACTOR_LOCAL_MONGO_HOST":   func(cfg *Config, v string) error { cfg.Local.MongoHost = v; return nil },
+	"FACTOR_DOCKER_HOST":        func(cfg *Config, v string) error { cfg.Docker.Host = v; return nil },
+	"FACTOR_DOCKER_API_VERSION": func(cfg *Config, v string) error { cfg.Docker.APIVersion = v; return nil },
+	"FACTOR_DOCKER_EXTRA_HOSTS": func(cfg *Config, v string) error { cfg.Docker.ExtraHosts = splitList(v); return nil },
+	"FACTOR_DOCKER_VOLUMES":     func(cfg *Config, v string) error { cfg.Docker.Volumes = splitList(v); return nil },
+	"FACTOR_IMAGE_BASE":         func(cfg *Config, v string) error { cfg.Image.Base = v; return nil },
+	"FACTOR_IMAGE_PREFIX":       func(cfg *Config, v string) error { cfg.Image.Prefix = v; return nil },
+	"FACTOR_IMAGE_TAG":          func(cfg *Config, v string) error { cfg.Image.Tag = v; return nil },
+	"FACTOR_MONGO_HOST":         func(cfg *Config, v string) error { cfg.Mongo.Host = v; return nil },
+	"FACTOR_MONGO_PORT": func(cfg *Config, v string) (err error) {
+		cfg.Mongo.Port, err = strconv.Atoi(v)
+		return err
+	},
+	"FACTOR_MONGO_DATABASE":    func(cfg *Config, v string) error { cfg.Mongo.Database = v; return nil },
+	"FACTOR_MONGO_AUTH_SOURCE": func(cfg *Config, v string) error { cfg.Mongo.AuthSource = v; return nil },
+	"FACTOR_MONGO_REPLICA_SET": func(cfg *Config, v string) error { cfg.Mongo.ReplicaSet = v; return nil },
+	"FACTOR_MONGO_TLS": func(cfg *Config, v string) (err error) {
+		cfg.Mongo.TLS, err = strconv.ParseBool(v)
+		return err
+	},
+	"FACTOR_MONGO_TLS_CA_FILE": func(cfg *Config, v string) error { cfg.Mongo.TLSCAFile = v; return nil },
+	"FACTOR_LOG_FORMAT":        func(cfg *Config, v string) error { cfg.Log.Format = v; return nil },
+	"FACTOR_LOG_LEVEL":         func(cfg *Config, v string) error { cfg.Log.Level = v; return nil },
+	"FACTOR_TRACING_EXPORTER":  func(cfg *Config, v string) error { cfg.Tracing.Exporter = v; return nil },
+	"FACTOR_TRACING_ENDPOINT":  func(cfg *Config, v string) error { cfg.Tracing.Endpoint = v; return nil },
+	"FACTOR_CPUS": func(cfg *Config, v string) (err error) {
+		cfg.Resources.CPUs, err = strconv.ParseFloat(v, 64)
+		return err
+	},
+	"FACTOR_DOCKER_STATS_INTERVAL": func(cfg *Config, v string) error {
+		return cfg.Docker.StatsInterval.UnmarshalText([]byte(v))
+	},
+	"FACTOR_RETRY_MAX_ATTEMPTS": func(cfg *Config, v string) (err error) {
+		cfg.Retry.MaxAttempts, err = strconv.Atoi(v)
+		return err
+	},
+	"FACTOR_RETRY_INITIAL_BACKOFF": func(cfg *Config, v string) error {
+		return cfg.Retry.InitialBackoff.UnmarshalText([]byte(v))
+	},
+	"FACTOR_RETRY_MAX_BACKOFF": func(cfg *Config, v string) error {
+		return cfg.Retry.MaxBackoff.UnmarshalText([]byte(v))
+	},
+	"FACTOR_RECONCILE_ORPHANS": func(cfg *Config, v string) error {
+		cfg.Reconcile.Orphans = v
+		return nil
+	},
+	"FACTOR_RECONCILE_WORKSPACE_RETENTION": func(cfg *Config, v string) error {
+		return cfg.Reconcile.WorkspaceRetention.UnmarshalText([]byte(v))
+	},
+	"FACTOR_KUBERNETES_NAMESPACE": func(cfg *Config, v string) error {
+		cfg.Kubernetes.Namespace = v
+		return nil
+	},
+	"FACTOR_KUBERNETES_WORKSPACE_CLAIM": func(cfg *Config, v string) error {
+		cfg.Kubernetes.WorkspaceClaim = v
+		return nil
+	},
+	"FACTOR_MEMORY_MB": func(cfg *Config, v string) (err error) {
+		cfg.Resources.MemoryMB, err = strconv.ParseInt(v, 10, 64)
+		return err
+	},
+	"FACTOR_RUN_TIMEOUT":      func(cfg *Config, v string) error { return cfg.Timeouts.Run.UnmarshalText([]byte(v)) },
+	"FACTOR_BUILD_TIMEOUT":    func(cfg *Config, v string) error { return cfg.Timeouts.Build.UnmarshalText([]byte(v)) },
+	"FACTOR_WORKSPACE":        func(cfg *Config, v string) error { cfg.Workspace = v; return nil },
+	"FACTOR_INSTANCE":         func(cfg *Config, v string) error { cfg.Instance = v; return nil },
+	"FACTOR_SECRETS_PROVIDER": func(cfg *Config, v string) error { cfg.Secrets.Provider = v; return nil },
+	"FACTOR_SECRETS_PATH":     func(cfg *Config, v string) error { cfg.Secrets.Path = v; return nil },
+	"FACTOR_SECRETS_INJECT":   func(cfg *Config, v string) error { cfg.Secrets.Inject = v; return nil },
+	"FACTOR_SECRETS_DIR":      func(cfg *Config, v string) error { cfg.Secrets.Dir = v; return nil },
+}
+
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	for name, set := range envOverrides {
+		v, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := set(cfg, v); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var ret []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func (c Config) Validate() error {
+	switch c.Executor {
+	case ExecutorDocker:
+	case ExecutorKubernetes:
+		if c.Kubernetes.PollInterval <= 0 {
+			return fmt.Errorf("kubernetes.poll_interval must be positive")
+		}
+	case ExecutorLocal:
+		if c.Local.Python == "" {
+			return fmt.Errorf("local.python must be set for the local executor")
+		}
+	default:
+		return fmt.Errorf("executor %q must be docker, kubernetes or local", c.Executor)
+	}
+	if c.Image.Base == "" {
+		return fmt.Errorf("image.base must be set")
+	}
+	if c.Image.Tag == "" {
+		return fmt.Errorf("image.tag must be set")
+	}
+	if c.Mongo.Host == "" {
+		return fmt.Errorf("mongo.host must be set")
+	}
+	if c.Mongo.Port <= 0 || c.Mongo.Port > 65535 {
+		return fmt.Errorf("mongo.port %d is out of range", c.Mongo.Port)
+	}
+	if c.Mongo.Database == "" {
+		return fmt.Errorf("mongo.database must be set")
+	}
+	if c.Resources.CPUs < 0 {
+		return fmt.Errorf("resources.cpus must not be negative")
+	}
+	if c.Resources.MemoryMB < 0 {
+		return fmt.Errorf("resources.memory_mb must not be negative")
+	}
+	if c.Docker.StatsInterval < 0 {
+		return fmt.Errorf("docker.stats_interval must not be negative")
+	}
+	if c.Timeouts.Run <= 0 {
+		return fmt.Errorf("timeouts.run must be positive")
+	}
+	if c.Timeouts.Build <= 0 {
+		return fmt.Errorf("timeouts.build must be positive")
+	}
+	if c.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry.max_attempts must be at least 1")
+	}
+	if c.Retry.InitialBackoff < 0 {
+		return fmt.Errorf("retry.initial_backoff must not be negative")
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		return fmt.Errorf("retry.max_backoff must not be less than retry.initial_backoff")
+	}
+	switch c.Reconcile.Orphans {
+	case OrphansRemove, OrphansStop, OrphansKeep:
+	default:
+		return fmt.Errorf("reconcile.orphans %q must be remove, stop or keep", c.Reconcile.Orphans)
+	}
+	if c.Reconcile.WorkspaceRetention < 0 {
+		return fmt.Errorf("reconcile.workspace_retention must not be negative")
+	}
+	if c.Workspace == "" {
+		return fmt.Errorf("workspace must be set")
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log.format %q must be text or json", c.Log.Format)
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("log.level %q must be debug, info, warn or error", c.Log.Level)
+	}
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.Tracing.Endpoint == "" {
+			return fmt.Errorf("tracing.endpoint must be set with the otlp exporter")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter %q must be none, stdout or otlp", c.Tracing.Exporter)
+	}
+	switch c.Secrets.Provider {
+	case SecretsEnv:
+	case SecretsFile, SecretsVault:
+		if c.Secrets.Path == "" {
+			return fmt.Errorf("secrets.path must be set for provider %s", c.Secrets.Provider)
+		}
+	default:
+		return fmt.Errorf("secrets.provider %q must be one of env, file or vault", c.Secrets.Provider)
+	}
+	switch c.Secrets.Inject {
+	case InjectEnv:
+	case InjectFile:
+		if c.Secrets.Dir == "" {
+			return fmt.Errorf("secrets.dir must be set to inject secrets as files")
+		}
+	default:
+		return fmt.Errorf("secrets.inject %q must be file or env", c.Secrets.Inject)
+	}
+	return nil
+}
+
+// Dump writes the effective config as YAML.
+func Dump(w io.Writer, cfg Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
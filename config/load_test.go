@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+	}{
+		{"yaml", "factorctl.yaml", "executor: local\nmongo:\n  port: 27018\nretry:\n  initial_backoff: 2s\n  max_backoff: 10s\n"},
+		{"json", "factorctl.json", `{"executor": "local", "mongo": {"port": 27018}, "retry": {"initial_backoff": "2s", "max_backoff": "10s"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Executor != ExecutorLocal || cfg.Mongo.Port != 27018 ||
+				cfg.Retry.InitialBackoff != Duration(2*time.Second) || cfg.Retry.MaxBackoff != Duration(10*time.Second) {
+				t.Errorf("Load() = %+v", cfg)
+			}
+			// settings not in the file keep their defaults
+			if cfg.Mongo.Host != Default().Mongo.Host || cfg.Retry.MaxAttempts != Default().Retry.MaxAttempts {
+				t.Errorf("Load() lost defaults: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want bytes.Buffer
+	if err := Dump(&got, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump(&want, Default()); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Load(\"\") =\n%s\nwant\n%s", got.String(), want.String())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+	}{
+		{"invalid yaml", "factorctl.yaml", "executor: [local"},
+		{"invalid duration", "factorctl.yaml", "timeouts:\n  run: soon\n"},
+		{"invalid config", "factorctl.yaml", "executor: podman\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeFile(t, tt.file, tt.content)); err == nil {
+				t.Error("Load() succeeded")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"FACTOR_EXECUTOR":             "kubernetes",
+		"FACTOR_MONGO_PORT":           "27018",
+		"FACTOR_MONGO_TLS":            "true",
+		"FACTOR_DOCKER_EXTRA_HOSTS":   " a:1.2.3.4 , ,b:5.6.7.8",
+		"FACTOR_CPUS":                 "1.5",
+		"FACTOR_MEMORY_MB":            "512",
+		"FACTOR_RUN_TIMEOUT":          "30m",
+		"FACTOR_RETRY_MAX_ATTEMPTS":   "5",
+		"FACTOR_KUBERNETES_NAMESPACE": "factors",
+	}
+	cfg := Default()
+	err := applyEnv(&cfg, func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Executor != ExecutorKubernetes || cfg.Mongo.Port != 27018 || !cfg.Mongo.TLS ||
+		strings.Join(cfg.Docker.ExtraHosts, " ") != "a:1.2.3.4 b:5.6.7.8" ||
+		cfg.Resources.CPUs != 1.5 || cfg.Resources.MemoryMB != 512 ||
+		cfg.Timeouts.Run != Duration(30*time.Minute) || cfg.Retry.MaxAttempts != 5 ||
+		cfg.Kubernetes.Namespace != "factors" {
+		t.Errorf("applyEnv() = %+v", cfg)
+	}
+	// variables that are not set leave their settings alone
+	if cfg.Mongo.Host != Default().Mongo.Host {
+		t.Errorf("Mongo.Host = %q", cfg.Mongo.Host)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	for name, v := range map[string]string{
+		"FACTOR_MONGO_PORT":  "mongo",
+		"FACTOR_MONGO_TLS":   "maybe",
+		"FACTOR_CPUS":        "two",
+		"FACTOR_RUN_TIMEOUT": "1 hour",
+	} {
+		cfg := Default()
+		err := applyEnv(&cfg, func(n string) (string, bool) { return v, n == name })
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("applyEnv() with %s=%q error = %v", name, v, err)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("FACTOR_MONGO_DATABASE", "research")
+	cfg, err := Load(writeFile(t, "factorctl.yaml", "mongo:\n  database: quant2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the environment overrides the file
+	if cfg.Mongo.Database != "research" {
+		t.Errorf("Mongo.Database = %q, want research", cfg.Mongo.Database)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		err    string
+	}{
+		{"default", func(*Config) {}, ""},
+		{"unknown executor", func(c *Config) { c.Executor = "podman" }, "executor"},
+		{"local without python", func(c *Config) { c.Executor = ExecutorLocal; c.Local.Python = "" }, "local.python"},
+		{"kubernetes without polling", func(c *Config) { c.Executor = ExecutorKubernetes; c.Kubernetes.PollInterval = 0 }, "kubernetes.poll_interval"},
+		{"no base image", func(c *Config) { c.Image.Base = "" }, "image.base"},
+		{"mongo port", func(c *Config) { c.Mongo.Port = 70000 }, "mongo.port"},
+		{"negative cpus", func(c *Config) { c.Resources.CPUs = -1 }, "resources.cpus"},
+		{"no run timeout", func(c *Config) { c.Timeouts.Run = 0 }, "timeouts.run"},
+		{"no database", func(c *Config) { c.Mongo.Database = "" }, "mongo.database"},
+		{"no attempts", func(c *Config) { c.Retry.MaxAttempts = 0 }, "retry.max_attempts"},
+		{"max backoff below initial", func(c *Config) { c.Retry.MaxBackoff = Duration(time.Second) }, "retry.max_backoff"},
+		{"orphans", func(c *Config) { c.Reconcile.Orphans = "ignore" }, "reconcile.orphans"},
+		{"no workspace", func(c *Config) { c.Workspace = "" }, "workspace"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"log level", func(c *Config) { c.Log.Level = "trace" }, "log.level"},
+		{"otlp without endpoint", func(c *Config) { c.Tracing.Exporter = TracingOTLP; c.Tracing.Endpoint = "" }, "tracing.endpoint"},
+		{"file secrets without path", func(c *Config) { c.Secrets.Provider = SecretsFile }, "secrets.path"},
+		{"file injection without dir", func(c *Config) { c.Secrets.Dir = "" }, "secrets.dir"},
+		{"env injection without dir", func(c *Config) { c.Secrets.Inject = InjectEnv; c.Secrets.Dir = "" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Validate() error = %v, want one about %s", err, tt.err)
+			}
+		})
+	}
+}
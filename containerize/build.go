@@ -0,0 +1,94 @@
+package containerize
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/metrics"
+)
+
+// tarDir archives the regular files of dir as a Docker build context.
+func tarDir(dir string) (io.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// printBuildOutput copies the stream messages of an image build to w and returns the build error, if any.
+// It counts the Dockerfile steps of the build by whether they were cached.
+func printBuildOutput(r io.Reader, w io.Writer) error {
+	// the classic builder reports every step as "Step n/m : ...", followed by
+	// " ---> Using cache" when the step is cached
+	pending := false
+	countPending := func() {
+		if pending {
+			metrics.ImageBuildSteps.Inc("miss")
+		}
+		pending = false
+	}
+	defer countPending()
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		switch {
+		case strings.HasPrefix(msg.Stream, "Step "):
+			countPending()
+			pending = true
+		case pending && strings.Contains(msg.Stream, "Using cache"):
+			metrics.ImageBuildSteps.Inc("hit")
+			pending = false
+		}
+		if _, err := io.WriteString(w, msg.Stream); err != nil {
+			return err
+		}
+	}
+}
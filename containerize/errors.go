@@ -0,0 +1,17 @@
+package containerize
+
+import "fmt"
+
+// ExitError is returned by RunFactor when main.py exits with a non-zero status.
+type ExitError struct {
+	Code int64
+	// OOMKilled is set when the container was killed for exceeding its memory limit.
+	OOMKilled bool
+}
+
+func (e *ExitError) Error() string {
+	if e.OOMKilled {
+		return fmt.Sprintf("factor exited with status %d after running out of memory", e.Code)
+	}
+	return fmt.Sprintf("factor exited with status %d", e.Code)
+}
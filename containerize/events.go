@@ -0,0 +1,255 @@
+package containerize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+// Bounds of the wait before subscribing to the events of the daemon again.
+const (
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = 30 * time.Second
+)
+
+// errContainerRemoved is the exit of a watched container removed before it exited, by
+// hand or by a daemon restarting.
+var errContainerRemoved = errors.New("container was removed before it exited")
+
+// exitStatus is how a watched container exited.
+type exitStatus struct {
+	code      int64
+	oomKilled bool
+	// err is set when the exit code is unknown.
+	err error
+}
+
+// watcher tracks the containers of the instance through a single subscription to the
+// events of the daemon, rather than a blocked ContainerWait per container. The
+// subscription only lives while containers are watched. After every (re)subscription the
+// watched containers are listed, so exits missed meanwhile are not.
+//
+// Events only resolve the waits of RunFactor and Attach, which return how the container
+// exited; their callers record that in the run. Only the events telling that a container
+// stopped are subscribed to: starts are known to who started the container.
+type watcher struct {
+	cli      *client.Client
+	instance string
+	log      *logging.Logger
+
+	mu      sync.Mutex
+	watches map[string]*watch
+	// cancel ends the subscription; nil while nothing is watched
+	cancel context.CancelFunc
+}
+
+// watch is the state of a watched container.
+type watch struct {
+	oomKilled bool
+	exited    bool
+	done      chan exitStatus
+}
+
+func (wt *watch) exit(status exitStatus) {
+	if wt.exited {
+		return
+	}
+	wt.exited = true
+	wt.done <- status
+}
+
+func newWatcher(cli *client.Client, instance string, logger *logging.Logger) *watcher {
+	return &watcher{cli: cli, instance: instance, log: logger, watches: map[string]*watch{}}
+}
+
+// watch watches the container id, which carries the labels of the instance, until it
+// exits; the returned channel receives how. Containers are to be watched before they are
+// started, and unwatched once done with.
+func (w *watcher) watch(id string) <-chan exitStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt := &watch{done: make(chan exitStatus, 1)}
+	w.watches[id] = wt
+	if w.cancel == nil {
+		var ctx context.Context
+		ctx, w.cancel = context.WithCancel(context.Background())
+		go w.run(ctx, w.log.With(logging.Phase, "events"))
+	}
+	return wt.done
+}
+
+func (w *watcher) unwatch(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.watches, id)
+	if len(w.watches) == 0 && w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+}
+
+// sync updates the watch of container id from state, for containers that may have exited
+// before they were watched or while the subscription was down.
+func (w *watcher) sync(id string, state *types.ContainerState) {
+	if state == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt, ok := w.watches[id]
+	if !ok {
+		return
+	}
+	if state.Status == "exited" || state.Status == "dead" {
+		wt.exit(exitStatus{code: int64(state.ExitCode), oomKilled: state.OOMKilled})
+	}
+}
+
+func (w *watcher) removed(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wt, ok := w.watches[id]; ok {
+		wt.exit(exitStatus{err: errContainerRemoved})
+	}
+}
+
+// run subscribes to the events of the watched containers until ctx is done, subscribing
+// again with a backoff whenever the subscription fails.
+func (w *watcher) run(ctx context.Context, logger *logging.Logger) {
+	backoff := eventsMinBackoff
+	for {
+		msgs, errs := w.cli.Events(ctx, types.EventsOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("type", events.ContainerEventType),
+				filters.Arg("label", LabelInstance+"="+w.instance),
+				filters.Arg("event", "oom"),
+				filters.Arg("event", "die"),
+				filters.Arg("event", "destroy"),
+			),
+		})
+		if err := w.resync(ctx); err != nil && ctx.Err() == nil {
+			logger.Warn("failed to list watched containers", "error", err)
+		} else {
+			backoff = eventsMinBackoff
+		}
+		err := w.consume(ctx, logger, msgs, errs)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("lost Docker events subscription", "error", err, "backoff", backoff)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > eventsMaxBackoff {
+			backoff = eventsMaxBackoff
+		}
+	}
+}
+
+// consume handles the events of a subscription until it fails.
+func (w *watcher) consume(ctx context.Context, logger *logging.Logger, msgs <-chan events.Message, errs <-chan error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case m := <-msgs:
+			logger.Debug("container event", logging.ContainerID, m.Actor.ID, "action", m.Action)
+			w.handle(m)
+		}
+	}
+}
+
+func (w *watcher) handle(m events.Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt, ok := w.watches[m.Actor.ID]
+	if !ok {
+		return
+	}
+	switch m.Action {
+	case "oom":
+		// the daemon reports the kill before the exit
+		wt.oomKilled = true
+	case "die":
+		code, err := strconv.ParseInt(m.Actor.Attributes["exitCode"], 10, 64)
+		if err != nil {
+			wt.exit(exitStatus{err: fmt.Errorf("container died with an invalid exit code: %w", err)})
+			return
+		}
+		wt.exit(exitStatus{code: code, oomKilled: wt.oomKilled})
+	case "destroy":
+		wt.exit(exitStatus{err: errContainerRemoved})
+	}
+}
+
+// resync lists the containers of the instance and updates the watches from their state.
+// Only exited containers are inspected, for their exit codes.
+func (w *watcher) resync(ctx context.Context) error {
+	w.mu.Lock()
+	var ids []string
+	for id, wt := range w.watches {
+		if !wt.exited {
+			ids = append(ids, id)
+		}
+	}
+	w.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	list, err := w.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelInstance+"="+w.instance)),
+	})
+	if err != nil {
+		return err
+	}
+	states := make(map[string]string, len(list))
+	for _, c := range list {
+		states[c.ID] = c.State
+	}
+	for _, id := range ids {
+		state, ok := states[id]
+		if !ok {
+			w.removed(id)
+			continue
+		}
+		if state != "exited" && state != "dead" {
+			continue
+		}
+		if err := w.check(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check inspects the watched container id, for its exit code if it exited.
+func (w *watcher) check(ctx context.Context, id string) error {
+	inspect, err := w.cli.ContainerInspect(ctx, id)
+	switch {
+	case client.IsErrNotFound(err):
+		w.removed(id)
+	case err != nil:
+		return err
+	default:
+		w.sync(id, inspect.State)
+	}
+	return nil
+}
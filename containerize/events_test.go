@@ -0,0 +1,132 @@
+package containerize
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// newTestWatcher is a watcher of id without a subscription.
+func newTestWatcher(id string) (*watcher, <-chan exitStatus) {
+	w := &watcher{watches: map[string]*watch{}}
+	done := make(chan exitStatus, 1)
+	w.watches[id] = &watch{done: done}
+	return w, done
+}
+
+func event(id, action string, attributes map[string]string) events.Message {
+	return events.Message{Action: action, Actor: events.Actor{ID: id, Attributes: attributes}}
+}
+
+func TestWatcherHandle(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []events.Message
+		want   *exitStatus
+		err    bool
+	}{
+		{
+			name:   "exited",
+			events: []events.Message{event("c", "die", map[string]string{"exitCode": "3"})},
+			want:   &exitStatus{code: 3},
+		},
+		{
+			name: "killed for memory",
+			events: []events.Message{
+				event("c", "oom", nil),
+				event("c", "die", map[string]string{"exitCode": "137"}),
+			},
+			want: &exitStatus{code: 137, oomKilled: true},
+		},
+		{
+			name:   "removed",
+			events: []events.Message{event("c", "destroy", nil)},
+			err:    true,
+		},
+		{
+			name:   "invalid exit code",
+			events: []events.Message{event("c", "die", map[string]string{"exitCode": "x"})},
+			err:    true,
+		},
+		{
+			name: "only the first exit counts",
+			events: []events.Message{
+				event("c", "die", map[string]string{"exitCode": "0"}),
+				event("c", "destroy", nil),
+			},
+			want: &exitStatus{code: 0},
+		},
+		{
+			name:   "other containers",
+			events: []events.Message{event("other", "die", map[string]string{"exitCode": "1"})},
+		},
+		{
+			name:   "other events",
+			events: []events.Message{event("c", "start", nil), event("c", "oom", nil)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, done := newTestWatcher("c")
+			for _, m := range tt.events {
+				w.handle(m)
+			}
+			select {
+			case got := <-done:
+				switch {
+				case tt.err:
+					if got.err == nil {
+						t.Errorf("exit = %+v, want an error", got)
+					}
+				case tt.want == nil:
+					t.Errorf("exit = %+v, want none", got)
+				case got != *tt.want:
+					t.Errorf("exit = %+v, want %+v", got, *tt.want)
+				}
+			default:
+				if tt.want != nil || tt.err {
+					t.Error("no exit")
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherRemoved(t *testing.T) {
+	w, done := newTestWatcher("c")
+	w.removed("c")
+	if got := <-done; !errors.Is(got.err, errContainerRemoved) {
+		t.Errorf("exit = %+v, want errContainerRemoved", got)
+	}
+}
+
+func TestWatcherSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		state *types.ContainerState
+		want  *exitStatus
+	}{
+		{"running", &types.ContainerState{Status: "running"}, nil},
+		{"exited", &types.ContainerState{Status: "exited", ExitCode: 1}, &exitStatus{code: 1}},
+		{"dead", &types.ContainerState{Status: "dead", ExitCode: 137, OOMKilled: true}, &exitStatus{code: 137, oomKilled: true}},
+		{"unknown", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, done := newTestWatcher("c")
+			w.sync("c", tt.state)
+			select {
+			case got := <-done:
+				if tt.want == nil || got != *tt.want {
+					t.Errorf("exit = %+v, want %v", got, tt.want)
+				}
+			default:
+				if tt.want != nil {
+					t.Error("no exit")
+				}
+			}
+		})
+	}
+}
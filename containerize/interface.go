@@ -1,7 +1,32 @@
 package containerize
 
-import "context"
+import (
+	"context"
+	"io"
+
+	"github.com/nathanusask/docker-go-demo/runlog"
+)
 
 type Interface interface {
 	RunFactor(ctx context.Context, baseImage string, code string, factorNameLowercase string, paramArgs []string) error
+	// Logs writes the lines of the output of the last run of the named container selected
+	// by q to w, following it until the run ends if follow is set. The output is kept
+	// after the container is removed.
+	Logs(ctx context.Context, containerName string, q runlog.Query, follow bool, w io.Writer) error
+	// Stop stops the named container, which fails its run. The container is removed by the
+	// RunFactor or Attach attending to it; one of no run in flight is left for Remove.
+	Stop(ctx context.Context, containerName string) error
+	// Remove stops and removes the named container of a run no orchestrator attends to.
+	Remove(ctx context.Context, containerName string) error
+	// Containers lists the containers instance started, running or exited, see the labels.
+	Containers(ctx context.Context, instance string) ([]Container, error)
+	// Attach attends to the named container of a run whose orchestrator exited: it keeps
+	// the output in the run's log until the container exits, removes it and returns what
+	// RunFactor would have. The container is left running when ctx is done first.
+	Attach(ctx context.Context, containerName string) error
+	// BuildImage builds the image tag from the build context in dir.
+	BuildImage(ctx context.Context, dir string, tag string) error
+	// ImageDigest resolves image, the configured base image when empty, to an immutable
+	// reference that RunFactor accepts in its place.
+	ImageDigest(ctx context.Context, image string) (string, error)
 }
@@ -0,0 +1,51 @@
+package containerize
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/nathanusask/docker-go-demo/config"
+)
+
+// serviceAccountNamespace holds the namespace of the pod the orchestrator runs in.
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// NewKubeClient connects to the configured API server, or to the one of the cluster the
+// orchestrator runs in.
+func NewKubeClient(cfg config.Kubernetes) (k8s.Interface, error) {
+	restCfg := &rest.Config{Host: cfg.Host}
+	if cfg.Host == "" {
+		var err error
+		if restCfg, err = rest.InClusterConfig(); err != nil {
+			return nil, fmt.Errorf("kubernetes.host must be set outside of a cluster: %w", err)
+		}
+	}
+	// the token file is read again as it is rotated
+	if cfg.TokenFile != "" {
+		restCfg.BearerToken = ""
+		restCfg.BearerTokenFile = cfg.TokenFile
+	}
+	if cfg.CAFile != "" {
+		restCfg.TLSClientConfig.CAData = nil
+		restCfg.TLSClientConfig.CAFile = cfg.CAFile
+	}
+	return k8s.NewForConfig(restCfg)
+}
+
+// kubeNamespace is the configured namespace, or else the one of the pod the orchestrator
+// runs in, or else the default one.
+func kubeNamespace(cfg config.Kubernetes) string {
+	if cfg.Namespace != "" {
+		return cfg.Namespace
+	}
+	if b, err := os.ReadFile(serviceAccountNamespace); err == nil {
+		if ns := strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
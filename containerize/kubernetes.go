@@ -0,0 +1,578 @@
+package containerize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/secrets"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+const (
+	// kubeContainerName is the container running main.py in factor pods.
+	kubeContainerName = "factor"
+	// Keys of the ConfigMap and Secret of a run.
+	kubeMainKey        = "main.py"
+	kubeCredentialsKey = "mongo.json"
+	kubeUsernameKey    = "username"
+	kubePasswordKey    = "password"
+	// annotationContainerName is the container name of a run, which Kubernetes object
+	// names only approximate, see kubeName.
+	annotationContainerName = "factorctl.container-name"
+)
+
+// kubeWaitingFailures are the reasons of containers waiting for what does not come by
+// waiting longer.
+var kubeWaitingFailures = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// kubernetes runs factors as Kubernetes Jobs of a single pod, with main.py in a ConfigMap
+// and the MongoDB credentials in a Secret, all named after the container name. Kubernetes
+// merges the standard error of main.py into its output, so the run's log holds it as
+// standard output. Resource usage is not sampled.
+type kubernetes struct {
+	client    k8s.Interface
+	namespace string
+	cfg       config.Config
+	secrets   secrets.Provider
+	log       *logging.Logger
+}
+
+// RunFactor runs code in a Job of baseImage, or of the configured base image when
+// baseImage is empty, and waits for it to finish within the configured run timeout. The
+// Job is not retried by Kubernetes; failed attempts are retried by the pipeline.
+func (k *kubernetes) RunFactor(ctx context.Context, baseImage string, code string, factorNameLowercase string, paramArgs []string) (err error) {
+	requested := time.Now()
+	logger := k.log.Ctx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(k.cfg.Timeouts.Run))
+	defer cancel()
+	if baseImage == "" {
+		baseImage = k.cfg.Image.Base
+	}
+	ctx, span := tracing.Start(ctx, "RunFactor", "executor", config.ExecutorKubernetes, "container.name", factorNameLowercase, "image", baseImage)
+	defer func() { span.End(err) }()
+	name := kubeName(factorNameLowercase)
+	labels := runLabels(ctx, k.cfg.InstanceName())
+
+	_, prepareSpan := tracing.Start(ctx, "prepare")
+	pythonFilepath, err := writeMain(k.cfg.Workspace, factorNameLowercase, code)
+	if err != nil {
+		prepareSpan.End(err)
+		logger.Error("failed to write main.py", logging.Phase, "prepare", "error", err)
+		return err
+	}
+	defer importSpans(logger, pythonFilepath)
+	// objects of the name left by an orchestrator that exited mid-run would fail the
+	// creates below until removed by hand
+	if err := k.delete(ctx, name); err != nil {
+		prepareSpan.End(err)
+		logger.Error("failed to remove leftover job", logging.Phase, "prepare", "error", err)
+		return err
+	}
+	// the objects of the run are removed by hand rather than garbage collected, so they
+	// are also removed when the run times out
+	defer k.remove(logger, name)
+	_, err = k.client.CoreV1().ConfigMaps(k.namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Data:       map[string]string{kubeMainKey: code},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		prepareSpan.End(err)
+		logger.Error("failed to create config map", logging.Phase, "prepare", "error", err)
+		return err
+	}
+	hasCredentials, err := k.createSecret(ctx, name, labels)
+	prepareSpan.End(err)
+	if err != nil {
+		logger.Error("failed to inject credentials", logging.Phase, "prepare", "error", err)
+		return err
+	}
+
+	_, createSpan := tracing.Start(ctx, "create")
+	job, err := k.client.BatchV1().Jobs(k.namespace).Create(ctx, k.job(ctx, name, factorNameLowercase, labels, baseImage, paramArgs, hasCredentials), metav1.CreateOptions{})
+	createSpan.End(err)
+	if err != nil {
+		logger.Error("failed to create job", logging.Phase, "create", "image", baseImage, "error", err)
+		return err
+	}
+	span.SetAttributes("container.id", string(job.UID))
+	logger = logger.With(logging.ContainerID, string(job.UID))
+	logger.Info("created job", logging.Phase, "create", "image", baseImage, "name", name)
+
+	_, startSpan := tracing.Start(ctx, "start")
+	pod, err := k.started(ctx, name)
+	startSpan.End(err)
+	if err != nil {
+		logger.Error("failed to start pod", logging.Phase, "start", "error", err)
+		return err
+	}
+	logger.Info("started pod", logging.Phase, "start", "pod", pod, "queue_wait", time.Since(requested))
+	metrics.QueueWait.Since(requested, config.ExecutorKubernetes)
+	metrics.RunningContainers.Inc(config.ExecutorKubernetes)
+	defer metrics.RunningContainers.Dec(config.ExecutorKubernetes)
+
+	dir := path.Dir(pythonFilepath)
+	log, err := runlog.NewWriter(dir)
+	if err != nil {
+		logger.Error("failed to create run log", logging.Phase, "wait", "error", err)
+		return err
+	}
+	output := newRunOutput(os.Stdout, log, dir, logger)
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error("failed to write run log", logging.Phase, "wait", "error", err)
+		}
+	}()
+	waitCtx, waitSpan := tracing.Start(ctx, "wait")
+	err = k.wait(waitCtx, logger, name, pod, output, time.Time{})
+	waitSpan.End(err)
+	return err
+}
+
+// createSecret creates the Secret holding the MongoDB credentials, if there are any, and
+// reports whether it did.
+func (k *kubernetes) createSecret(ctx context.Context, name string, labels map[string]string) (bool, error) {
+	creds, err := secrets.Mongo(ctx, k.secrets)
+	if err != nil || creds.Empty() {
+		return false, err
+	}
+	b, err := json.Marshal(creds)
+	if err != nil {
+		return false, err
+	}
+	_, err = k.client.CoreV1().Secrets(k.namespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		StringData: map[string]string{
+			kubeCredentialsKey: string(b),
+			kubeUsernameKey:    creds.Username,
+			kubePasswordKey:    creds.Password,
+		},
+	}, metav1.CreateOptions{})
+	return err == nil, err
+}
+
+// job is the Job named name running main.py of the container containerName.
+func (k *kubernetes) job(ctx context.Context, name, containerName string, labels map[string]string, image string, paramArgs []string, hasCredentials bool) *batchv1.Job {
+	var env []corev1.EnvVar
+	for _, kv := range tracing.Env(ctx) {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			env = append(env, corev1.EnvVar{Name: kv[:i], Value: kv[i+1:]})
+		}
+	}
+	volumes := []corev1.Volume{{
+		Name:         "main",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}},
+	}}
+	mounts := []corev1.VolumeMount{{Name: "main", MountPath: dstPath, SubPath: kubeMainKey, ReadOnly: true}}
+
+	// like the workspace directory bound into Docker containers, but shared through a claim
+	work := corev1.Volume{Name: "work", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	workMount := corev1.VolumeMount{Name: "work", MountPath: workPath}
+	if k.cfg.Kubernetes.WorkspaceClaim != "" {
+		work.VolumeSource = corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: k.cfg.Kubernetes.WorkspaceClaim}}
+		workMount.SubPath = containerName
+	}
+	volumes = append(volumes, work)
+	mounts = append(mounts, workMount)
+
+	if hasCredentials {
+		if k.cfg.Secrets.Inject == config.InjectEnv {
+			env = append(env,
+				corev1.EnvVar{Name: secrets.MongoEnvUsername, ValueFrom: kubeSecretKey(name, kubeUsernameKey)},
+				corev1.EnvVar{Name: secrets.MongoEnvPassword, ValueFrom: kubeSecretKey(name, kubePasswordKey)},
+			)
+		} else {
+			volumes = append(volumes, corev1.Volume{Name: "credentials", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: name}}})
+			mounts = append(mounts, corev1.VolumeMount{Name: "credentials", MountPath: secrets.MongoMountPath, SubPath: kubeCredentialsKey, ReadOnly: true})
+		}
+	}
+
+	backoffLimit := int32(0)
+	deadline := int64(time.Duration(k.cfg.Timeouts.Run) / time.Second)
+	meta := metav1.ObjectMeta{
+		Name:        name,
+		Labels:      labels,
+		Annotations: map[string]string{annotationContainerName: containerName},
+	}
+	return &batchv1.Job{
+		ObjectMeta: meta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: meta.Annotations},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: k.cfg.Kubernetes.ServiceAccount,
+					Containers: []corev1.Container{{
+						Name:         kubeContainerName,
+						Image:        image,
+						Command:      append([]string{"python", dstPath}, paramArgs...),
+						WorkingDir:   workPath,
+						Env:          env,
+						Resources:    kubeResourceRequirements(k.cfg.Resources),
+						VolumeMounts: mounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+func kubeSecretKey(name, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name},
+		Key:                  key,
+	}}
+}
+
+// kubeResourceRequirements requests what the limits allow, so factor pods are only
+// scheduled where they can use all of it.
+func kubeResourceRequirements(r config.Resources) corev1.ResourceRequirements {
+	limits := corev1.ResourceList{}
+	if r.CPUs > 0 {
+		limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(r.CPUs*1000), resource.DecimalSI)
+	}
+	if r.MemoryMB > 0 {
+		limits[corev1.ResourceMemory] = *resource.NewQuantity(r.MemoryMB<<20, resource.BinarySI)
+	}
+	if len(limits) == 0 {
+		return corev1.ResourceRequirements{}
+	}
+	return corev1.ResourceRequirements{Limits: limits, Requests: limits.DeepCopy()}
+}
+
+// started waits for the pod of the Job name to run, or to have run, and returns its name.
+func (k *kubernetes) started(ctx context.Context, name string) (string, error) {
+	for {
+		job, err := k.client.BatchV1().Jobs(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", errContainerRemoved
+			}
+			return "", err
+		}
+		pods, err := k.pods(ctx, job)
+		if err != nil {
+			return "", err
+		}
+		for _, pod := range pods.Items {
+			for _, cs := range pod.Status.ContainerStatuses {
+				switch {
+				case cs.Name != kubeContainerName:
+				case cs.State.Running != nil, cs.State.Terminated != nil:
+					return pod.Name, nil
+				case cs.State.Waiting != nil && kubeWaitingFailures[cs.State.Waiting.Reason]:
+					return "", fmt.Errorf("pod %s: %s: %s", pod.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+				}
+			}
+		}
+		// the Job may fail before its pod starts, e.g. when it cannot be scheduled in time
+		if jobFailed(job) {
+			return "", jobError(job)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(k.cfg.Kubernetes.PollInterval)):
+		}
+	}
+}
+
+// wait copies the output of the started pod written since since, all of it when zero, to
+// output and waits for the Job name to finish. Losing the output, as when the API server
+// restarts, does not end the wait.
+func (k *kubernetes) wait(ctx context.Context, logger *logging.Logger, name, pod string, output *runOutput, since time.Time) error {
+	if err := k.copyOutput(ctx, logger, pod, output, since); err != nil && ctx.Err() == nil {
+		logger.Warn("waiting for job to finish without its output", logging.Phase, "wait")
+	}
+
+	for {
+		job, err := k.client.BatchV1().Jobs(k.namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case ctx.Err() != nil:
+			logger.Error("job did not finish", logging.Phase, "wait", "error", ctx.Err())
+			return ctx.Err()
+		case apierrors.IsNotFound(err):
+			logger.Error("failed to wait for job to finish", logging.Phase, "wait", "error", errContainerRemoved)
+			return errContainerRemoved
+		case err != nil:
+			logger.Warn("failed to get job status", logging.Phase, "wait", "error", err)
+		case job.Status.Succeeded > 0:
+			logger.Info("job finished", logging.Phase, "wait", "status", 0)
+			return nil
+		case jobFailed(job):
+			return k.failure(ctx, logger, job)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(k.cfg.Kubernetes.PollInterval)):
+		}
+	}
+}
+
+// failure is the error of the failed job: an ExitError when main.py exited.
+func (k *kubernetes) failure(ctx context.Context, logger *logging.Logger, job *batchv1.Job) error {
+	pods, err := k.pods(ctx, job)
+	if err != nil {
+		logger.Error("failed to list pods", logging.Phase, "wait", "error", err)
+		pods = &corev1.PodList{}
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != kubeContainerName || cs.State.Terminated == nil || cs.State.Terminated.ExitCode == 0 {
+				continue
+			}
+			exitErr := &ExitError{Code: int64(cs.State.Terminated.ExitCode), OOMKilled: cs.State.Terminated.Reason == "OOMKilled"}
+			logger.Error("container failed", logging.Phase, "wait", "status", exitErr.Code, "oom_killed", exitErr.OOMKilled)
+			return exitErr
+		}
+	}
+	err = jobError(job)
+	logger.Error("job failed", logging.Phase, "wait", "error", err)
+	return err
+}
+
+// pods lists the pods of job. They are selected by the UID of the Job rather than its
+// name, which the pods of a deleted Job of the same name, still terminating, share.
+func (k *kubernetes) pods(ctx context.Context, job *batchv1.Job) (*corev1.PodList, error) {
+	selector := "controller-uid=" + string(job.UID)
+	return k.client.CoreV1().Pods(k.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+}
+
+func jobFailed(job *batchv1.Job) bool {
+	if job.Status.Failed > 0 {
+		return true
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// jobError is the error of a Job that failed without an exit status of main.py. A Job
+// exceeding its deadline, the run timeout, times out like runs of other executors.
+func jobError(job *batchv1.Job) error {
+	for _, c := range job.Status.Conditions {
+		if c.Type != batchv1.JobFailed || c.Status != corev1.ConditionTrue {
+			continue
+		}
+		if c.Reason == "DeadlineExceeded" {
+			return context.DeadlineExceeded
+		}
+		return fmt.Errorf("job failed: %s: %s", c.Reason, c.Message)
+	}
+	return errors.New("job failed")
+}
+
+// copyOutput copies the output of the pod since since to output until its container exits.
+func (k *kubernetes) copyOutput(ctx context.Context, logger *logging.Logger, pod string, output *runOutput, since time.Time) error {
+	opts := &corev1.PodLogOptions{Container: kubeContainerName, Follow: true}
+	if !since.IsZero() {
+		opts.SinceTime = &metav1.Time{Time: since}
+	}
+	body, err := k.client.CoreV1().Pods(k.namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		logger.Error("failed to get pod logs", logging.Phase, "wait", "error", err)
+		return err
+	}
+	defer body.Close()
+	if _, err := io.Copy(output.Stdout(), body); err != nil {
+		logger.Error("failed to copy pod output", logging.Phase, "wait", "error", err)
+		return err
+	}
+	return nil
+}
+
+// remove deletes the Job, its pod, ConfigMap and Secret.
+func (k *kubernetes) remove(logger *logging.Logger, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := k.delete(ctx, name); err != nil {
+		logger.Error("failed to remove job", logging.Phase, "remove", "error", err)
+	}
+}
+
+// delete deletes the Job name and, in the background, its pod, then its ConfigMap and
+// Secret. Objects that do not exist count as deleted.
+func (k *kubernetes) delete(ctx context.Context, name string) error {
+	background := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &background}
+	for _, del := range []func(context.Context, string, metav1.DeleteOptions) error{
+		k.client.BatchV1().Jobs(k.namespace).Delete,
+		k.client.CoreV1().ConfigMaps(k.namespace).Delete,
+		k.client.CoreV1().Secrets(k.namespace).Delete,
+	} {
+		if err := del(ctx, name, opts); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Logs reads the log the run kept in its workspace and follows it while the Job exists.
+func (k *kubernetes) Logs(ctx context.Context, containerName string, q runlog.Query, follow bool, w io.Writer) error {
+	running := func() bool {
+		_, err := k.client.BatchV1().Jobs(k.namespace).Get(ctx, kubeName(containerName), metav1.GetOptions{})
+		return err == nil
+	}
+	if err := copyLog(ctx, path.Join(k.cfg.Workspace, containerName), q, follow, running, w); err != nil {
+		k.log.Ctx(ctx).Error("failed to read run log", logging.Phase, "logs", "container", containerName, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Stop deletes the Job, which kills its pod.
+func (k *kubernetes) Stop(ctx context.Context, containerName string) error {
+	background := metav1.DeletePropagationBackground
+	err := k.client.BatchV1().Jobs(k.namespace).Delete(ctx, kubeName(containerName), metav1.DeleteOptions{PropagationPolicy: &background})
+	if err != nil && !apierrors.IsNotFound(err) {
+		k.log.Ctx(ctx).Error("failed to stop job", logging.Phase, "stop", "container", containerName, "error", err)
+		return err
+	}
+	k.log.Ctx(ctx).Info("stopped job", logging.Phase, "stop", "container", containerName)
+	return nil
+}
+
+func (k *kubernetes) Remove(ctx context.Context, containerName string) error {
+	if err := k.delete(ctx, kubeName(containerName)); err != nil {
+		k.log.Ctx(ctx).Error("failed to remove job", logging.Phase, "remove", "container", containerName, "error", err)
+		return err
+	}
+	k.log.Ctx(ctx).Info("removed job", logging.Phase, "remove", "container", containerName)
+	return nil
+}
+
+// Containers lists the Jobs of instance in the namespace.
+func (k *kubernetes) Containers(ctx context.Context, instance string) ([]Container, error) {
+	jobs, err := k.client.BatchV1().Jobs(k.namespace).List(ctx, metav1.ListOptions{LabelSelector: LabelInstance + "=" + instance})
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		c := Container{
+			ID:      string(job.UID),
+			Name:    job.Annotations[annotationContainerName],
+			Running: job.Status.Active > 0,
+			Created: job.CreationTimestamp.Time,
+		}
+		if c.Name == "" {
+			c.Name = job.Name
+		}
+		containers = append(containers, containerFromLabels(c, job.Labels))
+	}
+	return containers, nil
+}
+
+// Attach continues the run's log where the orchestrator that started the Job left it.
+// Output the pod wrote in the second before that orchestrator exited may be repeated.
+func (k *kubernetes) Attach(ctx context.Context, containerName string) (err error) {
+	name := kubeName(containerName)
+	logger := k.log.Ctx(ctx).With("container", containerName)
+	ctx, span := tracing.Start(ctx, "Attach", "executor", config.ExecutorKubernetes, "container.name", containerName)
+	defer func() { span.End(err) }()
+
+	pod, err := k.started(ctx, name)
+	if err != nil {
+		logger.Error("failed to find pod", logging.Phase, "attach", "error", err)
+		return err
+	}
+	dir := path.Join(k.cfg.Workspace, containerName)
+	log, last, err := runlog.OpenWriter(dir)
+	if err != nil {
+		logger.Error("failed to open run log", logging.Phase, "attach", "error", err)
+		return err
+	}
+	output := newRunOutput(io.Discard, log, dir, logger)
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error("failed to write run log", logging.Phase, "attach", "error", err)
+		}
+	}()
+
+	logger.Info("attached to job", logging.Phase, "attach", "pod", pod)
+	err = k.wait(ctx, logger, name, pod, output, last)
+	// a Job is left running when the orchestrator stops attending to it
+	if ctx.Err() == nil {
+		k.remove(logger, name)
+	}
+	return err
+}
+
+// BuildImage is not supported: images are built with the docker executor and pushed to a
+// registry the cluster pulls from.
+func (k *kubernetes) BuildImage(_ context.Context, _ string, tag string) error {
+	return fmt.Errorf("the kubernetes executor does not build images; build %s with the docker executor and push it", tag)
+}
+
+// ImageDigest returns image as is, as resolving it would take the registry; runs record
+// the tag they ran.
+func (k *kubernetes) ImageDigest(_ context.Context, image string) (string, error) {
+	if image == "" {
+		image = k.cfg.Image.Base
+	}
+	return image, nil
+}
+
+// kubeName turns a container name into the name of Kubernetes objects: at most 63
+// lowercase letters, digits and dashes. Names it has to change get a hash of the
+// original, so different container names stay apart.
+func kubeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	s := strings.Trim(b.String(), "-")
+	if s != "" && s == name && len(s) <= 63 {
+		return s
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(sum[:4])
+	if len(s) > 63-len(suffix)-1 {
+		s = strings.TrimRight(s[:63-len(suffix)-1], "-")
+	}
+	if s == "" {
+		return "factor-" + suffix
+	}
+	return s + "-" + suffix
+}
+
+// NewKubernetes returns the executor running factors as Kubernetes Jobs in the configured
+// namespace.
+func NewKubernetes(c k8s.Interface, cfg config.Config, secrets secrets.Provider, logger *logging.Logger) Interface {
+	return &kubernetes{client: c, namespace: kubeNamespace(cfg.Kubernetes), cfg: cfg, secrets: secrets, log: logger}
+}
@@ -0,0 +1,456 @@
+package containerize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/secrets"
+)
+
+const testNamespace = "factors"
+
+// fakeSecrets resolves the secrets it holds.
+type fakeSecrets map[string]string
+
+func (s fakeSecrets) Get(_ context.Context, name string) (string, error) {
+	v, ok := s[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", secrets.ErrNotFound, name)
+	}
+	return v, nil
+}
+
+func testKubeConfig(t *testing.T) config.Config {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.Instance = "host-a"
+	cfg.Image.Base = "python:3.10"
+	cfg.Kubernetes.Namespace = testNamespace
+	cfg.Kubernetes.PollInterval = config.Duration(time.Millisecond)
+	return cfg
+}
+
+func newTestKubernetes(cs *fake.Clientset, cfg config.Config, creds fakeSecrets) *kubernetes {
+	return NewKubernetes(cs, cfg, creds, logging.New(io.Discard, "text", logging.LevelInfo)).(*kubernetes)
+}
+
+// runJobsAs has the Jobs created with cs end as status says, with a pod whose factor
+// container is in state.
+func runJobsAs(cs *fake.Clientset, status batchv1.JobStatus, state corev1.ContainerState) {
+	cs.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.UID = types.UID("uid-" + job.Name)
+		job.Status = status
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-x1y2z", Namespace: action.GetNamespace(), Labels: map[string]string{"controller-uid": string(job.UID)}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: kubeContainerName, State: state}}},
+		}
+		// the Job itself is created by the next reactor
+		return false, nil, cs.Tracker().Add(pod)
+	})
+}
+
+var (
+	succeeded  = batchv1.JobStatus{Succeeded: 1}
+	terminated = func(code int32, reason string) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code, Reason: reason}}
+	}
+)
+
+// created returns the object of kind cs was asked to create named name.
+func created(t *testing.T, cs *fake.Clientset, resource string) runtime.Object {
+	t.Helper()
+	for _, action := range cs.Actions() {
+		if create, ok := action.(k8stesting.CreateAction); ok && action.GetResource().Resource == resource {
+			if action.GetNamespace() != testNamespace {
+				t.Errorf("%s created in namespace %q", resource, action.GetNamespace())
+			}
+			return create.GetObject()
+		}
+	}
+	return nil
+}
+
+// assertRemoved checks that no object of the run is left.
+func assertRemoved(t *testing.T, cs *fake.Clientset) {
+	t.Helper()
+	ctx := context.Background()
+	jobs, _ := cs.BatchV1().Jobs(testNamespace).List(ctx, metav1.ListOptions{})
+	configMaps, _ := cs.CoreV1().ConfigMaps(testNamespace).List(ctx, metav1.ListOptions{})
+	secrets, _ := cs.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+	if n := len(jobs.Items) + len(configMaps.Items) + len(secrets.Items); n > 0 {
+		t.Errorf("%d jobs, %d config maps and %d secrets left", len(jobs.Items), len(configMaps.Items), len(secrets.Items))
+	}
+}
+
+func TestKubernetesRunFactor(t *testing.T) {
+	for _, inject := range []string{config.InjectFile, config.InjectEnv} {
+		t.Run(inject, func(t *testing.T) {
+			cfg := testKubeConfig(t)
+			cfg.Secrets.Inject = inject
+			cfg.Kubernetes.ServiceAccount = "factor-runner"
+			cfg.Kubernetes.WorkspaceClaim = "workspace"
+			cs := fake.NewSimpleClientset()
+			runJobsAs(cs, succeeded, terminated(0, "Completed"))
+			k := newTestKubernetes(cs, cfg, fakeSecrets{"mongo_username": "u", "mongo_password": "p"})
+
+			ctx := WithRunID(context.Background(), "run-1")
+			if err := k.RunFactor(ctx, "", "print('hi')", "run-1-macd", []string{"--fast", "12"}); err != nil {
+				t.Fatalf("RunFactor() error = %v", err)
+			}
+
+			configMap := created(t, cs, "configmaps").(*corev1.ConfigMap)
+			if configMap.Name != "run-1-macd" || configMap.Data[kubeMainKey] != "print('hi')" {
+				t.Errorf("config map = %s %v", configMap.Name, configMap.Data)
+			}
+			if configMap.Labels[LabelRunID] != "run-1" || configMap.Labels[LabelInstance] != "host-a" || configMap.Labels[LabelBootID] != BootID() {
+				t.Errorf("config map labels = %v", configMap.Labels)
+			}
+			secret := created(t, cs, "secrets").(*corev1.Secret)
+			if secret.StringData[kubeUsernameKey] != "u" || secret.StringData[kubePasswordKey] != "p" ||
+				secret.StringData[kubeCredentialsKey] != `{"username":"u","password":"p"}` {
+				t.Errorf("secret = %v", secret.StringData)
+			}
+
+			job := created(t, cs, "jobs").(*batchv1.Job)
+			if job.Annotations[annotationContainerName] != "run-1-macd" {
+				t.Errorf("job annotations = %v", job.Annotations)
+			}
+			if *job.Spec.BackoffLimit != 0 || *job.Spec.ActiveDeadlineSeconds != int64(time.Hour/time.Second) {
+				t.Errorf("job backoff limit %d, deadline %d", *job.Spec.BackoffLimit, *job.Spec.ActiveDeadlineSeconds)
+			}
+			pod := job.Spec.Template.Spec
+			if pod.RestartPolicy != corev1.RestartPolicyNever || pod.ServiceAccountName != "factor-runner" {
+				t.Errorf("pod restart policy %s, service account %s", pod.RestartPolicy, pod.ServiceAccountName)
+			}
+			if job.Spec.Template.Labels[LabelRunID] != "run-1" {
+				t.Errorf("pod labels = %v", job.Spec.Template.Labels)
+			}
+			c := pod.Containers[0]
+			if c.Name != kubeContainerName || c.Image != "python:3.10" || c.WorkingDir != workPath ||
+				strings.Join(c.Command, " ") != "python "+dstPath+" --fast 12" {
+				t.Errorf("container = %s %s %s %v", c.Name, c.Image, c.WorkingDir, c.Command)
+			}
+
+			volumes := map[string]corev1.Volume{}
+			for _, v := range pod.Volumes {
+				volumes[v.Name] = v
+			}
+			mounts := map[string]corev1.VolumeMount{}
+			for _, m := range c.VolumeMounts {
+				mounts[m.Name] = m
+			}
+			if v := volumes["main"]; v.ConfigMap == nil || v.ConfigMap.Name != "run-1-macd" || mounts["main"].MountPath != dstPath || mounts["main"].SubPath != kubeMainKey {
+				t.Errorf("main.py volume %+v mounted as %+v", v, mounts["main"])
+			}
+			if v := volumes["work"]; v.PersistentVolumeClaim == nil || v.PersistentVolumeClaim.ClaimName != "workspace" || mounts["work"].SubPath != "run-1-macd" {
+				t.Errorf("work volume %+v mounted as %+v", v, mounts["work"])
+			}
+			env := map[string]corev1.EnvVar{}
+			for _, e := range c.Env {
+				env[e.Name] = e
+			}
+			switch inject {
+			case config.InjectFile:
+				if v := volumes["credentials"]; v.Secret == nil || v.Secret.SecretName != "run-1-macd" ||
+					mounts["credentials"].MountPath != secrets.MongoMountPath || mounts["credentials"].SubPath != kubeCredentialsKey {
+					t.Errorf("credentials volume %+v mounted as %+v", v, mounts["credentials"])
+				}
+				if _, ok := env[secrets.MongoEnvUsername]; ok {
+					t.Error("credentials injected as environment variables too")
+				}
+			case config.InjectEnv:
+				for name, key := range map[string]string{secrets.MongoEnvUsername: kubeUsernameKey, secrets.MongoEnvPassword: kubePasswordKey} {
+					ref := env[name].ValueFrom
+					if ref == nil || ref.SecretKeyRef == nil || ref.SecretKeyRef.Name != "run-1-macd" || ref.SecretKeyRef.Key != key {
+						t.Errorf("%s = %+v", name, env[name])
+					}
+				}
+				if _, ok := volumes["credentials"]; ok {
+					t.Error("credentials mounted too")
+				}
+			}
+
+			lines, err := runlog.Read(filepath.Join(cfg.Workspace, "run-1-macd"), runlog.Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the fake clientset streams "fake logs" for every pod
+			if len(lines) != 1 || lines[0].Text != "fake logs" {
+				t.Errorf("run log = %+v", lines)
+			}
+			assertRemoved(t, cs)
+		})
+	}
+}
+
+func TestKubernetesRunFactorWithoutCredentials(t *testing.T) {
+	cfg := testKubeConfig(t)
+	cs := fake.NewSimpleClientset()
+	runJobsAs(cs, succeeded, terminated(0, "Completed"))
+	k := newTestKubernetes(cs, cfg, fakeSecrets{})
+	if err := k.RunFactor(context.Background(), "factor-image:1", "", "macd", nil); err != nil {
+		t.Fatalf("RunFactor() error = %v", err)
+	}
+	if created(t, cs, "secrets") != nil {
+		t.Error("secret created without credentials")
+	}
+	job := created(t, cs, "jobs").(*batchv1.Job)
+	if img := job.Spec.Template.Spec.Containers[0].Image; img != "factor-image:1" {
+		t.Errorf("image = %s", img)
+	}
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.Name == "work" && v.EmptyDir == nil {
+			t.Errorf("work volume without a claim = %+v", v)
+		}
+	}
+}
+
+func TestKubernetesRunFactorStatus(t *testing.T) {
+	failed := func(reason string) batchv1.JobStatus {
+		return batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: reason, Message: reason + " happened"}}}
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	tests := []struct {
+		name   string
+		status batchv1.JobStatus
+		state  corev1.ContainerState
+		check  func(error) bool
+	}{
+		{"succeeded", succeeded, terminated(0, "Completed"), func(err error) bool { return err == nil }},
+		{"exited", failed("BackoffLimitExceeded"), terminated(3, "Error"), func(err error) bool {
+			var exitErr *ExitError
+			return errors.As(err, &exitErr) && exitErr.Code == 3 && !exitErr.OOMKilled
+		}},
+		{"killed for memory", failed("BackoffLimitExceeded"), terminated(137, "OOMKilled"), func(err error) bool {
+			var exitErr *ExitError
+			return errors.As(err, &exitErr) && exitErr.Code == 137 && exitErr.OOMKilled
+		}},
+		{"deadline exceeded", failed("DeadlineExceeded"), running, func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+		{"failed without exiting", failed("PodFailurePolicy"), running, func(err error) bool {
+			var exitErr *ExitError
+			return err != nil && !errors.As(err, &exitErr) && strings.Contains(err.Error(), "PodFailurePolicy")
+		}},
+		{"image not pulled", batchv1.JobStatus{Active: 1}, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "not found"}}, func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "ErrImagePull")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset()
+			runJobsAs(cs, tt.status, tt.state)
+			k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{})
+			if err := k.RunFactor(context.Background(), "", "", "macd", nil); !tt.check(err) {
+				t.Errorf("RunFactor() error = %v", err)
+			}
+			assertRemoved(t, cs)
+		})
+	}
+}
+
+func TestKubernetesRunFactorRemovesLeftovers(t *testing.T) {
+	// the objects of an orchestrator that exited while running macd
+	meta := metav1.ObjectMeta{Name: "macd", Namespace: testNamespace}
+	cs := fake.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: meta},
+		&corev1.ConfigMap{ObjectMeta: meta},
+		&corev1.Secret{ObjectMeta: meta},
+	)
+	runJobsAs(cs, succeeded, terminated(0, "Completed"))
+	k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{"mongo_username": "u"})
+	if err := k.RunFactor(context.Background(), "", "", "macd", nil); err != nil {
+		t.Fatalf("RunFactor() error = %v", err)
+	}
+	assertRemoved(t, cs)
+}
+
+func TestKubernetesRunFactorIgnoresPodsOfDeletedJobs(t *testing.T) {
+	// the pod of a leftover Job of the same name, terminating after its Job was deleted
+	cs := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "macd-a1b2c", Namespace: testNamespace, Labels: map[string]string{"controller-uid": "uid-old", "job-name": "macd"}},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: kubeContainerName, State: terminated(1, "Error")}}},
+	})
+	// the new Job times out before its pod is scheduled
+	cs.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.UID = "uid-new"
+		job.Status = batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}}
+		return false, nil, nil
+	})
+	k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{})
+	if err := k.RunFactor(context.Background(), "", "", "macd", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunFactor() error = %v, want the deadline of the new job", err)
+	}
+}
+
+func TestKubernetesRunFactorRemovesOnFailedCreate(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "jobs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("admission denied")
+	})
+	k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{"mongo_username": "u"})
+	if err := k.RunFactor(context.Background(), "", "", "macd", nil); err == nil {
+		t.Fatal("RunFactor() error = nil")
+	}
+	assertRemoved(t, cs)
+}
+
+func TestKubeResourceRequirements(t *testing.T) {
+	tests := []struct {
+		resources   config.Resources
+		cpu, memory string
+	}{
+		{config.Resources{}, "", ""},
+		{config.Resources{CPUs: 1.5, MemoryMB: 512}, "1500m", "512Mi"},
+		{config.Resources{CPUs: 2}, "2", ""},
+		{config.Resources{MemoryMB: 2048}, "", "2Gi"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%+v", tt.resources), func(t *testing.T) {
+			r := kubeResourceRequirements(tt.resources)
+			for _, list := range []corev1.ResourceList{r.Limits, r.Requests} {
+				cpu, memory := list[corev1.ResourceCPU], list[corev1.ResourceMemory]
+				if got := quantityString(cpu.String(), list, corev1.ResourceCPU); got != tt.cpu {
+					t.Errorf("cpu = %q, want %q", got, tt.cpu)
+				}
+				if got := quantityString(memory.String(), list, corev1.ResourceMemory); got != tt.memory {
+					t.Errorf("memory = %q, want %q", got, tt.memory)
+				}
+			}
+		})
+	}
+}
+
+// quantityString is s, or empty when list lacks name.
+func quantityString(s string, list corev1.ResourceList, name corev1.ResourceName) string {
+	if _, ok := list[name]; !ok {
+		return ""
+	}
+	return s
+}
+
+func TestKubernetesContainers(t *testing.T) {
+	created := metav1.NewTime(time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC))
+	cs := fake.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "run-1-macd", Namespace: testNamespace, UID: "uid-1", CreationTimestamp: created,
+				Labels:      map[string]string{LabelInstance: "host-a", LabelRunID: "run-1", LabelBootID: "boot-1"},
+				Annotations: map[string]string{annotationContainerName: "run-1-MACD"},
+			},
+			Status: batchv1.JobStatus{Active: 1},
+		},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: testNamespace, Labels: map[string]string{LabelInstance: "host-b"}}},
+	)
+	k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{})
+	containers, err := k.Containers(context.Background(), "host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Container{ID: "uid-1", Name: "run-1-MACD", RunID: "run-1", Instance: "host-a", BootID: "boot-1", Running: true, Created: created.Time}
+	if len(containers) != 1 || containers[0] != want {
+		t.Errorf("Containers() = %+v, want %+v", containers, want)
+	}
+}
+
+func TestKubernetesStopAndRemove(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "macd", Namespace: testNamespace}
+	cs := fake.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: meta},
+		&corev1.ConfigMap{ObjectMeta: meta},
+	)
+	k := newTestKubernetes(cs, testKubeConfig(t), fakeSecrets{})
+	ctx := context.Background()
+	if err := k.Stop(ctx, "macd"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if _, err := cs.BatchV1().Jobs(testNamespace).Get(ctx, "macd", metav1.GetOptions{}); err == nil {
+		t.Error("job left after Stop()")
+	}
+	if err := k.Remove(ctx, "macd"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	assertRemoved(t, cs)
+	// removing what is gone already succeeds
+	if err := k.Remove(ctx, "macd"); err != nil {
+		t.Errorf("Remove() of a removed job error = %v", err)
+	}
+}
+
+func TestKubernetesAttach(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "macd", Namespace: testNamespace}
+	cs := fake.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "macd", Namespace: testNamespace, UID: "uid-macd"}, Status: batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"},
+		}}},
+		&corev1.ConfigMap{ObjectMeta: meta},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "macd-x1y2z", Namespace: testNamespace, Labels: map[string]string{"controller-uid": "uid-macd"}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: kubeContainerName, State: terminated(2, "Error")}}},
+		},
+	)
+	cfg := testKubeConfig(t)
+	// the run log of the orchestrator that started the job
+	dir := filepath.Join(cfg.Workspace, "macd")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log, err := runlog.NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	k := newTestKubernetes(cs, cfg, fakeSecrets{})
+	var exitErr *ExitError
+	if err := k.Attach(context.Background(), "macd"); !errors.As(err, &exitErr) || exitErr.Code != 2 {
+		t.Errorf("Attach() error = %v, want exit status 2", err)
+	}
+	assertRemoved(t, cs)
+}
+
+func TestKubeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"run-1-macd", "run-1-macd"},
+		{"run-1-MACD", "run-1-macd-"},
+		{"run_1.macd", "run-1-macd-"},
+		{"", "factor-"},
+		{"___", "factor-"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 54) + "-"},
+	}
+	seen := map[string]string{}
+	for _, tt := range tests {
+		got := kubeName(tt.name)
+		if !strings.HasPrefix(got, tt.want) || len(got) > 63 || (got != tt.want) == (tt.want == tt.name && tt.name != "") {
+			t.Errorf("kubeName(%q) = %q, want %q with a hash suffix unless unchanged", tt.name, got, tt.want)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("kubeName(%q) = kubeName(%q) = %q", tt.name, other, got)
+		}
+		seen[got] = tt.name
+	}
+}
@@ -0,0 +1,65 @@
+package containerize
+
+import (
+	"context"
+	"time"
+)
+
+// Labels of factor containers, which identify what they belong to after the orchestrator
+// that started them exited.
+const (
+	LabelRunID    = "factorctl.run-id"
+	LabelInstance = "factorctl.instance"
+	// LabelBootID is the BootID of the orchestrator, which owns the container while it lives.
+	LabelBootID = "factorctl.boot-id"
+)
+
+// Container is a factor container, or the process of the local executor.
+type Container struct {
+	ID   string
+	Name string
+	// RunID is empty for containers started outside of a run.
+	RunID    string
+	Instance string
+	// BootID is the BootID of the orchestrator that started the container.
+	BootID  string
+	Running bool
+	Created time.Time
+}
+
+type runIDKey struct{}
+
+// WithRunID returns a context labelling the containers started with it with runID.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// RunID is the run ID ctx labels containers with, empty if none.
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// labels are the labels of a container started with ctx.
+func (s server) labels(ctx context.Context) map[string]string {
+	return runLabels(ctx, s.cfg.InstanceName())
+}
+
+func runLabels(ctx context.Context, instance string) map[string]string {
+	labels := map[string]string{
+		LabelInstance: instance,
+		LabelBootID:   BootID(),
+	}
+	if id := RunID(ctx); id != "" {
+		labels[LabelRunID] = id
+	}
+	return labels
+}
+
+// containerFromLabels fills in what labels tell about c.
+func containerFromLabels(c Container, labels map[string]string) Container {
+	c.RunID = labels[LabelRunID]
+	c.Instance = labels[LabelInstance]
+	c.BootID = labels[LabelBootID]
+	return c
+}
@@ -0,0 +1,411 @@
+package containerize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/secrets"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+const (
+	localPidFilename    = "pid"
+	localLabelsFilename = "labels.json"
+)
+
+// local runs main.py with a host Python interpreter in a virtualenv instead of a container.
+// Its workspace layout doubles as the state shared with other processes: the run's log
+// holds the output, and <name>/pid, identifying the process, and the container labels in
+// <name>/labels.json exist while the factor runs.
+type local struct {
+	cfg     config.Config
+	secrets secrets.Provider
+	log     *logging.Logger
+
+	// mu serializes virtualenv creation
+	mu sync.Mutex
+}
+
+func (l *local) RunFactor(ctx context.Context, baseImage string, code string, factorNameLowercase string, paramArgs []string) (err error) {
+	requested := time.Now()
+	logger := l.log.Ctx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(l.cfg.Timeouts.Run))
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "RunFactor", "executor", config.ExecutorLocal, "container.name", factorNameLowercase)
+	defer func() { span.End(err) }()
+
+	_, prepareSpan := tracing.Start(ctx, "prepare")
+	cmd, output, err := l.prepare(ctx, logger, baseImage, code, factorNameLowercase, paramArgs)
+	prepareSpan.End(err)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error("failed to write run log", logging.Phase, "wait", "error", err)
+		}
+	}()
+	defer importSpans(logger, path.Join(cmd.Dir, pythonMainFilename))
+	cmd.Stdout = output.Stdout()
+	cmd.Stderr = output.Stderr()
+
+	_, startSpan := tracing.Start(ctx, "start")
+	err = cmd.Start()
+	startSpan.End(err)
+	if err != nil {
+		logger.Error("failed to start python", logging.Phase, "start", "error", err)
+		return err
+	}
+	metrics.QueueWait.Since(requested, config.ExecutorLocal)
+	metrics.RunningContainers.Inc(config.ExecutorLocal)
+	defer metrics.RunningContainers.Dec(config.ExecutorLocal)
+	if err := writeProcessState(cmd.Dir, newProcess(cmd.Process.Pid), runLabels(ctx, l.cfg.InstanceName())); err != nil {
+		logger.Error("failed to write pid file", logging.Phase, "start", "error", err)
+	}
+	defer removeProcessState(cmd.Dir)
+	span.SetAttributes("process.pid", cmd.Process.Pid)
+	logger = logger.With(logging.ContainerID, "pid:"+strconv.Itoa(cmd.Process.Pid))
+	logger.Info("started process", logging.Phase, "start", "queue_wait", time.Since(requested))
+
+	_, waitSpan := tracing.Start(ctx, "wait")
+	err = l.wait(ctx, logger, cmd)
+	waitSpan.End(err)
+	return err
+}
+
+// prepare writes main.py and returns the command running it in the virtualenv standing in
+// for image, together with the output it writes to.
+func (l *local) prepare(ctx context.Context, logger *logging.Logger, image string, code string, factorNameLowercase string, paramArgs []string) (*exec.Cmd, *runOutput, error) {
+	pythonFilepath, err := writeMain(l.cfg.Workspace, factorNameLowercase, code)
+	if err != nil {
+		logger.Error("failed to write main.py", logging.Phase, "prepare", "error", err)
+		return nil, nil, err
+	}
+	python, err := l.venv(ctx, logger, l.requirements(image))
+	if err != nil {
+		logger.Error("failed to prepare virtualenv", logging.Phase, "prepare", "error", err)
+		return nil, nil, err
+	}
+	env := os.Environ()
+	creds, err := secrets.Mongo(ctx, l.secrets)
+	if err != nil {
+		logger.Error("failed to inject credentials", logging.Phase, "prepare", "error", err)
+		return nil, nil, err
+	}
+	if !creds.Empty() {
+		env = append(env, secrets.MongoEnvUsername+"="+creds.Username, secrets.MongoEnvPassword+"="+creds.Password)
+	}
+	env = append(env, tracing.Env(ctx)...)
+
+	workdir := path.Dir(pythonFilepath)
+	log, err := runlog.NewWriter(workdir)
+	if err != nil {
+		logger.Error("failed to create run log", logging.Phase, "prepare", "error", err)
+		return nil, nil, err
+	}
+	output := newRunOutput(os.Stdout, log, workdir, logger)
+
+	// the container sees main.py as /app/main.py and reaches MongoDB through an extra host,
+	// here main.py stays in the workspace and the host is overridden
+	args := append([]string{pythonMainFilename}, paramArgs...)
+	args = append(args, "--host", l.cfg.Local.MongoHost)
+	cmd := exec.CommandContext(ctx, python, args...)
+	cmd.Dir = workdir
+	cmd.Env = env
+	return cmd, output, nil
+}
+
+func (l *local) wait(ctx context.Context, logger *logging.Logger, cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if err := writeResourceUsage(cmd.Dir, processUsage(cmd.ProcessState)); err != nil {
+		logger.Error("failed to write resource usage", logging.Phase, "wait", "error", err)
+	}
+	if ctx.Err() != nil {
+		logger.Error("process did not finish", logging.Phase, "wait", "error", ctx.Err())
+		return ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		logger.Error("process failed", logging.Phase, "wait", "status", exitErr.ExitCode())
+		return &ExitError{Code: int64(exitErr.ExitCode())}
+	}
+	if err != nil {
+		logger.Error("failed to wait for process to finish", logging.Phase, "wait", "error", err)
+		return err
+	}
+	logger.Info("process finished", logging.Phase, "wait", "status", 0)
+	return nil
+}
+
+func (l *local) Logs(ctx context.Context, containerName string, q runlog.Query, follow bool, w io.Writer) error {
+	workdir := path.Join(l.cfg.Workspace, containerName)
+	running := func() bool {
+		_, err := os.Stat(path.Join(workdir, localPidFilename))
+		return err == nil
+	}
+	if err := copyLog(ctx, workdir, q, follow, running, w); err != nil {
+		l.log.Ctx(ctx).Error("failed to read run log", logging.Phase, "logs", "container", containerName, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (l *local) Stop(ctx context.Context, containerName string) error {
+	logger := l.log.Ctx(ctx).With(logging.Phase, "stop", "container", containerName)
+	proc, err := l.process(containerName)
+	if err != nil {
+		logger.Error("failed to find process", "error", err)
+		return err
+	}
+	// the pid of a process that exited may belong to another process by now
+	if !proc.alive() {
+		logger.Info("process exited already", "pid", proc.pid)
+		return nil
+	}
+	if err := syscall.Kill(proc.pid, syscall.SIGTERM); err != nil {
+		logger.Error("failed to stop process", "pid", proc.pid, "error", err)
+		return err
+	}
+	logger.Info("stopped process", "pid", proc.pid)
+	return nil
+}
+
+// Remove stops the process, if it still runs, and removes its pid and labels files. Its
+// workspace directory is kept.
+func (l *local) Remove(ctx context.Context, containerName string) error {
+	if proc, err := l.process(containerName); err == nil && proc.alive() {
+		if err := l.Stop(ctx, containerName); err != nil {
+			return err
+		}
+	}
+	return removeProcessState(path.Join(l.cfg.Workspace, containerName))
+}
+
+// Containers lists the processes with a labels file in the workspace.
+func (l *local) Containers(_ context.Context, instance string) ([]Container, error) {
+	entries, err := os.ReadDir(l.cfg.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	var containers []Container
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(path.Join(l.cfg.Workspace, e.Name(), localLabelsFilename))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var labels map[string]string
+		if err := json.Unmarshal(b, &labels); err != nil {
+			return nil, fmt.Errorf("labels of %s: %w", e.Name(), err)
+		}
+		if labels[LabelInstance] != instance {
+			continue
+		}
+		c := Container{Name: e.Name()}
+		if proc, err := l.process(e.Name()); err == nil {
+			c.ID = "pid:" + strconv.Itoa(proc.pid)
+			c.Running = proc.alive()
+		}
+		if info, err := e.Info(); err == nil {
+			c.Created = info.ModTime()
+		}
+		containers = append(containers, containerFromLabels(c, labels))
+	}
+	return containers, nil
+}
+
+// Attach waits for the process to exit. Its output went to the orchestrator that started
+// it and is lost, and so is its exit status: it counts as succeeded when main.py wrote
+// its row counts.
+func (l *local) Attach(ctx context.Context, containerName string) error {
+	logger := l.log.Ctx(ctx).With(logging.Phase, "attach", "container", containerName)
+	workdir := path.Join(l.cfg.Workspace, containerName)
+	proc, err := l.process(containerName)
+	if err != nil {
+		logger.Error("failed to find process", "error", err)
+		return err
+	}
+	logger.Info("attached to process", "pid", proc.pid)
+	for proc.alive() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	if err := removeProcessState(workdir); err != nil {
+		logger.Error("failed to remove pid file", "error", err)
+	}
+	if _, err := os.Stat(path.Join(workdir, factor.StatsFilename)); err != nil {
+		logger.Error("process exited without reporting row counts", "pid", proc.pid)
+		return errors.New("process exited with an unknown status without reporting row counts")
+	}
+	logger.Info("process finished", "pid", proc.pid)
+	return nil
+}
+
+// process is the process identified by the pid file of containerName.
+func (l *local) process(containerName string) (process, error) {
+	b, err := os.ReadFile(path.Join(l.cfg.Workspace, containerName, localPidFilename))
+	if err != nil {
+		return process{}, err
+	}
+	proc, err := parseProcess(string(b))
+	if err != nil {
+		return process{}, fmt.Errorf("invalid pid file of %s: %w", containerName, err)
+	}
+	return proc, nil
+}
+
+func writeProcessState(dir string, proc process, labels map[string]string) error {
+	if err := os.WriteFile(path.Join(dir, localPidFilename), []byte(proc.String()), 0o644); err != nil {
+		return err
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, localLabelsFilename), b, 0o644)
+}
+
+func removeProcessState(dir string) error {
+	for _, name := range []string{localPidFilename, localLabelsFilename} {
+		if err := os.Remove(path.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildImage has no image to build locally; it prepares the virtualenv for the requirements
+// of the build context instead, which runs in the image tag then use.
+func (l *local) BuildImage(ctx context.Context, dir string, tag string) (err error) {
+	ctx, span := tracing.Start(ctx, "BuildImage", "executor", config.ExecutorLocal, "tag", tag)
+	defer func() { span.End(err) }()
+
+	requirements, err := os.ReadFile(filepath.Join(dir, "requirements.txt"))
+	if err != nil {
+		return err
+	}
+	logger := l.log.Ctx(ctx).With(logging.Phase, "build", "tag", tag)
+	if _, err = l.venv(ctx, logger, string(requirements)); err != nil {
+		logger.Error("failed to prepare virtualenv", "error", err)
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(l.imageFile(tag)), 0o755); err == nil {
+		err = os.WriteFile(l.imageFile(tag), requirements, 0o644)
+	}
+	if err != nil {
+		logger.Error("failed to record the requirements of the image", "error", err)
+		return err
+	}
+	logger.Info("prepared virtualenv")
+	return nil
+}
+
+// ImageDigest identifies the virtualenv standing in for the image, which is only
+// determined by the requirements.
+func (l *local) ImageDigest(_ context.Context, image string) (string, error) {
+	return "venv:" + venvKey(l.requirements(image)), nil
+}
+
+// requirements are those BuildImage installed for image, or the base requirements for
+// the base image and images it did not build.
+func (l *local) requirements(image string) string {
+	if image == "" {
+		return factor.Requirements
+	}
+	b, err := os.ReadFile(l.imageFile(image))
+	if err != nil {
+		return factor.Requirements
+	}
+	return string(b)
+}
+
+// imageFile records the requirements BuildImage installed for the image tag.
+func (l *local) imageFile(tag string) string {
+	return filepath.Join(l.venvDir(), "factorctl-images", url.PathEscape(tag)+".txt")
+}
+
+func (l *local) venvDir() string {
+	if l.cfg.Local.VenvDir == "" {
+		return os.TempDir()
+	}
+	return l.cfg.Local.VenvDir
+}
+
+// venv returns the interpreter of a virtualenv with requirements installed, creating it on
+// first use. Virtualenvs are keyed by the hash of their requirements.
+func (l *local) venv(ctx context.Context, logger *logging.Logger, requirements string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dir := filepath.Join(l.venvDir(), "factorctl-venv-"+venvKey(requirements))
+	python := filepath.Join(dir, "bin", "python")
+	ready := filepath.Join(dir, ".ready")
+	if _, err := os.Stat(ready); err == nil {
+		return python, nil
+	}
+
+	logger.Info("creating virtualenv", "dir", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := runQuiet(ctx, l.cfg.Local.Python, "-m", "venv", dir); err != nil {
+		return "", err
+	}
+	reqFile := filepath.Join(dir, "requirements.txt")
+	if err := os.WriteFile(reqFile, []byte(requirements), 0o644); err != nil {
+		return "", err
+	}
+	if err := runQuiet(ctx, python, "-m", "pip", "install", "--quiet", "-r", reqFile); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(ready, nil, 0o644); err != nil {
+		return "", err
+	}
+	return python, nil
+}
+
+func venvKey(requirements string) string {
+	sum := sha256.Sum256([]byte(requirements))
+	return hex.EncodeToString(sum[:6])
+}
+
+func runQuiet(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// NewLocal returns the executor running factors with the host Python interpreter.
+func NewLocal(cfg config.Config, secrets secrets.Provider, logger *logging.Logger) Interface {
+	return &local{cfg: cfg, secrets: secrets, log: logger}
+}
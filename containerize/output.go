@@ -0,0 +1,60 @@
+package containerize
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runlog"
+)
+
+// logsPollInterval is how often Logs checks a followed log for new lines.
+const logsPollInterval = 200 * time.Millisecond
+
+// runOutput passes the output of a run through to the orchestrator's output and keeps it
+// in the run's log, progress lines taken out.
+type runOutput struct {
+	log      *runlog.Writer
+	stdout   io.WriteCloser
+	stderr   io.WriteCloser
+	progress *progressWriter
+	// errOut is stderr also passed through to the orchestrator's output
+	errOut io.Writer
+}
+
+func newRunOutput(w io.Writer, log *runlog.Writer, dir string, logger *logging.Logger) *runOutput {
+	o := &runOutput{log: log, stdout: log.Stream(runlog.StreamStdout), stderr: log.Stream(runlog.StreamStderr)}
+	o.progress = newProgressWriter(io.MultiWriter(w, o.stdout), dir, logger)
+	o.errOut = io.MultiWriter(w, o.stderr)
+	return o
+}
+
+// Stdout is the writer of the standard output of main.py.
+func (o *runOutput) Stdout() io.Writer { return o.progress }
+
+// Stderr is the writer of the standard error of main.py.
+func (o *runOutput) Stderr() io.Writer { return o.errOut }
+
+// Close writes unterminated last lines and closes the log.
+func (o *runOutput) Close() error {
+	err := o.progress.Close()
+	for _, c := range []io.Closer{o.stdout, o.stderr, o.log} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// copyLog writes the text of the lines of the log in dir selected by q to w, following it
+// while running reports true if follow is set.
+func copyLog(ctx context.Context, dir string, q runlog.Query, follow bool, running func() bool, w io.Writer) error {
+	if !follow {
+		running = func() bool { return false }
+	}
+	return runlog.Follow(ctx, dir, q, logsPollInterval, running, func(line runlog.Line) error {
+		_, err := io.WriteString(w, line.Text+"\n")
+		return err
+	})
+}
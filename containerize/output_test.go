@@ -0,0 +1,41 @@
+package containerize
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runlog"
+)
+
+func TestRunOutput(t *testing.T) {
+	dir := t.TempDir()
+	log, err := runlog.NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w bytes.Buffer
+	o := newRunOutput(&w, log, dir, logging.New(io.Discard, "text", logging.LevelInfo))
+	if _, err := io.WriteString(o.Stdout(), "out\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(o.Stderr(), "err\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := w.String(); got != "out\nerr\n" {
+		t.Errorf("output = %q, want both streams", got)
+	}
+	lines, err := runlog.Read(dir, runlog.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Stream != runlog.StreamStdout || lines[0].Text != "out" ||
+		lines[1].Stream != runlog.StreamStderr || lines[1].Text != "err" {
+		t.Errorf("log = %+v", lines)
+	}
+}
@@ -0,0 +1,96 @@
+package containerize
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// ownersDir is the directory of the workspace holding a lock file per orchestrator process
+// owning containers and runs, named after its boot ID.
+const ownersDir = "owners"
+
+var bootID = newBootID()
+
+// BootID identifies this orchestrator process, which owns the containers and runs it
+// labels or records with it. Unlike a process ID, it is never reused, by a later process
+// or by the process of another container.
+func BootID() string {
+	return bootID
+}
+
+func newBootID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("containerize: no randomness for the boot ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+var (
+	holdOnce sync.Once
+	holdErr  error
+)
+
+// Hold shows other orchestrators sharing workspace that this process lives, for
+// OwnerAlive, by holding a lock named after its boot ID until it exits.
+func Hold(workspace string) error {
+	holdOnce.Do(func() {
+		holdErr = hold(workspace)
+	})
+	return holdErr
+}
+
+func hold(workspace string) error {
+	dir := filepath.Join(workspace, ownersDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// locked before it is renamed into place, so that it is never seen unlocked
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(tmp.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, bootID)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	// the file stays open, and locked, for the life of the process
+	return nil
+}
+
+// OwnerAlive reports whether the orchestrator process of id, a boot ID, still runs. Its lock
+// is only seen by orchestrators sharing workspace, on the same host for local file systems.
+// The lock file of an orchestrator found gone is removed.
+func OwnerAlive(workspace, id string) bool {
+	if id == "" || id != filepath.Base(id) {
+		return false
+	}
+	if id == bootID {
+		return true
+	}
+	path := filepath.Join(workspace, ownersDir, id)
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return true
+	}
+	if err == nil {
+		os.Remove(path)
+	}
+	return false
+}
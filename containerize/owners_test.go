@@ -0,0 +1,86 @@
+package containerize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOwnerAlive(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, ownersDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// another orchestrator, holding its lock through an open file of its own
+	live := newBootID()
+	f, err := os.Create(filepath.Join(workspace, ownersDir, live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	// an orchestrator that exited, its lock released with its files
+	gone := newBootID()
+	if err := os.WriteFile(filepath.Join(workspace, ownersDir, gone), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"this process", BootID(), true},
+		{"live orchestrator", live, true},
+		{"exited orchestrator", gone, false},
+		{"unknown", newBootID(), false},
+		{"none", "", false},
+		{"path", "../" + live, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OwnerAlive(workspace, tt.id); got != tt.want {
+				t.Errorf("OwnerAlive(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(workspace, ownersDir, gone)); !os.IsNotExist(err) {
+		t.Errorf("lock file of the exited orchestrator was kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, ownersDir, live)); err != nil {
+		t.Errorf("lock file of the live orchestrator: %v", err)
+	}
+}
+
+func TestHold(t *testing.T) {
+	workspace := t.TempDir()
+	if err := Hold(workspace); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(workspace, ownersDir, BootID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// flock locks are per open file, so the lock of Hold conflicts with this one
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != syscall.EWOULDBLOCK {
+		t.Errorf("lock of the boot ID not held: %v", err)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := runLabels(WithRunID(context.Background(), "run-1"), "host-a")
+	c := containerFromLabels(Container{Name: "run-1-node"}, labels)
+	if c.RunID != "run-1" || c.Instance != "host-a" || c.BootID != BootID() {
+		t.Errorf("container from labels = %+v", c)
+	}
+	if _, ok := runLabels(context.Background(), "host-a")[LabelRunID]; ok {
+		t.Error("labels of a container outside of a run have a run ID")
+	}
+}
@@ -0,0 +1,83 @@
+package containerize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// process identifies a process of the local executor on this host. Its pid alone may name
+// a later process once it exited; together with its start time it does not.
+type process struct {
+	pid int
+	// start is the start time of the process, empty where it cannot be read.
+	start string
+}
+
+// newProcess identifies the running process pid.
+func newProcess(pid int) process {
+	start, _ := processStart(pid)
+	return process{pid: pid, start: start}
+}
+
+// parseProcess parses a process written by String.
+func parseProcess(s string) (process, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return process{}, fmt.Errorf("malformed process %q", s)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return process{}, err
+	}
+	proc := process{pid: pid}
+	if len(fields) == 2 {
+		proc.start = fields[1]
+	}
+	return proc, nil
+}
+
+func (p process) String() string {
+	if p.start == "" {
+		return strconv.Itoa(p.pid)
+	}
+	return strconv.Itoa(p.pid) + " " + p.start
+}
+
+// alive reports whether the process still runs. Signal 0 checks for a process of its pid,
+// and the start time of that process tells whether it is the same one.
+func (p process) alive() bool {
+	if err := syscall.Kill(p.pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	if p.start == "" {
+		return true
+	}
+	start, err := processStart(p.pid)
+	return err == nil && start == p.start
+}
+
+// processStart is the start time of the process pid, in clock ticks since boot, as read
+// from /proc.
+func processStart(pid int) (string, error) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", err
+	}
+	// the command name, in parentheses, may hold spaces and parentheses itself
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return "", fmt.Errorf("malformed stat of process %d", pid)
+	}
+	// the fields following the command name start with the third, the start time is the
+	// 22nd
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return "", fmt.Errorf("malformed stat of process %d", pid)
+	}
+	return fields[19], nil
+}
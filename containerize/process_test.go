@@ -0,0 +1,55 @@
+package containerize
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestProcessAlive(t *testing.T) {
+	self := newProcess(os.Getpid())
+	if self.start == "" {
+		t.Skip("no start times of processes to tell them apart")
+	}
+
+	// a process that exited, its pid free to be reused
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("true not found")
+	}
+
+	tests := []struct {
+		name string
+		proc process
+		want bool
+	}{
+		{"this process", self, true},
+		{"pid reused", process{pid: self.pid, start: self.start + "0"}, false},
+		{"pid without start time", process{pid: self.pid}, true},
+		{"exited", process{pid: cmd.Process.Pid, start: self.start}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.proc.alive(); got != tt.want {
+				t.Errorf("%v alive = %v, want %v", tt.proc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProcess(t *testing.T) {
+	for _, s := range []string{"42 123456", "42", "42 123456\n"} {
+		proc, err := parseProcess(s)
+		if err != nil {
+			t.Fatalf("parseProcess(%q) error = %v", s, err)
+		}
+		if back, _ := parseProcess(proc.String()); back != proc {
+			t.Errorf("parseProcess(%q) = %+v, written as %q", s, proc, proc.String())
+		}
+	}
+	for _, s := range []string{"", "pid", "42 1 2"} {
+		if _, err := parseProcess(s); err == nil {
+			t.Errorf("parseProcess(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package containerize
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+// progressWriter passes the output of main.py through to w, except for progress lines,
+// which it applies to the progress file of dir instead. Output is passed through by
+// complete lines; Close writes what is left of the last one.
+type progressWriter struct {
+	w      io.Writer
+	dir    string
+	logger *logging.Logger
+
+	mu       sync.Mutex
+	buf      []byte
+	progress factor.Progress
+}
+
+func newProgressWriter(w io.Writer, dir string, logger *logging.Logger) *progressWriter {
+	return &progressWriter{w: w, dir: dir, logger: logger}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		line := p.buf[:i+1]
+		if err := p.line(line); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+func (p *progressWriter) line(line []byte) error {
+	prefix := []byte(factor.ProgressPrefix)
+	if !bytes.HasPrefix(line, prefix) {
+		_, err := p.w.Write(line)
+		return err
+	}
+	// a malformed event is the factor's problem, not the run's
+	if err := p.progress.Apply(bytes.TrimSpace(line[len(prefix):])); err != nil {
+		p.logger.Warn("ignored malformed progress event", "error", err)
+		return nil
+	}
+	if err := factor.WriteProgress(p.dir, p.progress); err != nil {
+		p.logger.Error("failed to write progress", "error", err)
+	}
+	return nil
+}
+
+// Close passes through an unterminated last line.
+func (p *progressWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.line(p.buf)
+	p.buf = nil
+	return err
+}
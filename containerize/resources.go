@@ -0,0 +1,231 @@
+package containerize
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+const (
+	// ResourceSamplesFilename is the file in the run's workspace directory the resource
+	// samples of a running container are appended to, one ResourceSample per line.
+	ResourceSamplesFilename = "resources.jsonl"
+	// ResourceUsageFilename holds the ResourceUsage of the finished run.
+	ResourceUsageFilename = "resource_usage.json"
+)
+
+// ResourceSample is the resource usage of a running container at one point in time.
+// Counters are totals since the container started.
+type ResourceSample struct {
+	Time time.Time `json:"time"`
+	// CPUPercent is the share of one CPU used since the previous sample, so it exceeds
+	// 100 when several CPUs are busy.
+	CPUPercent  float64 `json:"cpu_percent"`
+	CPUSeconds  float64 `json:"cpu_seconds"`
+	MemoryBytes uint64  `json:"memory_bytes"`
+	// MemoryLimitBytes is the memory limit of the container, or of the host without one.
+	MemoryLimitBytes uint64 `json:"memory_limit_bytes"`
+	NetworkRxBytes   uint64 `json:"network_rx_bytes"`
+	NetworkTxBytes   uint64 `json:"network_tx_bytes"`
+	BlockReadBytes   uint64 `json:"block_read_bytes"`
+	BlockWriteBytes  uint64 `json:"block_write_bytes"`
+}
+
+// ResourceUsage sums up the resources a run used.
+type ResourceUsage struct {
+	PeakMemoryBytes uint64  `json:"peak_memory_bytes"`
+	CPUSeconds      float64 `json:"cpu_seconds"`
+}
+
+// ReadResourceUsage reads the usage of the run that ran in dir, zero if none was recorded.
+func ReadResourceUsage(dir string) (ResourceUsage, error) {
+	var usage ResourceUsage
+	b, err := os.ReadFile(path.Join(dir, ResourceUsageFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return usage, err
+	}
+	err = json.Unmarshal(b, &usage)
+	return usage, err
+}
+
+// ReadResourceSamples reads the samples of the run that ran in dir from offset on and
+// returns the offset following the last complete line, for reading a file still written to.
+func ReadResourceSamples(dir string, offset int64) ([]ResourceSample, int64, error) {
+	f, err := os.Open(path.Join(dir, ResourceSamplesFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, offset, nil
+	}
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var samples []ResourceSample
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial line is read again once complete
+			return samples, offset, nil
+		}
+		if err != nil {
+			return samples, offset, err
+		}
+		offset += int64(len(line))
+		var sample ResourceSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return samples, offset, err
+		}
+		samples = append(samples, sample)
+	}
+}
+
+func writeResourceUsage(dir string, usage ResourceUsage) error {
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, ResourceUsageFilename), b, 0o644)
+}
+
+// sampleResources follows the stats of the container in the background, appending a
+// sample to the samples file of dir every interval, and writes the usage file once the
+// stats end with the container or ctx. The returned channel is closed when it is done.
+func (s server) sampleResources(ctx context.Context, logger *logging.Logger, containerID string, dir string) <-chan struct{} {
+	done := make(chan struct{})
+	interval := time.Duration(s.cfg.Docker.StatsInterval)
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		usage, err := s.followStats(ctx, containerID, dir, interval)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("failed to sample container resources", logging.Phase, "stats", "error", err)
+		}
+		if err := writeResourceUsage(dir, usage); err != nil {
+			logger.Error("failed to write resource usage", logging.Phase, "stats", "error", err)
+		}
+	}()
+	return done
+}
+
+func (s server) followStats(ctx context.Context, containerID string, dir string, interval time.Duration) (ResourceUsage, error) {
+	var usage ResourceUsage
+	f, err := os.Create(path.Join(dir, ResourceSamplesFilename))
+	if err != nil {
+		return usage, err
+	}
+	defer f.Close()
+
+	stats, err := s.cli.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return usage, err
+	}
+	defer stats.Body.Close()
+
+	enc := json.NewEncoder(f)
+	dec := json.NewDecoder(stats.Body)
+	var written time.Time
+	for {
+		var v types.StatsJSON
+		if err := dec.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				return usage, nil
+			}
+			return usage, err
+		}
+		// the daemon reports zero stats once the container has stopped
+		if v.Read.IsZero() {
+			continue
+		}
+		sample := resourceSample(v)
+		if sample.MemoryBytes > usage.PeakMemoryBytes {
+			usage.PeakMemoryBytes = sample.MemoryBytes
+		}
+		usage.CPUSeconds = sample.CPUSeconds
+		// the daemon sends stats about every second; peaks are tracked at that rate
+		// but samples are only written every interval
+		if sample.Time.Sub(written) < interval {
+			continue
+		}
+		written = sample.Time
+		if err := enc.Encode(sample); err != nil {
+			return usage, err
+		}
+	}
+}
+
+// resourceSample computes a sample the way docker stats does, leaving the reclaimable
+// page cache out of the memory usage.
+func resourceSample(v types.StatsJSON) ResourceSample {
+	sample := ResourceSample{
+		Time:             v.Read,
+		CPUSeconds:       float64(v.CPUStats.CPUUsage.TotalUsage) / 1e9,
+		MemoryBytes:      v.MemoryStats.Usage,
+		MemoryLimitBytes: v.MemoryStats.Limit,
+	}
+	cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := float64(v.CPUStats.OnlineCPUs)
+		if cpus == 0 {
+			cpus = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+		}
+		sample.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+	// cgroup v1 reports total_inactive_file, cgroup v2 inactive_file
+	cache, ok := v.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		cache = v.MemoryStats.Stats["inactive_file"]
+	}
+	if cache < sample.MemoryBytes {
+		sample.MemoryBytes -= cache
+	}
+	for _, n := range v.Networks {
+		sample.NetworkRxBytes += n.RxBytes
+		sample.NetworkTxBytes += n.TxBytes
+	}
+	for _, e := range v.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			sample.BlockReadBytes += e.Value
+		case "write":
+			sample.BlockWriteBytes += e.Value
+		}
+	}
+	return sample
+}
+
+// processUsage is the resource usage of an exited process, from the rusage the kernel
+// reports to its parent. It has no samples.
+func processUsage(state *os.ProcessState) ResourceUsage {
+	var usage ResourceUsage
+	if state == nil {
+		return usage
+	}
+	usage.CPUSeconds = (state.UserTime() + state.SystemTime()).Seconds()
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// Linux reports the maximum resident set size in kilobytes
+		usage.PeakMemoryBytes = uint64(rusage.Maxrss) * 1024
+	}
+	return usage
+}
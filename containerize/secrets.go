@@ -0,0 +1,53 @@
+package containerize
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/docker/docker/api/types/mount"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/secrets"
+)
+
+// injectCredentials resolves the MongoDB credentials and returns the environment variables
+// or read-only mount handing them to the container, plus a cleanup func removing any file
+// written on the host.
+func (s server) injectCredentials(ctx context.Context, name string) ([]string, []mount.Mount, func(), error) {
+	noop := func() {}
+	creds, err := secrets.Mongo(ctx, s.secrets)
+	if err != nil || creds.Empty() {
+		return nil, nil, noop, err
+	}
+
+	if s.cfg.Secrets.Inject == config.InjectEnv {
+		return []string{
+			secrets.MongoEnvUsername + "=" + creds.Username,
+			secrets.MongoEnvPassword + "=" + creds.Password,
+		}, nil, noop, nil
+	}
+
+	// os.CreateTemp creates the file with mode 0600
+	f, err := os.CreateTemp(s.cfg.Secrets.Dir, name+"-*.json")
+	if err != nil {
+		return nil, nil, noop, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	err = json.NewEncoder(f).Encode(creds)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, noop, err
+	}
+	return nil, []mount.Mount{
+		{
+			Type:     mount.TypeBind,
+			Source:   f.Name(),
+			Target:   secrets.MongoMountPath,
+			ReadOnly: true,
+		},
+	}, cleanup, nil
+}
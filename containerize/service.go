@@ -4,100 +4,424 @@ import (
 	"context"
 	"errors"
 	"io"
-	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
 
 	"github.com/docker/docker/client"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/runlog"
+	"github.com/nathanusask/docker-go-demo/secrets"
+	"github.com/nathanusask/docker-go-demo/tracing"
 )
 
 const (
 	pythonMainFilename = "main.py"
 	dstPath            = "/app/main.py"
+	// workPath is where the run's workspace directory is mounted and the working directory of
+	// main.py, so relative paths resolve the same way as with the local executor.
+	workPath = "/work"
 )
 
 type server struct {
-	cli *client.Client
+	cli     *client.Client
+	cfg     config.Config
+	secrets secrets.Provider
+	log     *logging.Logger
+	// events tells when the containers exit
+	events *watcher
 }
 
-func (s server) RunFactor(ctx context.Context, baseImage string, code string, factorNameLowercase string, paramArgs []string) error {
-	if err := os.MkdirAll(factorNameLowercase, os.ModePerm); err != nil {
-		log.Println("[Error] failed to create dir with error", err.Error())
-		return err
+// RunFactor runs code in a container of baseImage, or of the configured base image when
+// baseImage is empty, and waits for it to finish within the configured run timeout.
+func (s server) RunFactor(ctx context.Context, baseImage string, code string, factorNameLowercase string, paramArgs []string) (err error) {
+	requested := time.Now()
+	logger := s.log.Ctx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Timeouts.Run))
+	defer cancel()
+	if baseImage == "" {
+		baseImage = s.cfg.Image.Base
 	}
-	pythonFilepath := path.Join(factorNameLowercase, pythonMainFilename)
-	f, err := os.OpenFile(pythonFilepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	ctx, span := tracing.Start(ctx, "RunFactor", "executor", config.ExecutorDocker, "container.name", factorNameLowercase, "image", baseImage)
+	defer func() { span.End(err) }()
+
+	_, prepareSpan := tracing.Start(ctx, "prepare")
+	pythonFilepath, err := writeMain(s.cfg.Workspace, factorNameLowercase, code)
 	if err != nil {
-		log.Println("[Error] failed to create file with error", err.Error())
+		prepareSpan.End(err)
+		logger.Error("failed to write main.py", logging.Phase, "prepare", "error", err)
 		return err
 	}
-	defer f.Close()
-	if _, err = f.WriteString(code); err != nil {
-		log.Println("[Error] failed to write code with error", err.Error())
+	defer importSpans(logger, pythonFilepath)
+
+	src, err := filepath.Abs(pythonFilepath)
+	if err != nil {
+		prepareSpan.End(err)
+		logger.Error("failed to get the absolute path of main.py", logging.Phase, "prepare", "path", pythonFilepath, "error", err)
 		return err
 	}
-
-	pwd, err := os.Getwd()
+	env, secretMounts, cleanup, err := s.injectCredentials(ctx, factorNameLowercase)
+	prepareSpan.End(err)
 	if err != nil {
-		log.Println("[Error] failed to get the current directory with error", err.Error())
+		logger.Error("failed to inject credentials", logging.Phase, "prepare", "error", err)
 		return err
 	}
-	src := path.Join(pwd, pythonFilepath)
+	defer cleanup()
+
+	_, createSpan := tracing.Start(ctx, "create")
 	body, err := s.cli.ContainerCreate(ctx, &container.Config{
-		Cmd:   append([]string{"python", dstPath}, paramArgs...),
-		Image: baseImage,
+		Cmd:        append([]string{"python", dstPath}, paramArgs...),
+		Env:        append(env, tracing.Env(ctx)...),
+		Image:      baseImage,
+		WorkingDir: workPath,
+		Labels:     s.labels(ctx),
 	}, &container.HostConfig{
-		AutoRemove: true,
-		ExtraHosts: []string{"host.docker.internal:host-gateway"},
-		Mounts: []mount.Mount{
+		ExtraHosts: s.cfg.Docker.ExtraHosts,
+		Binds:      s.cfg.Docker.Volumes,
+		Resources:  resources(s.cfg.Resources),
+		Mounts: append([]mount.Mount{
 			{
 				Type:   mount.TypeBind,
 				Source: src,
 				Target: dstPath,
 			},
-		},
+			{
+				Type:   mount.TypeBind,
+				Source: filepath.Dir(src),
+				Target: workPath,
+			},
+		}, secretMounts...),
 	}, nil, nil, factorNameLowercase)
+	createSpan.End(err)
 	if err != nil {
-		log.Println("[Error] failed to create container with error", err.Error())
+		logger.Error("failed to create container", logging.Phase, "create", "image", baseImage, "error", err)
 		return err
 	}
 
 	containerID := body.ID
-	log.Println("[Info] container ID:", containerID)
+	span.SetAttributes("container.id", containerID)
+	logger = logger.With(logging.ContainerID, containerID)
+	logger.Info("created container", logging.Phase, "create", "image", baseImage, "name", factorNameLowercase)
+	// the container is removed by hand rather than auto-removed, so it can be inspected
+	// after its exit and is also removed when the run times out
+	defer s.remove(logger, containerID)
 
-	if err = s.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
-		log.Println("[Error] failed to start container with error", err.Error())
+	// watch before starting so a container exiting quickly cannot be missed
+	exited := s.events.watch(containerID)
+	defer s.events.unwatch(containerID)
+
+	_, startSpan := tracing.Start(ctx, "start")
+	err = s.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+	startSpan.End(err)
+	if err != nil {
+		logger.Error("failed to start container", logging.Phase, "start", "error", err)
 		return err
 	}
-	output, err := s.cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{})
+	logger.Info("started container", logging.Phase, "start", "queue_wait", time.Since(requested))
+	metrics.QueueWait.Since(requested, config.ExecutorDocker)
+	metrics.RunningContainers.Inc(config.ExecutorDocker)
+	defer metrics.RunningContainers.Dec(config.ExecutorDocker)
+
+	log, err := runlog.NewWriter(filepath.Dir(src))
 	if err != nil {
-		log.Println("[Error] failed to get logs for container", containerID, "with error", err.Error())
+		logger.Error("failed to create run log", logging.Phase, "wait", "error", err)
 		return err
 	}
-	if _, err := io.Copy(os.Stdout, output); err != nil {
-		log.Println("[Error] failed to copy container output to stdout with error", err.Error())
-		return err
+	output := newRunOutput(os.Stdout, log, filepath.Dir(src), logger)
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error("failed to write run log", logging.Phase, "wait", "error", err)
+		}
+	}()
+	statsCtx, stopStats := context.WithCancel(ctx)
+	statsDone := s.sampleResources(statsCtx, logger, containerID, filepath.Dir(src))
+	waitCtx, waitSpan := tracing.Start(ctx, "wait")
+	err = s.wait(waitCtx, logger, output, "", containerID, exited)
+	waitSpan.End(err)
+	stopStats()
+	<-statsDone
+	return err
+}
+
+// wait copies the output of the started container to output until it exits. Losing the
+// output, as when the daemon restarts, does not end the wait.
+func (s server) wait(ctx context.Context, logger *logging.Logger, output *runOutput, since string, containerID string, exited <-chan exitStatus) error {
+	if err := s.copyOutput(ctx, logger, containerID, output, since); err != nil && ctx.Err() == nil {
+		logger.Warn("waiting for container to finish without its output", logging.Phase, "wait")
 	}
 
-	bodyChan, errCh := s.cli.ContainerWait(ctx, containerID, container.WaitConditionRemoved)
 	select {
-	case err = <-errCh:
-		log.Println("[Error] failed to wait for container to finish with error", err.Error())
-		return err
-	case b := <-bodyChan:
-		if b.Error != nil {
-			log.Println("[Error] error occurred", b.Error.Message)
-			return errors.New(b.Error.Message)
+	case status := <-exited:
+		if status.err != nil {
+			logger.Error("failed to wait for container to finish", logging.Phase, "wait", "error", status.err)
+			return status.err
+		}
+		if status.code != 0 {
+			exitErr := &ExitError{Code: status.code, OOMKilled: status.oomKilled}
+			logger.Error("container failed", logging.Phase, "wait", "status", status.code, "oom_killed", exitErr.OOMKilled)
+			return exitErr
 		}
-		log.Println("[Info] container finished and return status", b.StatusCode)
+		logger.Info("container finished", logging.Phase, "wait", "status", status.code)
 		return nil
+	case <-ctx.Done():
+		logger.Error("container did not finish", logging.Phase, "wait", "error", ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// remove force-removes the container, killing it if it still runs.
+func (s server) remove(logger *logging.Logger, containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true}); err != nil {
+		logger.Error("failed to remove container", logging.Phase, "remove", "error", err)
+	}
+}
+
+// copyOutput copies the output of the container since the Unix timestamp since, all of it
+// when empty, to output until the container exits.
+func (s server) copyOutput(ctx context.Context, logger *logging.Logger, containerID string, output *runOutput, since string) error {
+	body, err := s.cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      since,
+	})
+	if err != nil {
+		logger.Error("failed to get container logs", logging.Phase, "wait", "error", err)
+		return err
+	}
+	defer body.Close()
+	if err := demux(output.Stdout(), output.Stderr(), body); err != nil {
+		logger.Error("failed to copy container output", logging.Phase, "wait", "error", err)
+		return err
+	}
+	return nil
+}
+
+// Logs reads the log the run kept in its workspace, which outlives the container, and
+// follows it while the container exists.
+func (s server) Logs(ctx context.Context, containerName string, q runlog.Query, follow bool, w io.Writer) error {
+	running := func() bool {
+		_, err := s.cli.ContainerInspect(ctx, containerName)
+		return err == nil
+	}
+	if err := copyLog(ctx, path.Join(s.cfg.Workspace, containerName), q, follow, running, w); err != nil {
+		s.log.Ctx(ctx).Error("failed to read run log", logging.Phase, "logs", "container", containerName, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s server) Stop(ctx context.Context, containerName string) error {
+	if err := s.cli.ContainerStop(ctx, containerName, nil); err != nil {
+		s.log.Ctx(ctx).Error("failed to stop container", logging.Phase, "stop", "container", containerName, "error", err)
+		return err
+	}
+	s.log.Ctx(ctx).Info("stopped container", logging.Phase, "stop", "container", containerName)
+	return nil
+}
+
+func (s server) Remove(ctx context.Context, containerName string) error {
+	if err := s.cli.ContainerRemove(ctx, containerName, types.ContainerRemoveOptions{Force: true}); err != nil {
+		s.log.Ctx(ctx).Error("failed to remove container", logging.Phase, "remove", "container", containerName, "error", err)
+		return err
+	}
+	s.log.Ctx(ctx).Info("removed container", logging.Phase, "remove", "container", containerName)
+	return nil
+}
+
+func (s server) Containers(ctx context.Context, instance string) ([]Container, error) {
+	list, err := s.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelInstance+"="+instance)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(list))
+	for _, c := range list {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		containers = append(containers, containerFromLabels(Container{
+			ID:      c.ID,
+			Name:    name,
+			Running: c.State == "running",
+			Created: time.Unix(c.Created, 0),
+		}, c.Labels))
+	}
+	return containers, nil
+}
+
+// Attach continues the run's log where the orchestrator that started the container left
+// it. Output the container wrote just before that orchestrator exited may be missing.
+func (s server) Attach(ctx context.Context, containerName string) (err error) {
+	logger := s.log.Ctx(ctx).With("container", containerName)
+	ctx, span := tracing.Start(ctx, "Attach", "executor", config.ExecutorDocker, "container.name", containerName)
+	defer func() { span.End(err) }()
+
+	inspect, err := s.cli.ContainerInspect(ctx, containerName)
+	if err != nil {
+		logger.Error("failed to inspect container", logging.Phase, "attach", "error", err)
+		return err
+	}
+	logger = logger.With(logging.ContainerID, inspect.ID)
+	dir := path.Join(s.cfg.Workspace, containerName)
+	log, last, err := runlog.OpenWriter(dir)
+	if err != nil {
+		logger.Error("failed to open run log", logging.Phase, "attach", "error", err)
+		return err
+	}
+	output := newRunOutput(io.Discard, log, dir, logger)
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error("failed to write run log", logging.Phase, "attach", "error", err)
+		}
+	}()
+	since := ""
+	if !last.IsZero() {
+		since = last.Format(time.RFC3339Nano)
+	}
+
+	logger.Info("attached to container", logging.Phase, "attach", "running", inspect.State.Running)
+	exited := s.events.watch(inspect.ID)
+	defer s.events.unwatch(inspect.ID)
+	// the container may have exited before it was watched
+	if err := s.events.check(ctx, inspect.ID); err != nil {
+		logger.Error("failed to inspect container", logging.Phase, "attach", "error", err)
+		return err
+	}
+	err = s.wait(ctx, logger, output, since, inspect.ID, exited)
+	// a container is left running when the orchestrator stops attending to it
+	if ctx.Err() == nil {
+		s.remove(logger, inspect.ID)
+	}
+	return err
+}
+
+func (s server) BuildImage(ctx context.Context, dir string, tag string) (err error) {
+	logger := s.log.Ctx(ctx).With(logging.Phase, "build", "tag", tag)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Timeouts.Build))
+	defer cancel()
+	defer func(start time.Time) {
+		outcome := "succeeded"
+		if err != nil {
+			outcome = "failed"
+		}
+		metrics.ImageBuildDuration.Since(start, outcome)
+	}(time.Now())
+	ctx, span := tracing.Start(ctx, "BuildImage", "tag", tag)
+	defer func() { span.End(err) }()
+
+	_, archiveSpan := tracing.Start(ctx, "archive")
+	buildContext, err := tarDir(dir)
+	archiveSpan.End(err)
+	if err != nil {
+		logger.Error("failed to archive build context", "dir", dir, "error", err)
+		return err
+	}
+	_, buildSpan := tracing.Start(ctx, "build")
+	defer func() { buildSpan.End(err) }()
+	resp, err := s.cli.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		logger.Error("failed to build image", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if err = printBuildOutput(resp.Body, os.Stdout); err != nil {
+		logger.Error("failed to build image", "error", err)
+		return err
+	}
+	logger.Info("built image")
+	return nil
+}
+
+// ImageDigest prefers the repository digest of pushed images and falls back to the image ID,
+// which only identifies the image on this Docker host.
+func (s server) ImageDigest(ctx context.Context, image string) (string, error) {
+	if image == "" {
+		image = s.cfg.Image.Base
+	}
+	inspect, _, err := s.cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		// missing images are for the caller to report, which may fall back to another one
+		if !client.IsErrNotFound(err) {
+			s.log.Ctx(ctx).Error("failed to inspect image", logging.Phase, "prepare", "image", image, "error", err)
+		}
+		return "", err
+	}
+	if len(inspect.RepoDigests) > 0 {
+		return inspect.RepoDigests[0], nil
+	}
+	return inspect.ID, nil
+}
+
+// writeMain writes code to <workspace>/<name>/main.py and returns its path.
+func writeMain(workspace, name, code string) (string, error) {
+	workdir := path.Join(workspace, name)
+	if err := os.MkdirAll(workdir, os.ModePerm); err != nil {
+		return "", err
+	}
+	// files of an earlier run in the same directory must not be taken for this run's
+	for _, name := range []string{tracing.SpansFilename, ResourceSamplesFilename, ResourceUsageFilename, factor.ProgressFilename, runlog.Filename} {
+		if err := os.Remove(path.Join(workdir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	pythonFilepath := path.Join(workdir, pythonMainFilename)
+	if err := os.WriteFile(pythonFilepath, []byte(code), os.ModePerm); err != nil {
+		return "", err
+	}
+	return pythonFilepath, nil
+}
+
+// importSpans exports the spans main.py wrote next to pythonFilepath.
+func importSpans(logger *logging.Logger, pythonFilepath string) {
+	if err := tracing.Import(path.Join(path.Dir(pythonFilepath), tracing.SpansFilename)); err != nil {
+		logger.Error("failed to import spans of main.py", "error", err)
+	}
+}
+
+func resources(r config.Resources) container.Resources {
+	return container.Resources{
+		NanoCPUs: int64(r.CPUs * 1e9),
+		Memory:   r.MemoryMB * 1024 * 1024,
+	}
+}
+
+// NewClient connects to the configured Docker endpoint.
+func NewClient(cfg config.Docker) (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv}
+	if cfg.Host != "" {
+		opts = append(opts, client.WithHost(cfg.Host))
+	}
+	if cfg.APIVersion != "" {
+		opts = append(opts, client.WithVersion(cfg.APIVersion))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
 	}
+	return client.NewClientWithOpts(opts...)
 }
 
-func New(c *client.Client) Interface {
-	return &server{c}
+// New returns the executor running factors in Docker containers. Its log lines carry the
+// fields of the contexts they are logged with, see logging.WithFields.
+func New(c *client.Client, cfg config.Config, secrets secrets.Provider, logger *logging.Logger) Interface {
+	return &server{cli: c, cfg: cfg, secrets: secrets, log: logger, events: newWatcher(c, cfg.InstanceName(), logger)}
 }
@@ -0,0 +1,40 @@
+package containerize
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	stdoutStream = 1
+	stderrStream = 2
+)
+
+// demux splits the multiplexed log stream of a container started without a TTY: every
+// frame has an 8-byte header holding the stream in byte 0 and the frame size in bytes 4-7.
+func demux(stdout, stderr io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var dst io.Writer
+		switch header[0] {
+		case stdoutStream:
+			dst = stdout
+		case stderrStream:
+			dst = stderr
+		default:
+			return fmt.Errorf("unexpected stream %d in container logs", header[0])
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(dst, src, size); err != nil {
+			return err
+		}
+	}
+}
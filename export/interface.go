@@ -0,0 +1,8 @@
+package export
+
+import "context"
+
+type Interface interface {
+	// Export writes the output of a finished run to req.Dir and returns the paths of the files written.
+	Export(ctx context.Context, req Request) ([]string, error)
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+// outputDir is relative to the export's workspace directory, the working directory of
+// main.py with every executor, and copied to the requested directory afterwards.
+const outputDir = "export"
+
+type exporter struct {
+	runner containerize.Interface
+	cfg    config.Config
+	log    *logging.Logger
+}
+
+func (e exporter) Export(ctx context.Context, req Request) ([]string, error) {
+	if req.Format == "" {
+		req.Format = FormatParquet
+	}
+	if req.Format != FormatParquet && req.Format != FormatCSV {
+		return nil, fmt.Errorf("unsupported export format %q", req.Format)
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.Dir == "" {
+		return nil, fmt.Errorf("export of %s has no directory", req.Collection)
+	}
+
+	args := append(e.cfg.Mongo.Args(),
+		"--collection", req.Collection,
+		"--format", string(req.Format),
+		"--partition_by_date", strconv.FormatBool(req.PartitionByDate),
+		"--timezone", req.Timezone,
+		"--output_dir", outputDir,
+	)
+	if !req.Sink.IsMongo() {
+		args = append(args, "--input_file", req.Sink.Path(req.Collection))
+	}
+	logger := e.log.Ctx(ctx).With(logging.Phase, "export", "collection", req.Collection)
+	logger.Info("exporting", "dir", req.Dir)
+	// exports of the same run, by this or another process sharing the workspace, work in
+	// directories and containers of their own
+	if err := os.MkdirAll(e.cfg.Workspace, 0o755); err != nil {
+		logger.Error("failed to create workspace", "error", err)
+		return nil, err
+	}
+	workdir, err := os.MkdirTemp(e.cfg.Workspace, "export-"+strings.ToLower(req.Name)+"-")
+	if err != nil {
+		logger.Error("failed to create export directory", "error", err)
+		return nil, err
+	}
+	defer os.RemoveAll(workdir)
+	name := filepath.Base(workdir)
+	if err := e.runner.RunFactor(ctx, req.Image, ExportMainTemplate, name, args); err != nil {
+		logger.Error("failed to export", "error", err)
+		return nil, err
+	}
+	return copyTree(filepath.Join(workdir, outputDir), req.Dir)
+}
+
+// copyTree copies the files under src to dst rather than renaming them, since the workspace
+// and dst may be on different file systems.
+func copyTree(src, dst string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if err := copyFile(target, path); err != nil {
+			return err
+		}
+		files = append(files, target)
+		return nil
+	})
+	return files, err
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func New(runner containerize.Interface, cfg config.Config, logger *logging.Logger) Interface {
+	return &exporter{runner: runner, cfg: cfg, log: logger}
+}
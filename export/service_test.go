@@ -0,0 +1,159 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// fakeRunner writes files to the output directory main.py would, in the workspace directory
+// of the container.
+type fakeRunner struct {
+	containerize.Interface
+
+	workspace string
+	files     []string
+	err       error
+	names     []string
+	args      [][]string
+}
+
+func (f *fakeRunner) RunFactor(_ context.Context, image, code, containerName string, args []string) error {
+	f.names = append(f.names, containerName)
+	f.args = append(f.args, args)
+	for _, file := range f.files {
+		path := filepath.Join(f.workspace, containerName, outputDir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// arg is the value of flag in args.
+func arg(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func newTestExporter(runner *fakeRunner) Interface {
+	cfg := config.Config{Workspace: runner.workspace, Mongo: config.Mongo{Host: "mongo", Port: 27017, Database: "quant"}}
+	return New(runner, cfg, logging.New(io.Discard, "text", logging.LevelInfo))
+}
+
+func TestExport(t *testing.T) {
+	runner := &fakeRunner{
+		workspace: t.TempDir(),
+		files:     []string{"date=2022-07-01/part-0.parquet", "date=2022-07-02/part-0.parquet"},
+	}
+	dir := t.TempDir()
+	req := ForRun(runs.Run{ID: "R1", Output: "macd_out", Image: "factor:latest"})
+	req.PartitionByDate = true
+	req.Dir = dir
+	files, err := newTestExporter(runner).Export(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	want := []string{
+		filepath.Join(dir, "date=2022-07-01", "part-0.parquet"),
+		filepath.Join(dir, "date=2022-07-02", "part-0.parquet"),
+	}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("Export() = %v, want %v", files, want)
+	}
+	if b, err := os.ReadFile(want[0]); err != nil || string(b) != runner.files[0] {
+		t.Errorf("exported file = %q, %v", b, err)
+	}
+
+	args := runner.args[0]
+	for flag, want := range map[string]string{
+		"--host":              "mongo",
+		"--collection":        "macd_out",
+		"--format":            "parquet",
+		"--partition_by_date": "true",
+		"--timezone":          "UTC",
+		"--output_dir":        outputDir,
+		"--input_file":        "",
+	} {
+		if got := arg(args, flag); got != want {
+			t.Errorf("%s = %q, want %q", flag, got, want)
+		}
+	}
+	// the workspace directory of the export is removed
+	if _, err := os.Stat(filepath.Join(runner.workspace, runner.names[0])); !os.IsNotExist(err) {
+		t.Errorf("workspace directory of the export is left: %v", err)
+	}
+}
+
+func TestExportFileSink(t *testing.T) {
+	runner := &fakeRunner{workspace: t.TempDir(), files: []string{"part-0.csv"}}
+	sink := factor.Sink{Kind: factor.SinkFile, Options: map[string]string{factor.OptionDir: "/data/out", factor.OptionFormat: "csv"}}
+	req := Request{Name: "r1", Collection: "macd_out", Sink: sink, Format: FormatCSV, Dir: t.TempDir()}
+	if _, err := newTestExporter(runner).Export(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := arg(runner.args[0], "--input_file"); got != "/data/out/macd_out.csv" {
+		t.Errorf("--input_file = %q", got)
+	}
+}
+
+func TestExportInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"format", Request{Name: "r1", Collection: "out", Format: "xlsx", Dir: "out"}},
+		{"no directory", Request{Name: "r1", Collection: "out"}},
+	}
+	for _, tt := range tests {
+		runner := &fakeRunner{workspace: t.TempDir()}
+		if _, err := newTestExporter(runner).Export(context.Background(), tt.req); err == nil {
+			t.Errorf("%s: Export() succeeded", tt.name)
+		}
+		if len(runner.args) != 0 {
+			t.Errorf("%s: main.py was run", tt.name)
+		}
+	}
+}
+
+func TestExportWorkspaceDirectories(t *testing.T) {
+	runner := &fakeRunner{workspace: t.TempDir(), files: []string{"part-0.parquet"}}
+	e := newTestExporter(runner)
+	req := Request{Name: "R1", Collection: "out", Dir: t.TempDir()}
+	for i := 0; i < 2; i++ {
+		if _, err := e.Export(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(runner.names) != 2 || runner.names[0] == runner.names[1] || !strings.HasPrefix(runner.names[0], "export-r1-") {
+		t.Errorf("exports ran in containers %v", runner.names)
+	}
+}
+
+func TestExportFailed(t *testing.T) {
+	failed := errors.New("exit status 1")
+	runner := &fakeRunner{workspace: t.TempDir(), err: failed}
+	req := Request{Name: "r1", Collection: "out", Dir: t.TempDir()}
+	if _, err := newTestExporter(runner).Export(context.Background(), req); !errors.Is(err, failed) {
+		t.Errorf("Export() error = %v", err)
+	}
+}
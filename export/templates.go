@@ -0,0 +1,81 @@
+package export
+
+import "github.com/nathanusask/docker-go-demo/factor"
+
+// ExportMainTemplate is the main.py exporting a run output. Numeric strings and Decimal128
+// become numbers, ts gains a timezone-aware datetime column and naive datetimes, which
+// MongoDB stores in UTC, are converted to the requested timezone. Outputs are partitioned
+// by the date of ts, or of their datetime column when they have no ts.
+const ExportMainTemplate = `import argparse
+import datetime
+import json
+import os
+import pandas as pd
+from urllib.parse import quote_plus, urlencode
+from bson.decimal128 import Decimal128
+from pymongo import MongoClient
+
+parser = argparse.ArgumentParser(description="export a run output")
+parser.add_argument("--host")
+parser.add_argument("--port", type=int)
+parser.add_argument("--database")
+parser.add_argument("--auth_source")
+parser.add_argument("--replica_set")
+parser.add_argument("--tls")
+parser.add_argument("--tls_ca_file")
+parser.add_argument("--collection")
+parser.add_argument("--input_file", default="")
+parser.add_argument("--format", default="parquet")
+parser.add_argument("--partition_by_date", default="false")
+parser.add_argument("--timezone", default="UTC")
+parser.add_argument("--output_dir")
+
+args = parser.parse_args()
+
+` + factor.MongoConnection + `
+if args.input_file.endswith(".csv"):
+    df = pd.read_csv(args.input_file)
+elif args.input_file.endswith(".parquet"):
+    df = pd.read_parquet(args.input_file)
+elif args.input_file:
+    df = pd.read_json(args.input_file, lines=True, convert_dates=False)
+else:
+    df = pd.DataFrame(list(mongo_client[args.database][args.collection].find({}, {"_id": 0})))
+mongo_client.close()
+
+# typed columns
+for col in df.columns:
+    if df[col].dtype == object:
+        values = df[col].map(lambda v: v.to_decimal() if isinstance(v, Decimal128) else v)
+        numbers = pd.to_numeric(values, errors="coerce")
+        if numbers.notna().sum() == values.notna().sum():
+            df[col] = numbers
+    elif pd.api.types.is_datetime64_dtype(df[col]):
+        df[col] = df[col].dt.tz_localize("UTC").dt.tz_convert(args.timezone)
+if "ts" in df.columns:
+    df = df.sort_values("ts")
+    df["datetime"] = pd.to_datetime(df["ts"], unit="ms", utc=True).dt.tz_convert(args.timezone)
+elif "datetime" in df.columns:
+    # outputs without ts, such as resampled ones, are dated by their datetime column
+    if not pd.api.types.is_datetime64_any_dtype(df["datetime"]):
+        df["datetime"] = pd.to_datetime(df["datetime"], utc=True).dt.tz_convert(args.timezone)
+    df = df.sort_values("datetime")
+
+def write(frame, path):
+    if args.format == "csv":
+        frame.to_csv(path, index=False, date_format="%Y-%m-%dT%H:%M:%S.%f%z")
+    else:
+        frame.to_parquet(path, index=False)
+
+os.makedirs(args.output_dir, exist_ok=True)
+if args.partition_by_date.lower() == "true":
+    if "datetime" not in df.columns:
+        raise ValueError("%s has no ts or datetime column to partition by" % args.collection)
+    for date, part in df.groupby(df["datetime"].dt.strftime("%Y-%m-%d")):
+        directory = os.path.join(args.output_dir, "date=" + date)
+        os.makedirs(directory, exist_ok=True)
+        write(part, os.path.join(directory, "part-0." + args.format))
+else:
+    write(df, os.path.join(args.output_dir, args.collection + "." + args.format))
+print("exported", len(df), "rows of", args.collection)
+`
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+type Format string
+
+const (
+	FormatParquet Format = "parquet"
+	FormatCSV     Format = "csv"
+)
+
+// Request is the export of one run output.
+type Request struct {
+	// Name names the export's workspace directory and container, usually after the run.
+	Name string
+	// Collection is the output collection of the run, read from Sink.
+	Collection string
+	Sink       factor.Sink
+	Image      string
+	Format     Format
+	// PartitionByDate writes one date=YYYY-MM-DD directory per day in Timezone, of ts or
+	// else of the datetime column.
+	PartitionByDate bool
+	// Timezone is the IANA zone of the datetime columns, UTC if empty.
+	Timezone string
+	// Dir is the local directory the files are written to.
+	Dir string
+}
+
+// ForRun is the request exporting the output of run, to be completed with the format and Dir.
+func ForRun(run runs.Run) Request {
+	return Request{
+		Name:       run.ID,
+		Collection: run.Output,
+		Sink:       run.Sink,
+		Image:      run.Image,
+	}
+}
@@ -0,0 +1,61 @@
+package factor
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nathanusask/docker-go-demo/interval"
+)
+
+// Args validates parameter values against the declared parameter types and returns them as
+// main.py arguments, in declaration order. Interval values are normalized and encoded so the
+// generated code does not have to parse them again. Missing parameters are not passed to
+// the factor function, leaving them to its defaults.
+func (f Factor) Args(params map[string]string) ([]string, error) {
+	declared := make(map[string]bool, len(f.ParamTypes))
+	var args []string
+	for _, pt := range f.ParamTypes {
+		declared[pt.Name] = true
+		value, ok := params[pt.Name]
+		if !ok {
+			continue
+		}
+		arg, err := paramArg(pt, value)
+		if err != nil {
+			return nil, fmt.Errorf("factor %s: parameter %s: %w", f.FactorName, pt.Name, err)
+		}
+		args = append(args, "--"+pt.Name, arg)
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("factor %s: unknown parameter %q", f.FactorName, name)
+		}
+	}
+	return args, nil
+}
+
+func paramArg(pt ParamType, value string) (string, error) {
+	switch pt.Type {
+	case IntervalType:
+		iv, err := interval.Parse(value)
+		if err != nil {
+			return "", err
+		}
+		return iv.Arg()
+	case "int":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid int %q", value)
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("invalid float %q", value)
+		}
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid bool %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package factor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   []string
+		err    string
+	}{
+		{
+			name:   "declaration order",
+			params: map[string]string{"slow": "26", "fast": "12"},
+			want:   []string{"--fast", "12", "--slow", "26"},
+		},
+		{
+			name:   "missing parameters are left out",
+			params: map[string]string{"slow": "26"},
+			want:   []string{"--slow", "26"},
+		},
+		{
+			name:   "interval",
+			params: map[string]string{"window": "5T"},
+			want:   []string{"--window", `{"freq":"5min","n":5,"unit":"min","ms":300000,"close":{"offset_ms":300000}}`},
+		},
+		{name: "none", want: nil},
+		{name: "invalid int", params: map[string]string{"fast": "1.5"}, err: "invalid int"},
+		{name: "invalid interval", params: map[string]string{"window": "5 minutes"}, err: "parameter window"},
+		{name: "unknown", params: map[string]string{"signal": "9"}, err: `unknown parameter "signal"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := macd().Args(tt.params)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Args() error = %v, want one about %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil || strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Args() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgsFloat(t *testing.T) {
+	f := Factor{FactorName: "ema", ParamTypes: []ParamType{{Name: "alpha", Type: "float"}, {Name: "label", Type: "str"}}}
+	if got, err := f.Args(map[string]string{"alpha": "0.5", "label": "x y"}); err != nil || strings.Join(got, " ") != "--alpha 0.5 --label x y" {
+		t.Errorf("Args() = %q, %v", got, err)
+	}
+	if _, err := f.Args(map[string]string{"alpha": "half"}); err == nil {
+		t.Error("Args() with an invalid float succeeded")
+	}
+}
+
+func TestArgsBool(t *testing.T) {
+	f := Factor{FactorName: "ema", ParamTypes: []ParamType{{Name: "adjust", Type: "bool"}}}
+	for value, want := range map[string]string{"true": "true", "1": "true", "False": "false", "0": "false"} {
+		if got, err := f.Args(map[string]string{"adjust": value}); err != nil || strings.Join(got, " ") != "--adjust "+want {
+			t.Errorf("Args() of %q = %q, %v", value, got, err)
+		}
+	}
+	if _, err := f.Args(map[string]string{"adjust": "yes"}); err == nil {
+		t.Error("Args() with an invalid bool succeeded")
+	}
+}
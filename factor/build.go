@@ -0,0 +1,173 @@
+package factor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+const pythonMainFilename = "main.py"
+
+// templateData is what PythonMainTemplate is executed with.
+type templateData struct {
+	Factor
+	Mongo  config.Mongo
+	Source Source
+	Sink   Sink
+}
+
+// UsesMongo reports whether main.py connects to MongoDB at all.
+func (d templateData) UsesMongo() bool {
+	return d.Source.IsMongo() || d.Sink.IsMongo()
+}
+
+// ExitTransient exposes ExitTransient to PythonMainTemplate, for TransientExit.
+func (templateData) ExitTransient() int {
+	return ExitTransient
+}
+
+// Render executes PythonMainTemplate for the factor and writes the generated main.py to w.
+// mongo provides the defaults of the connection arguments, storage selects where main.py
+// reads from and writes to.
+func Render(w io.Writer, factor Factor, mongo config.Mongo, storage Storage) error {
+	// paramItems are the items of a dict of the parameter values, keyed by name
+	paramItems := func(pts []ParamType) []string {
+		var ret []string
+		for _, pt := range pts {
+			ret = append(ret, fmt.Sprintf("%q: args.%s", pt.Name, pt.Name))
+		}
+		return ret
+	}
+
+	inputArg := func(ins []Input) []string {
+		var ret []string
+		for _, in := range ins {
+			ret = append(ret, fmt.Sprintf("%s=inputs[%q]", in.Name, in.Name))
+		}
+		return ret
+	}
+
+	pyTolerance := func(ms int64) string {
+		if ms == 0 {
+			return "None"
+		}
+		return strconv.FormatInt(ms, 10)
+	}
+
+	pyType := func(t string) string {
+		switch t {
+		case IntervalType:
+			return "Interval.from_arg"
+		case "bool":
+			return "parse_bool"
+		}
+		return t
+	}
+
+	// pyFields is the projection applied by non-MongoDB sources and fixtures, which hold
+	// bars already when the factor buckets trades
+	pyFields := func(needs Needs) string {
+		if needs.BucketMs > 0 || len(needs.Fields) == 0 {
+			return "None"
+		}
+		var quoted []string
+		for _, f := range needs.Fields {
+			quoted = append(quoted, strconv.Quote(f))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+
+	pyStrings := func(elem []string) []string {
+		var ret []string
+		for _, e := range elem {
+			ret = append(ret, strconv.Quote(e))
+		}
+		return ret
+	}
+
+	join := func(sep string, elem []string) string {
+		return strings.Join(elem, sep)
+	}
+
+	if err := factor.Validate(); err != nil {
+		return err
+	}
+	if err := storage.Validate(factor); err != nil {
+		return err
+	}
+
+	funcs := template.FuncMap{
+		"paramItems":  paramItems,
+		"inputArg":    inputArg,
+		"pyTolerance": pyTolerance,
+		"pyType":      pyType,
+		"pyFields":    pyFields,
+		"pyString":    strconv.Quote,
+		"pyStrings":   pyStrings,
+		"join":        join,
+	}
+	templ, err := template.New(factor.FactorName).Funcs(funcs).Parse(PythonMainTemplate)
+	if err != nil {
+		return err
+	}
+	return templ.Execute(w, templateData{factor, mongo, storage.Source, storage.Sink})
+}
+
+// RenderString is like Render but returns the generated main.py as a string.
+func RenderString(factor Factor, mongo config.Mongo, storage Storage) (string, error) {
+	var buf bytes.Buffer
+	if err := Render(&buf, factor, mongo, storage); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// BuildFactor renders the factor into <workspace>/<lowercase factor name>/main.py.
+func BuildFactor(ctx context.Context, factor Factor, cfg config.Config) (err error) {
+	ctx, span := tracing.Start(ctx, "BuildFactor", "factor", factor.FactorName)
+	defer func() { span.End(err) }()
+
+	_, renderSpan := tracing.Start(ctx, "render")
+	code, err := RenderString(factor, cfg.Mongo, Storage{})
+	renderSpan.End(err)
+	if err != nil {
+		return err
+	}
+
+	_, writeSpan := tracing.Start(ctx, "write")
+	defer func() { writeSpan.End(err) }()
+	dirname := path.Join(cfg.Workspace, strings.ToLower(factor.FactorName))
+	if err := os.MkdirAll(dirname, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dirname, pythonMainFilename), []byte(code), 0o644)
+}
+
+// BuildContext renders the factor together with DockerfileTemplate and Requirements into
+// <workspace>/<lowercase factor name> and returns that directory, ready for an image build.
+func BuildContext(ctx context.Context, factor Factor, cfg config.Config) (string, error) {
+	if err := BuildFactor(ctx, factor, cfg); err != nil {
+		return "", err
+	}
+	dirname := path.Join(cfg.Workspace, strings.ToLower(factor.FactorName))
+	if err := os.WriteFile(path.Join(dirname, "Dockerfile"), []byte(DockerfileTemplate), 0o644); err != nil {
+		return "", err
+	}
+	requirements := Requirements
+	for _, d := range factor.Dependencies {
+		requirements += d + "\n"
+	}
+	if err := os.WriteFile(path.Join(dirname, "requirements.txt"), []byte(requirements), 0o644); err != nil {
+		return "", err
+	}
+	return dirname, nil
+}
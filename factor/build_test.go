@@ -0,0 +1,207 @@
+package factor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/interval"
+)
+
+// compiles checks that code is valid Python, if there is a Python to tell.
+func compiles(t *testing.T, code string) {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+	cmd := exec.Command(python, "-c", "import sys; compile(sys.stdin.read(), 'main.py', 'exec')")
+	cmd.Stdin = strings.NewReader(code)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("main.py does not compile: %v\n%s", err, out)
+	}
+}
+
+func macd() Factor {
+	return Factor{
+		FactorName:  "MACD",
+		FactorCode:  "def macd(df, fast=12, slow=26):\n    return df\n",
+		Description: "moving average convergence divergence",
+		Entrypoint:  "macd",
+		ParamTypes:  []ParamType{{Name: "fast", Type: "int"}, {Name: "slow", Type: "int"}, {Name: "window", Type: IntervalType}},
+		Outputs:     []string{"macd", "signal"},
+		Needs:       Needs{Fields: []string{"price"}},
+	}
+}
+
+func TestRender(t *testing.T) {
+	joined := Factor{
+		FactorName: "spread",
+		FactorCode: "def spread(bid, ask):\n    return bid\n",
+		Inputs:     []Input{{Name: "bid"}, {Name: "ask"}},
+	}
+	asof := joined
+	asof.Alignment = Alignment{Method: AlignAsOf, Tolerance: 1000}
+	resample := joined
+	resample.Alignment = Alignment{Method: AlignResample, Interval: interval.Interval{N: 1, Unit: interval.Minute}}
+	files := Storage{
+		Source: Source{Kind: SourceFile, Options: map[string]string{OptionDir: "/data/in", OptionFormat: FormatCSV}},
+		Sink:   Sink{Kind: SinkFile, Options: map[string]string{OptionDir: "/data/out"}},
+	}
+	sql := Storage{Source: Source{Kind: SourceSQL, Options: map[string]string{OptionDSN: "host=db dbname=quant"}}}
+
+	tests := []struct {
+		name    string
+		factor  Factor
+		storage Storage
+		want    []string
+		not     []string
+	}{
+		{
+			name:   "single input",
+			factor: macd(),
+			want: []string{
+				"def macd(df, fast=12, slow=26):",
+				`parser.add_argument("--fast", type=int)`,
+				`parser.add_argument("--window", type=Interval.from_arg)`,
+				`parser.add_argument("--collection")`,
+				`parser.add_argument("--host", default="mongo")`,
+				`params = {name: value for name, value in {"fast": args.fast, "slow": args.slow, "window": args.window}.items() if value is not None}`,
+				`result = macd(data, **params)`,
+				`missing = [c for c in ["macd", "signal"] if c not in result.columns]`,
+				`output_collection = ".".join([args.task_id, "MACD"])`,
+				`data = list(get_data(args.database, args.collection, args.start, args.end, args.pipeline, ["price"]))`,
+				"mongo_client = MongoClient(mongo_uri(args))",
+			},
+			not: []string{"--input_", "align_asof(inputs"},
+		},
+		{
+			name:   "named inputs",
+			factor: joined,
+			want: []string{
+				`parser.add_argument("--input_bid")`,
+				`parser.add_argument("--pipeline_ask")`,
+				`result = spread(bid=inputs["bid"], ask=inputs["ask"], **params)`,
+			},
+			not: []string{`parser.add_argument("--collection")`, "inputs = align_"},
+		},
+		{
+			name:   "quoted description",
+			factor: Factor{FactorName: "ema", FactorCode: "def ema(df):\n    return df\n", Description: "the \"fast\" EMA\nof C:\\prices"},
+			want:   []string{`argparse.ArgumentParser(description="the \"fast\" EMA\nof C:\\prices")`},
+		},
+		{
+			name:   "bool parameter",
+			factor: Factor{FactorName: "ema", FactorCode: "def ema(df, adjust=True):\n    return df\n", ParamTypes: []ParamType{{Name: "adjust", Type: "bool"}}},
+			want:   []string{`parser.add_argument("--adjust", type=parse_bool)`},
+		},
+		{
+			name:   "aligned as of",
+			factor: asof,
+			want:   []string{"inputs = align_asof(inputs, 1000)"},
+		},
+		{
+			name:   "resampled",
+			factor: resample,
+			want:   []string{`inputs = align_resample(inputs, "1min")`},
+		},
+		{
+			name:    "files",
+			factor:  macd(),
+			storage: files,
+			want: []string{
+				`read_file(os.path.join("/data/in", collection + ".csv"), start, end, fields)`,
+				`write_file(result, os.path.join("/data/out", collection + ".parquet"))`,
+			},
+			not: []string{"MongoClient"},
+		},
+		{
+			name:    "sql",
+			factor:  macd(),
+			storage: sql,
+			want:    []string{"import psycopg2", `psycopg2.connect("host=db dbname=quant")`, "staging.rename(collection, dropTarget=True)"},
+		},
+	}
+	mongo := config.Mongo{Host: "mongo", Port: 27017, Database: "quant"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := RenderString(tt.factor, mongo, tt.storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(code, s) {
+					t.Errorf("main.py lacks %s", s)
+				}
+			}
+			for _, s := range tt.not {
+				if strings.Contains(code, s) {
+					t.Errorf("main.py has %s", s)
+				}
+			}
+			compiles(t, code)
+		})
+	}
+}
+
+func TestRenderMongoDefaults(t *testing.T) {
+	mongo := config.Mongo{Host: "mongo", Port: 27017, Database: `q"uant`, AuthSource: "admin", ReplicaSet: "rs\\0", TLS: true, TLSCAFile: "/etc/ca\n.pem"}
+	code, err := RenderString(macd(), mongo, Storage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`parser.add_argument("--database", default="q\"uant")`,
+		`parser.add_argument("--auth_source", default="admin")`,
+		`parser.add_argument("--replica_set", default="rs\\0")`,
+		`parser.add_argument("--tls", default="true")`,
+		`parser.add_argument("--tls_ca_file", default="/etc/ca\n.pem")`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Errorf("main.py lacks %s", s)
+		}
+	}
+	compiles(t, code)
+}
+
+func TestRenderInvalid(t *testing.T) {
+	f := macd()
+	f.FactorName = "MACD signal"
+	if _, err := RenderString(f, config.Mongo{}, Storage{}); err == nil {
+		t.Error("RenderString() of an invalid factor succeeded")
+	}
+	if _, err := RenderString(macd(), config.Mongo{}, Storage{Sink: Sink{Kind: "s3"}}); err == nil {
+		t.Error("RenderString() with an unknown sink succeeded")
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	f := macd()
+	f.Dependencies = []string{"ta-lib==0.4.0"}
+	dir, err := BuildContext(context.Background(), f, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != filepath.Join(cfg.Workspace, "macd") {
+		t.Errorf("BuildContext() = %s", dir)
+	}
+	for name, want := range map[string]string{
+		pythonMainFilename: "def macd(",
+		"Dockerfile":       "COPY . .",
+		"requirements.txt": "pymongo\npandas\npyarrow\npsycopg2-binary\nta-lib==0.4.0\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%s =\n%s\nwant it to hold %q", name, b, want)
+		}
+	}
+}
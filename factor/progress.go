@@ -0,0 +1,78 @@
+package factor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ProgressPrefix starts the lines the generated main.py prints to report progress; the
+	// rest of the line is a JSON Progress event.
+	ProgressPrefix = "##factor-progress "
+	// ProgressFilename is the file in a run's working directory the executor keeps the
+	// progress of the run in while it runs.
+	ProgressFilename = "progress.json"
+)
+
+// Progress is the live status of a run, as reported by main.py. An event only sets the
+// fields it holds, metrics being merged by name, so a run can report metrics of its own
+// in between the events of the wrapper.
+type Progress struct {
+	// Phase is get_data, compute, handle_result or done.
+	Phase   string  `json:"phase"`
+	Percent float64 `json:"percent"`
+	// Rows is the number of rows of the phase so far: read while getting data, written
+	// while handling the result.
+	Rows    int64                  `json:"rows"`
+	Metrics map[string]interface{} `json:"metrics,omitempty"`
+	// UpdatedAt is when the last event arrived, set by the orchestrator.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Apply applies the JSON event to p.
+func (p *Progress) Apply(event []byte) error {
+	next := *p
+	if p.Metrics != nil {
+		next.Metrics = make(map[string]interface{}, len(p.Metrics))
+		for k, v := range p.Metrics {
+			next.Metrics[k] = v
+		}
+	}
+	if err := json.Unmarshal(event, &next); err != nil {
+		return err
+	}
+	next.UpdatedAt = time.Now()
+	*p = next
+	return nil
+}
+
+// ReadProgress reads the progress of the run working in dir; ok is false when it reported none.
+func ReadProgress(dir string) (p Progress, ok bool, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, ProgressFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return p, false, nil
+	}
+	if err != nil {
+		return p, false, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, false, err
+	}
+	return p, true, nil
+}
+
+// WriteProgress replaces the progress file of dir, atomically for concurrent readers.
+func WriteProgress(dir string, p Progress) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ProgressFilename+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, ProgressFilename))
+}
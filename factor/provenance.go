@@ -0,0 +1,49 @@
+package factor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// StatsFilename is the file the generated main.py writes its Stats to, in its working directory.
+const StatsFilename = "run_stats.json"
+
+// Stats are the row counts of a factor run, reported by the generated main.py.
+type Stats struct {
+	// RowsIn is the number of rows read over every input.
+	RowsIn int64 `json:"rows_in"`
+	// RowsOut is the number of rows of the result.
+	RowsOut int64 `json:"rows_out"`
+}
+
+// ReadStats reads the Stats a run wrote into its working directory dir.
+func ReadStats(dir string) (Stats, error) {
+	var stats Stats
+	b, err := os.ReadFile(filepath.Join(dir, StatsFilename))
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(b, &stats)
+	return stats, err
+}
+
+// Version identifies the definition of the factor: it is the start of the hash of its
+// JSON encoding, so any change to the code, parameters or inputs makes a new version.
+func (f Factor) Version() string {
+	b, err := json.Marshal(f)
+	if err != nil {
+		// a Factor only holds strings, numbers and intervals, all of which marshal
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:6])
+}
+
+// CodeHash is the hash of a generated main.py.
+func CodeHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
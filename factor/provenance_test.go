@@ -0,0 +1,41 @@
+package factor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeHash(t *testing.T) {
+	a, b := CodeHash("print(1)"), CodeHash("print(2)")
+	if !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+64 || a == b {
+		t.Errorf("CodeHash() = %s, %s", a, b)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	f := macd()
+	v := f.Version()
+	if len(v) != 12 || macd().Version() != v {
+		t.Errorf("Version() = %s, want 12 stable hex digits", v)
+	}
+	f.FactorCode += "\n"
+	if f.Version() == v {
+		t.Error("Version() did not change with the code")
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, StatsFilename), []byte(`{"rows_in": 10, "rows_out": 4}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ReadStats(dir)
+	if err != nil || stats != (Stats{RowsIn: 10, RowsOut: 4}) {
+		t.Errorf("ReadStats() = %+v, %v", stats, err)
+	}
+	if _, err := ReadStats(t.TempDir()); err == nil {
+		t.Error("ReadStats() without stats succeeded")
+	}
+}
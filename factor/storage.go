@@ -0,0 +1,161 @@
+package factor
+
+import (
+	"fmt"
+	"path"
+)
+
+type SourceKind string
+
+const (
+	// SourceMongo reads collections with the aggregation pipelines built by the orchestrator.
+	SourceMongo SourceKind = "mongo"
+	// SourceFile reads <dir>/<collection>.<format> files.
+	SourceFile SourceKind = "file"
+	// SourceSQL reads tables of a PostgreSQL compatible database such as TimescaleDB,
+	// with ts as a column of milliseconds.
+	SourceSQL SourceKind = "sql"
+)
+
+type SinkKind string
+
+const (
+	SinkMongo SinkKind = "mongo"
+	// SinkFile writes <dir>/<output collection>.<format> files.
+	SinkFile SinkKind = "file"
+)
+
+// File formats of SourceFile and SinkFile, named after their file extension.
+const (
+	FormatParquet = "parquet"
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+)
+
+// Options understood by the sources and sinks. Paths are as seen by main.py, so with the
+// docker executor dir has to be on a volume mounted through Docker.Volumes.
+const (
+	OptionDir    = "dir"
+	OptionFormat = "format"
+	// OptionDSN is the libpq connection string of SourceSQL. It is recorded with the run,
+	// so passwords belong in a passfile rather than in the string itself.
+	OptionDSN = "dsn"
+)
+
+// Source is where the generated main.py reads its inputs from; the zero value is MongoDB.
+type Source struct {
+	Kind    SourceKind        `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// Sink is where the generated main.py writes its result to; the zero value is MongoDB.
+type Sink struct {
+	Kind    SinkKind          `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// Storage selects the loader and writer code emitted into main.py.
+type Storage struct {
+	Source Source
+	Sink   Sink
+}
+
+func (s Source) IsMongo() bool {
+	return s.Kind == "" || s.Kind == SourceMongo
+}
+
+// Format is the file format of SourceFile, parquet by default.
+func (s Source) Format() string {
+	return formatOption(s.Options)
+}
+
+// Path is the file SourceFile reads for collection.
+func (s Source) Path(collection string) string {
+	return path.Join(s.Options[OptionDir], collection+"."+s.Format())
+}
+
+func (s Sink) IsMongo() bool {
+	return s.Kind == "" || s.Kind == SinkMongo
+}
+
+// Format is the file format of SinkFile, parquet by default.
+func (s Sink) Format() string {
+	return formatOption(s.Options)
+}
+
+// Path is the file SinkFile writes for collection.
+func (s Sink) Path(collection string) string {
+	return path.Join(s.Options[OptionDir], collection+"."+s.Format())
+}
+
+// Reads reports whether the source reads what the sink writes, so that an upstream node
+// writing to sink can feed a downstream node reading from the source.
+func (s Source) Reads(sink Sink) bool {
+	switch {
+	case s.IsMongo():
+		return sink.IsMongo()
+	case s.Kind == SourceFile && sink.Kind == SinkFile:
+		return s.Options[OptionDir] == sink.Options[OptionDir] && s.Format() == sink.Format()
+	}
+	return false
+}
+
+func formatOption(options map[string]string) string {
+	if f := options[OptionFormat]; f != "" {
+		return f
+	}
+	return FormatParquet
+}
+
+// Validate checks the options of the source and sink and that the factor reads nothing
+// the source cannot provide: bucketing and bars are only built by MongoDB pipelines.
+func (s Storage) Validate(f Factor) error {
+	switch s.Source.Kind {
+	case "", SourceMongo:
+	case SourceFile:
+		if err := validateFile(s.Source.Options); err != nil {
+			return fmt.Errorf("source %s: %w", s.Source.Kind, err)
+		}
+	case SourceSQL:
+		if s.Source.Options[OptionDSN] == "" {
+			return fmt.Errorf("source %s: option %s is required", s.Source.Kind, OptionDSN)
+		}
+	default:
+		return fmt.Errorf("unknown source %q", s.Source.Kind)
+	}
+	switch s.Sink.Kind {
+	case "", SinkMongo:
+	case SinkFile:
+		if err := validateFile(s.Sink.Options); err != nil {
+			return fmt.Errorf("sink %s: %w", s.Sink.Kind, err)
+		}
+	default:
+		return fmt.Errorf("unknown sink %q", s.Sink.Kind)
+	}
+
+	if s.Source.IsMongo() {
+		return nil
+	}
+	needs := []Needs{f.Needs}
+	for _, in := range f.Inputs {
+		needs = append(needs, in.Needs)
+	}
+	for _, n := range needs {
+		if n.BucketMs > 0 || !n.Bars.IsZero() {
+			return fmt.Errorf("factor %s: source %s cannot bucket trades into bars", f.FactorName, s.Source.Kind)
+		}
+	}
+	return nil
+}
+
+func validateFile(options map[string]string) error {
+	if options[OptionDir] == "" {
+		return fmt.Errorf("option %s is required", OptionDir)
+	}
+	switch f := formatOption(options); f {
+	case FormatParquet, FormatCSV, FormatJSONL:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", f)
+	}
+}
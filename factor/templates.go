@@ -0,0 +1,317 @@
+package factor
+
+import (
+	"github.com/nathanusask/docker-go-demo/secrets"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+// MongoConnection connects to MongoDB from the parsed connection arguments, authenticating
+// with the credentials the orchestrator injected as a file or environment variables.
+const MongoConnection = `# connect to MongoDB, authenticating with the injected credentials if there are any
+def mongo_uri(args):
+    creds = {}
+    if os.path.exists("` + secrets.MongoMountPath + `"):
+        with open("` + secrets.MongoMountPath + `") as f:
+            creds = json.load(f)
+    elif os.environ.get("` + secrets.MongoEnvUsername + `"):
+        creds = {"username": os.environ["` + secrets.MongoEnvUsername + `"], "password": os.environ.get("` + secrets.MongoEnvPassword + `", "")}
+    auth = ""
+    if creds.get("username"):
+        auth = quote_plus(creds["username"]) + ":" + quote_plus(creds.get("password", "")) + "@"
+    options = {}
+    if args.auth_source:
+        options["authSource"] = args.auth_source
+    if args.replica_set:
+        options["replicaSet"] = args.replica_set
+    if str(args.tls).lower() == "true":
+        options["tls"] = "true"
+        if args.tls_ca_file:
+            options["tlsCAFile"] = args.tls_ca_file
+    uri = "mongodb://%s%s:%d/" % (auth, args.host, args.port)
+    if options:
+        uri += "?" + urlencode(options)
+    return uri
+
+mongo_client = MongoClient(mongo_uri(args))
+`
+
+// TraceSpan records spans as children of the span the orchestrator passed in the environment,
+// for the orchestrator to export after the run. Nothing is recorded without one.
+const TraceSpan = `# record a span of the trace the orchestrator passed, yielding its attributes
+trace_parent = os.environ.get("` + tracing.EnvTraceparent + `", "").split("-")
+
+@contextlib.contextmanager
+def trace_span(name, **attributes):
+    record = {"name": name, "attributes": attributes, "start_unix_nano": time.time_ns()}
+    try:
+        yield attributes
+    except Exception as e:
+        record["error"] = repr(e)
+        raise
+    finally:
+        if len(trace_parent) == 4:
+            record.update(trace_id=trace_parent[1], span_id=os.urandom(8).hex(), parent_span_id=trace_parent[2], end_unix_nano=time.time_ns())
+            with open("` + tracing.SpansFilename + `", "a") as f:
+                f.write(json.dumps(record, default=str) + "\n")
+`
+
+// ReportProgress prints progress events for the orchestrator, which takes lines starting
+// with ProgressPrefix out of the output. Factor functions may call it to report metrics.
+const ReportProgress = `# report progress to the orchestrator; keyword arguments are reported as metrics
+def report_progress(phase, percent=None, rows=None, **metrics):
+    event = {"phase": phase}
+    if percent is not None:
+        event["percent"] = percent
+    if rows is not None:
+        event["rows"] = rows
+    if metrics:
+        event["metrics"] = metrics
+    print("` + ProgressPrefix + `" + json.dumps(event, default=str), flush=True)
+`
+
+// ExitTransient is the exit status of main.py when it failed on I/O that may succeed when
+// retried, such as a lost MongoDB connection. It is EX_TEMPFAIL of sysexits.h.
+const ExitTransient = 75
+
+// TransientExit makes main.py exit with ExitTransient on an uncaught exception of the
+// transient_errors classes, after printing it as usual.
+const TransientExit = `# exit with the status the orchestrator retries on when I/O failed transiently
+def exit_transient(kind, value, traceback):
+    sys.__excepthook__(kind, value, traceback)
+    if issubclass(kind, transient_errors):
+        sys.stdout.flush()
+        sys.stderr.flush()
+        os._exit({{ .ExitTransient }})
+
+sys.excepthook = exit_transient
+`
+
+const PythonMainTemplate = `import argparse
+import contextlib
+import datetime
+import json
+import os
+import sys
+import time
+import pandas as pd
+from urllib.parse import quote_plus, urlencode
+{{ .FactorCode }}
+{{ if .UsesMongo }}from pymongo import MongoClient
+from pymongo.errors import ConnectionFailure
+{{ end -}}
+{{ if eq .Source.Kind "sql" }}import psycopg2
+from psycopg2 import sql as pgsql
+{{ end -}}
+
+# Interval is an interval parameter, parsed and normalized by the orchestrator
+class Interval:
+    def __init__(self, freq, n, unit, ms=None, close=None):
+        self.freq = freq
+        self.n = n
+        self.unit = unit
+        self.ms = ms
+        self.close_rule = close or {}
+
+    @staticmethod
+    def from_arg(arg):
+        return Interval(**json.loads(arg))
+
+    # relabel bar open datetimes with the bar close
+    def close(self, opens):
+        if not self.close_rule.get("date_only"):
+            return opens + datetime.timedelta(milliseconds=self.close_rule.get("offset_ms", 0))
+        return opens.dt.date + datetime.timedelta(days=self.close_rule.get("plus_days", 0))
+
+    def __str__(self):
+        return self.freq
+
+# parse_bool parses a bool parameter, normalized by the orchestrator to "true" or "false"
+def parse_bool(arg):
+    return arg == "true"
+
+parser = argparse.ArgumentParser(description={{ pyString .Description }})
+{{ range .ParamTypes }}parser.add_argument("--{{ .Name }}", type={{ pyType .Type }}){{"\n"}}{{ end }}
+parser.add_argument("--task_id")
+parser.add_argument("--host", default={{ pyString .Mongo.Host }})
+parser.add_argument("--port", type=int, default={{ .Mongo.Port }})
+parser.add_argument("--database", default={{ pyString .Mongo.Database }})
+parser.add_argument("--auth_source", default={{ pyString .Mongo.AuthSource }})
+parser.add_argument("--replica_set", default={{ pyString .Mongo.ReplicaSet }})
+parser.add_argument("--tls", default={{ pyString (print .Mongo.TLS) }})
+parser.add_argument("--tls_ca_file", default={{ pyString .Mongo.TLSCAFile }})
+{{ if .Inputs }}{{ range .Inputs }}parser.add_argument("--input_{{ .Name }}")
+parser.add_argument("--pipeline_{{ .Name }}"){{"\n"}}{{ end }}{{ else }}parser.add_argument("--collection")
+parser.add_argument("--pipeline")
+{{ end -}}
+parser.add_argument("--start", type=int, default=0)
+parser.add_argument("--end", type=int, default=-1)
+parser.add_argument("--fixture_dir", default="")
+parser.add_argument("--output_file", default="")
+
+args = parser.parse_args()
+
+transient_errors = (ConnectionError, TimeoutError{{ if .UsesMongo }}, ConnectionFailure{{ end }}{{ if eq .Source.Kind "sql" }}, psycopg2.OperationalError{{ end }})
+
+` + TransientExit + `
+{{ if .UsesMongo }}` + MongoConnection + `{{ end }}
+` + TraceSpan + `
+` + ReportProgress + `
+# read a CSV, Parquet or JSON lines file holding the documents of a collection
+def read_file(path, start, end, fields=None):
+    if path.endswith(".csv"):
+        df = pd.read_csv(path)
+    elif path.endswith(".parquet"):
+        df = pd.read_parquet(path)
+    else:
+        df = pd.read_json(path, lines=True, convert_dates=False)
+    if start < end:
+        df = df[(df["ts"] >= start) & (df["ts"] < end)]
+    if fields:
+        df = df[["ts"] + fields]
+    return df.to_dict("records")
+
+# write a result as a CSV, Parquet or JSON lines file
+def write_file(result, path):
+    if path.endswith(".csv"):
+        result.to_csv(path, index=False)
+    elif path.endswith(".parquet"):
+        result.to_parquet(path, index=False)
+    else:
+        result.to_json(path, orient="records", lines=True, date_format="iso")
+
+# get data, from fixtures in test mode
+def get_data(database, collection, start, end, pipeline=None, fields=None):
+    if args.fixture_dir:
+        return read_file(os.path.join(args.fixture_dir, collection), start, end, fields)
+{{- if eq .Source.Kind "file" }}
+    return read_file(os.path.join({{ pyString (index .Source.Options "dir") }}, collection + ".{{ .Source.Format }}"), start, end, fields)
+{{- else if eq .Source.Kind "sql" }}
+    columns = pgsql.SQL(", ").join(pgsql.Identifier(f) for f in ["ts"] + fields) if fields else pgsql.SQL("*")
+    query = pgsql.SQL("SELECT {} FROM {}").format(columns, pgsql.Identifier(*collection.split(".")))
+    params = []
+    if start < end:
+        query += pgsql.SQL(" WHERE ts >= %s AND ts < %s")
+        params = [start, end]
+    query += pgsql.SQL(" ORDER BY ts")
+    conn = psycopg2.connect({{ pyString (index .Source.Options "dsn") }})
+    try:
+        return pd.read_sql_query(query.as_string(conn), conn, params=params).to_dict("records")
+    finally:
+        conn.close()
+{{- else }}
+    # use the aggregation pipeline built by the orchestrator when there is one
+    db = mongo_client[database]
+    coll = db[collection]
+    if pipeline:
+        return coll.aggregate(json.loads(pipeline))
+    pipeline = []
+    if start < end:
+        pipeline.append({"$match": {"ts": {"$gte": start, "$lt": end}}})
+    pipeline.append({'$project': {'_id': 0}})
+    return coll.aggregate(pipeline)
+{{- end }}
+
+# handle result
+def handle_result(result, database, collection):
+    assert isinstance(result, pd.DataFrame)
+    if args.output_file:
+        write_file(result, args.output_file)
+        return
+{{- if eq .Sink.Kind "file" }}
+    write_file(result, os.path.join({{ pyString (index .Sink.Options "dir") }}, collection + ".{{ .Sink.Format }}"))
+{{- else }}
+    # written aside and renamed over the collection, so that a run retried after failing
+    # mid-write replaces the rows of the failed attempt rather than adding to them
+    db = mongo_client[database]
+    staging = db[collection + ".staging"]
+    staging.drop()
+    if len(result) == 0:
+        db[collection].drop()
+        return
+    staging.insert_many(result.to_dict("records"))
+    staging.rename(collection, dropTarget=True)
+{{- end }}
+{{ if .Inputs }}
+# align every input onto the timestamps of the first input
+def align_asof(frames, tolerance):
+    names = list(frames)
+    base = frames[names[0]].sort_values("ts").reset_index(drop=True)
+    aligned = {names[0]: base}
+    for name in names[1:]:
+        other = frames[name].sort_values("ts")
+        aligned[name] = pd.merge_asof(base[["ts"]], other, on="ts", direction="backward", tolerance=tolerance)
+    return aligned
+
+# resample every input to a common interval, forward filling gaps
+def align_resample(frames, interval):
+    resampled = {}
+    for name, df in frames.items():
+        df = df.copy()
+        df["datetime"] = pd.to_datetime(df["ts"], unit="ms")
+        resampled[name] = df.set_index("datetime").resample(interval).last()
+    index = None
+    for df in resampled.values():
+        index = df.index if index is None else index.union(df.index)
+    aligned = {}
+    for name, df in resampled.items():
+        df = df.reindex(index).ffill()
+        df["ts"] = df.index.astype("int64") // 1000000
+        aligned[name] = df.reset_index()
+    return aligned
+
+report_progress("get_data", percent=0, rows=0)
+inputs = {}
+{{ range .Inputs }}with trace_span("get_data", input="{{ .Name }}", collection=args.input_{{ .Name }}) as attributes:
+    inputs["{{ .Name }}"] = pd.DataFrame(list(get_data(args.database, args.input_{{ .Name }}, args.start, args.end, args.pipeline_{{ .Name }}, {{ pyFields .Needs }})))
+    attributes["rows"] = len(inputs["{{ .Name }}"])
+report_progress("get_data", percent=40 * len(inputs) // {{ len $.Inputs }}, rows=sum(len(df) for df in inputs.values()))
+{{ end -}}
+rows_in = sum(len(df) for df in inputs.values())
+{{ if eq .Alignment.Method "asof" }}inputs = align_asof(inputs, {{ pyTolerance .Alignment.Tolerance }}){{"\n"}}{{ end -}}
+{{ if eq .Alignment.Method "resample" }}inputs = align_resample(inputs, "{{ .Alignment.Interval.String }}"){{"\n"}}{{ end -}}
+{{ else }}
+report_progress("get_data", percent=0, rows=0)
+with trace_span("get_data", collection=args.collection) as attributes:
+    data = list(get_data(args.database, args.collection, args.start, args.end, args.pipeline, {{ pyFields .Needs }}))
+    attributes["rows"] = len(data)
+rows_in = len(data)
+{{ end }}
+report_progress("compute", percent=40, rows=rows_in)
+# parameters not passed are left to the defaults of {{ .Function }}
+params = {name: value for name, value in { {{- paramItems .ParamTypes | join ", " -}} }.items() if value is not None}
+with trace_span("compute", factor="{{ .FactorName }}", function="{{ .Function }}") as attributes:
+    result = {{ .Function }}({{ if .Inputs }}{{ inputArg .Inputs | join ", " }}{{ else }}data{{ end }}, **params)
+    attributes["rows"] = len(result)
+
+{{ if .Outputs }}missing = [c for c in [{{ pyStrings .Outputs | join ", " }}] if c not in result.columns]
+if missing:
+    raise ValueError("{{ .FactorName }} did not return the declared outputs %s" % missing)
+
+{{ end -}}
+# handle result
+output_collection = ".".join([args.task_id, "{{ .FactorName }}"])
+report_progress("handle_result", percent=80, rows=0)
+with trace_span("handle_result", collection=output_collection, rows=len(result)):
+    handle_result(result, args.database, output_collection)
+report_progress("done", percent=100, rows=len(result))
+
+# row counts recorded by the orchestrator
+with open("` + StatsFilename + `", "w") as f:
+    json.dump({"rows_in": rows_in, "rows_out": len(result)}, f)
+{{ if .UsesMongo }}
+mongo_client.close()
+{{ end }}`
+
+const DockerfileTemplate = `FROM python:3.10
+
+WORKDIR /app
+COPY . .
+
+RUN pip install -r requirements.txt --no-cache-dir
+`
+
+const Requirements = `pymongo
+pandas
+pyarrow
+psycopg2-binary
+`
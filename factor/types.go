@@ -0,0 +1,73 @@
+package factor
+
+import "github.com/nathanusask/docker-go-demo/interval"
+
+// ParamType is a factor parameter. Type is one of the Python types "int", "float", "str"
+// and "bool", or "interval" for pandas frequencies parsed on the Go side.
+type ParamType struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+}
+
+const IntervalType = "interval"
+
+// Needs declares what a factor reads from an input collection, so the orchestrator can push
+// filtering, projection and bucketing down into the MongoDB aggregation pipeline.
+type Needs struct {
+	// Fields are the fields read besides ts; empty means every field.
+	Fields []string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	// BucketMs aggregates trades into OHLCV bars of this many milliseconds when positive.
+	BucketMs int64 `yaml:"bucket_ms,omitempty" json:"bucket_ms,omitempty"`
+	// Bars reads cached OHLCV bars at this fixed interval instead of raw trades.
+	Bars interval.Interval `yaml:"bars,omitempty" json:"bars,omitempty"`
+}
+
+// Input is a named input collection. The generated main.py loads each input into its own
+// DataFrame and passes it to the factor function as a keyword argument of the same name.
+type Input struct {
+	Name  string `yaml:"name" json:"name"`
+	Needs Needs  `yaml:"needs,omitempty" json:"needs,omitempty"`
+}
+
+type AlignMethod string
+
+const (
+	AlignNone     AlignMethod = ""
+	AlignAsOf     AlignMethod = "asof"
+	AlignResample AlignMethod = "resample"
+)
+
+// Alignment describes how multiple inputs are aligned on ts before the factor function is called.
+type Alignment struct {
+	Method AlignMethod `yaml:"method,omitempty" json:"method,omitempty"`
+	// Interval is the interval every input is resampled to, used by AlignResample.
+	Interval interval.Interval `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// Tolerance is the maximum distance in milliseconds of an AlignAsOf match, zero means unlimited.
+	Tolerance int64 `yaml:"tolerance,omitempty" json:"tolerance,omitempty"`
+}
+
+type Factor struct {
+	FactorName  string      `yaml:"name" json:"name"`
+	FactorCode  string      `yaml:"code" json:"code"`
+	Description string      `yaml:"description" json:"description"`
+	ParamTypes  []ParamType `yaml:"params,omitempty" json:"params,omitempty"`
+	// Entrypoint is the function of FactorCode computing the factor, FactorName if empty.
+	Entrypoint string `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	// Dependencies are pip requirements installed on top of Requirements.
+	Dependencies []string `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	// Outputs are the columns the factor function must return.
+	Outputs []string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+	// Needs applies to the single --collection input.
+	Needs Needs `yaml:"needs,omitempty" json:"needs,omitempty"`
+	// Inputs is empty for factors reading the single --collection input.
+	Inputs    []Input   `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	Alignment Alignment `yaml:"alignment,omitempty" json:"alignment,omitempty"`
+}
+
+// Function is the name of the factor function called by the generated main.py.
+func (f Factor) Function() string {
+	if f.Entrypoint != "" {
+		return f.Entrypoint
+	}
+	return f.FactorName
+}
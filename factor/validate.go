@@ -0,0 +1,123 @@
+package factor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// paramTypes are the types a parameter may have.
+var paramTypes = map[string]bool{"int": true, "float": true, "str": true, "bool": true, IntervalType: true}
+
+// reservedParams are the flags main.py parses itself, which parameters cannot be named
+// after; those of inputs have the prefixes in reservedParamPrefixes.
+var (
+	reservedParams = map[string]bool{
+		"task_id": true, "host": true, "port": true, "database": true, "collection": true, "pipeline": true,
+		"start": true, "end": true, "fixture_dir": true, "output_file": true,
+		"auth_source": true, "replica_set": true, "tls": true, "tls_ca_file": true,
+	}
+	reservedParamPrefixes = []string{"input_", "pipeline_"}
+)
+
+func reservedParam(name string) bool {
+	if reservedParams[name] {
+		return true
+	}
+	for _, prefix := range reservedParamPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the factor renders into a valid main.py.
+func (f Factor) Validate() error {
+	if !identifierRegexp.MatchString(f.FactorName) {
+		return fmt.Errorf("factor name %q is not a valid Python identifier", f.FactorName)
+	}
+	if !identifierRegexp.MatchString(f.Function()) {
+		return fmt.Errorf("factor %s: entrypoint %q is not a valid Python identifier", f.FactorName, f.Function())
+	}
+	for _, o := range f.Outputs {
+		if o == "" {
+			return fmt.Errorf("factor %s: empty output column", f.FactorName)
+		}
+	}
+	for _, d := range f.Dependencies {
+		if strings.TrimSpace(d) == "" || strings.ContainsAny(d, "\n\r") {
+			return fmt.Errorf("factor %s: invalid dependency %q", f.FactorName, d)
+		}
+	}
+	if err := f.Needs.validate(); err != nil {
+		return fmt.Errorf("factor %s: %w", f.FactorName, err)
+	}
+	params := make(map[string]bool)
+	for _, pt := range f.ParamTypes {
+		if !identifierRegexp.MatchString(pt.Name) {
+			return fmt.Errorf("factor %s: parameter name %q is not a valid Python identifier", f.FactorName, pt.Name)
+		}
+		if reservedParam(pt.Name) {
+			return fmt.Errorf("factor %s: parameter %q clashes with an argument of main.py", f.FactorName, pt.Name)
+		}
+		if !paramTypes[pt.Type] {
+			return fmt.Errorf("factor %s: parameter %s: unknown type %q", f.FactorName, pt.Name, pt.Type)
+		}
+		if params[pt.Name] {
+			return fmt.Errorf("factor %s: duplicate parameter %q", f.FactorName, pt.Name)
+		}
+		params[pt.Name] = true
+	}
+	seen := make(map[string]bool)
+	for _, in := range f.Inputs {
+		if err := in.Needs.validate(); err != nil {
+			return fmt.Errorf("factor %s: input %s: %w", f.FactorName, in.Name, err)
+		}
+		if !identifierRegexp.MatchString(in.Name) {
+			return fmt.Errorf("factor %s: input name %q is not a valid Python identifier", f.FactorName, in.Name)
+		}
+		if seen[in.Name] {
+			return fmt.Errorf("factor %s: duplicate input %q", f.FactorName, in.Name)
+		}
+		seen[in.Name] = true
+	}
+	switch f.Alignment.Method {
+	case AlignNone:
+	case AlignAsOf, AlignResample:
+		if len(f.Inputs) < 2 {
+			return fmt.Errorf("factor %s: alignment %q needs at least two inputs", f.FactorName, f.Alignment.Method)
+		}
+		if f.Alignment.Method == AlignResample && f.Alignment.Interval.IsZero() {
+			return fmt.Errorf("factor %s: alignment %q needs an interval", f.FactorName, f.Alignment.Method)
+		}
+	default:
+		return fmt.Errorf("factor %s: unknown alignment %q", f.FactorName, f.Alignment.Method)
+	}
+	return nil
+}
+
+func (n Needs) validate() error {
+	if n.Bars.IsZero() {
+		return nil
+	}
+	if n.BucketMs > 0 {
+		return fmt.Errorf("bars and bucketing are mutually exclusive")
+	}
+	if !n.Bars.Fixed() {
+		return fmt.Errorf("bars need a fixed-width interval, got %s", n.Bars)
+	}
+	return nil
+}
+
+// HasInput reports whether the factor declares the named input.
+func (f Factor) HasInput(name string) bool {
+	for _, in := range f.Inputs {
+		if in.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package factor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/interval"
+)
+
+func TestValidate(t *testing.T) {
+	minute := interval.Interval{N: 1, Unit: interval.Minute}
+	tests := []struct {
+		name   string
+		modify func(*Factor)
+		err    string
+	}{
+		{"valid", func(*Factor) {}, ""},
+		{"name", func(f *Factor) { f.FactorName = "macd-signal" }, "factor name"},
+		{"entrypoint", func(f *Factor) { f.Entrypoint = "macd()" }, "entrypoint"},
+		{"empty output", func(f *Factor) { f.Outputs = []string{"macd", ""} }, "empty output"},
+		{"dependency", func(f *Factor) { f.Dependencies = []string{"pandas\n--index-url evil"} }, "invalid dependency"},
+		{"parameter name", func(f *Factor) { f.ParamTypes[0].Name = "fast window" }, "parameter name"},
+		{"duplicate parameter", func(f *Factor) { f.ParamTypes[1].Name = "fast" }, "duplicate parameter"},
+		{"parameter type", func(f *Factor) { f.ParamTypes[0].Type = "list" }, `unknown type "list"`},
+		{"untyped parameter", func(f *Factor) { f.ParamTypes[0].Type = "" }, "unknown type"},
+		{"parameter named after a flag", func(f *Factor) { f.ParamTypes[0].Name = "start" }, "clashes"},
+		{"parameter named after a Mongo flag", func(f *Factor) { f.ParamTypes[0].Name = "tls_ca_file" }, "clashes"},
+		{"parameter named after an input flag", func(f *Factor) { f.ParamTypes[0].Name = "input_bid" }, "clashes"},
+		{"parameter named after a pipeline flag", func(f *Factor) { f.ParamTypes[0].Name = "pipeline_bid" }, "clashes"},
+		{"input name", func(f *Factor) { f.Inputs = []Input{{Name: "bid-ask"}} }, "input name"},
+		{"duplicate input", func(f *Factor) { f.Inputs = []Input{{Name: "bid"}, {Name: "bid"}} }, "duplicate input"},
+		{"alignment of one input", func(f *Factor) {
+			f.Inputs = []Input{{Name: "bid"}}
+			f.Alignment = Alignment{Method: AlignAsOf}
+		}, "at least two inputs"},
+		{"resampling without interval", func(f *Factor) {
+			f.Inputs = []Input{{Name: "bid"}, {Name: "ask"}}
+			f.Alignment = Alignment{Method: AlignResample}
+		}, "needs an interval"},
+		{"unknown alignment", func(f *Factor) { f.Alignment = Alignment{Method: "nearest"} }, "unknown alignment"},
+		{"bars and bucketing", func(f *Factor) { f.Needs = Needs{Bars: minute, BucketMs: 60000} }, "mutually exclusive"},
+		{"calendar bars", func(f *Factor) { f.Needs = Needs{Bars: interval.Interval{N: 1, Unit: interval.Month}} }, "fixed-width"},
+		{"input bars", func(f *Factor) {
+			f.Inputs = []Input{{Name: "bid", Needs: Needs{Bars: interval.Interval{N: 1, Unit: interval.Month}}}}
+		}, "input bid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := macd()
+			tt.modify(&f)
+			err := f.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Validate() error = %v, want one about %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestHasInput(t *testing.T) {
+	f := Factor{Inputs: []Input{{Name: "bid"}, {Name: "ask"}}}
+	if !f.HasInput("ask") || f.HasInput("mid") {
+		t.Error("HasInput() does not match the declared inputs")
+	}
+}
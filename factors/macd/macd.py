@@ -0,0 +1,16 @@
+import pandas as pd
+
+def MACD(data, interval, fast=12, slow=26, dea=9):
+    df_all = pd.DataFrame(data)
+    df_all['datetime'] = pd.to_datetime(df_all['ts'], unit='ms')
+    df = (df_all
+        .groupby(pd.Grouper(key='datetime', freq=interval.freq))
+        .agg(close=pd.NamedAgg(column='price', aggfunc='last'))
+        .reset_index())
+    df['datetime'] = interval.close(df['datetime'])
+    exp1 = df['close'].ewm(span=slow, adjust=False).mean()
+    exp2 = df['close'].ewm(span=fast, adjust=False).mean()
+    df['Diff']=exp1-exp2
+    df['DEA'] = df['Diff'].ewm(span=dea, adjust=False).mean()
+    df['MACD'] = 2 * (df['Diff']- df['DEA'])
+    return df[['datetime','Diff','DEA','MACD']]
@@ -0,0 +1,12 @@
+import pandas as pd
+
+def max_amount_price(group):
+    POC = group.loc[group['amount'] == group['amount'].max(), 'price'].mean()
+    return pd.Series([POC], ('POC',))
+
+def POC(data, interval):
+    df_all = pd.DataFrame(data)
+    df_all['datetime'] = pd.to_datetime(df_all['ts'], unit='ms')
+    df = df_all.groupby(pd.Grouper(key='datetime', freq=interval.freq)).apply(max_amount_price).reset_index()
+    df['datetime'] = interval.close(df['datetime'])
+    return df[['datetime', 'POC']]
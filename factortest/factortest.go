@@ -0,0 +1,154 @@
+// Package factortest runs factors against fixture files instead of MongoDB and compares
+// their output to golden files.
+package factortest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+const (
+	// fixtureDir and outputFilename are relative to the run's workspace directory, which is
+	// the working directory of main.py with every executor.
+	fixtureDir     = "fixtures"
+	outputFilename = "output.jsonl"
+)
+
+// Case is a factor run against fixtures. Fixture files are CSV when their name ends with
+// .csv and JSON lines otherwise, with one row per document the collection would hold.
+// Fixtures are read as is: the aggregation pipeline derived from Needs does not apply.
+type Case struct {
+	Factor factor.Factor
+	Params map[string]string
+	// Fixture feeds the single input of factors without named inputs.
+	Fixture string
+	// Fixtures feeds the named inputs, by input name.
+	Fixtures map[string]string
+	// Start and End filter the fixture rows on ts like the time range of a run.
+	Start int64
+	End   int64
+	// Image defaults to the configured base image.
+	Image string
+	// Golden is the expected output, CSV or JSON lines like the fixtures.
+	Golden string
+	// Tolerance is how far numbers may be from the golden ones, relative to the golden value
+	// or absolute below 1.
+	Tolerance float64
+	// Update rewrites Golden with the output instead of comparing.
+	Update bool
+}
+
+// Run runs the case with runner and returns the differences between the output and the
+// golden file, none meaning the test passed. The run's workspace directory is removed
+// unless the run fails or differs.
+func Run(ctx context.Context, runner containerize.Interface, cfg config.Config, c Case) ([]string, error) {
+	name, err := runName(c.Factor)
+	if err != nil {
+		return nil, err
+	}
+	workdir := filepath.Join(cfg.Workspace, name)
+
+	args := []string{"--task_id", name, "--fixture_dir", fixtureDir, "--output_file", outputFilename}
+	if len(c.Factor.Inputs) == 0 {
+		if c.Fixture == "" {
+			return nil, fmt.Errorf("factor %s needs a fixture", c.Factor.FactorName)
+		}
+		collection, err := copyFixture(workdir, "data", c.Fixture)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--collection", collection)
+	} else {
+		for _, in := range c.Factor.Inputs {
+			fixture, ok := c.Fixtures[in.Name]
+			if !ok {
+				return nil, fmt.Errorf("factor %s needs a fixture for input %q", c.Factor.FactorName, in.Name)
+			}
+			collection, err := copyFixture(workdir, "input_"+in.Name, fixture)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "--input_"+in.Name, collection)
+		}
+	}
+	if c.Start < c.End {
+		args = append(args, "--start", strconv.FormatInt(c.Start, 10), "--end", strconv.FormatInt(c.End, 10))
+	}
+	paramArgs, err := c.Factor.Args(c.Params)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, paramArgs...)
+
+	code, err := factor.RenderString(c.Factor, cfg.Mongo, factor.Storage{})
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.RunFactor(ctx, c.Image, code, name, args); err != nil {
+		return nil, fmt.Errorf("run %s: %w", name, err)
+	}
+
+	got, err := ReadRows(filepath.Join(workdir, outputFilename))
+	if err != nil {
+		return nil, err
+	}
+	if c.Update {
+		if err := WriteRows(c.Golden, got); err != nil {
+			return nil, err
+		}
+		return nil, os.RemoveAll(workdir)
+	}
+	want, err := ReadRows(c.Golden)
+	if err != nil {
+		return nil, err
+	}
+	diffs := Compare(got, want, c.Tolerance)
+	if len(diffs) == 0 {
+		return nil, os.RemoveAll(workdir)
+	}
+	return diffs, nil
+}
+
+// runName is unique so that cases of the same factor can run concurrently.
+func runName(f factor.Factor) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "test-" + strings.ToLower(f.FactorName) + "-" + hex.EncodeToString(b), nil
+}
+
+// copyFixture copies fixture into the fixture directory of workdir as name, keeping its
+// extension for main.py to tell its format, and returns the collection main.py reads it as.
+// Fixtures are named after their input rather than their file, which inputs may share.
+func copyFixture(workdir, name, fixture string) (string, error) {
+	if err := os.MkdirAll(filepath.Join(workdir, fixtureDir), 0o755); err != nil {
+		return "", err
+	}
+	collection := name + filepath.Ext(fixture)
+	in, err := os.Open(fixture)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(workdir, fixtureDir, collection))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	return collection, out.Close()
+}
@@ -0,0 +1,43 @@
+package factortest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFixtureSameBasename(t *testing.T) {
+	src := t.TempDir()
+	workdir := t.TempDir()
+	fixtures := map[string]string{
+		"input_a": filepath.Join(src, "a", "trades.csv"),
+		"input_b": filepath.Join(src, "b", "trades.csv"),
+	}
+	for name, fixture := range fixtures {
+		if err := os.MkdirAll(filepath.Dir(fixture), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fixture, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, fixture := range fixtures {
+		collection, err := copyFixture(workdir, name, fixture)
+		if err != nil {
+			t.Fatalf("copyFixture(%s) error = %v", name, err)
+		}
+		if want := name + ".csv"; collection != want {
+			t.Errorf("copyFixture(%s) = %q, want %q", name, collection, want)
+		}
+	}
+	for name := range fixtures {
+		b, err := os.ReadFile(filepath.Join(workdir, fixtureDir, name+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != name {
+			t.Errorf("fixture %s holds %q, want %q", name, b, name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package factortest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Row is a document of a fixture or an output. Numbers are float64, as decoded by encoding/json.
+type Row map[string]interface{}
+
+// ReadRows reads a CSV file when path ends with .csv and a JSON lines file otherwise.
+// CSV cells are numbers when they parse as such, nil when empty and strings otherwise.
+func ReadRows(path string) ([]Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []Row
+	if isCSV(path) {
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(Row, len(header))
+			for i, col := range header {
+				row[col] = cell(record[i])
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var row Row
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// WriteRows writes rows in the format ReadRows reads from path. CSV columns are sorted by name.
+func WriteRows(path string, rows []Row) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if isCSV(path) {
+		err = writeCSV(f, rows)
+	} else {
+		enc := json.NewEncoder(f)
+		for _, row := range rows {
+			if err = enc.Encode(row); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeCSV(f *os.File, rows []Row) error {
+	header := columns(rows...)
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, col := range header {
+			switch v := row[col].(type) {
+			case nil:
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Compare returns the differences between got and want, row by row. Numbers match when
+// they differ by at most tolerance times the golden value, or tolerance below 1;
+// other values must be equal.
+func Compare(got, want []Row, tolerance float64) []string {
+	var diffs []string
+	if len(got) != len(want) {
+		diffs = append(diffs, fmt.Sprintf("got %d rows, want %d", len(got), len(want)))
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		diffs = append(diffs, compareRow(fmt.Sprintf("row %d", i), got[i], want[i], tolerance)...)
+	}
+	return diffs
+}
+
+// CompareBy is Compare matching rows on their key column instead of their position, so that
+// rows added or removed in between, e.g. by late-arriving trades, are reported as such
+// rather than shifting every following row.
+func CompareBy(got, want []Row, key string, tolerance float64) []string {
+	var diffs []string
+	gotByKey := make(map[string]Row, len(got))
+	for _, row := range got {
+		gotByKey[keyString(row[key])] = row
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, w := range want {
+		k := keyString(w[key])
+		wanted[k] = true
+		g, ok := gotByKey[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s %s: missing row", key, k))
+			continue
+		}
+		diffs = append(diffs, compareRow(key+" "+k, g, w, tolerance)...)
+	}
+	for _, g := range got {
+		if k := keyString(g[key]); !wanted[k] {
+			diffs = append(diffs, fmt.Sprintf("%s %s: unexpected row", key, k))
+		}
+	}
+	return diffs
+}
+
+// keyString spells numeric keys such as ts in full rather than in exponent notation.
+func keyString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func compareRow(label string, got, want Row, tolerance float64) []string {
+	var diffs []string
+	for _, col := range columns(got, want) {
+		g, gok := got[col]
+		w, wok := want[col]
+		switch {
+		case !gok:
+			diffs = append(diffs, fmt.Sprintf("%s: missing %s, want %v", label, col, w))
+		case !wok:
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected %s = %v", label, col, g))
+		case !equal(g, w, tolerance):
+			diffs = append(diffs, fmt.Sprintf("%s: %s = %v, want %v", label, col, g, w))
+		}
+	}
+	return diffs
+}
+
+func equal(got, want interface{}, tolerance float64) bool {
+	g, gok := got.(float64)
+	w, wok := want.(float64)
+	if gok && wok {
+		return math.Abs(g-w) <= tolerance*math.Max(1, math.Abs(w))
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func cell(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	return s
+}
+
+func columns(rows ...Row) []string {
+	seen := make(map[string]bool)
+	var ret []string
+	for _, row := range rows {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				ret = append(ret, col)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func isCSV(path string) bool {
+	return strings.HasSuffix(path, ".csv")
+}
@@ -0,0 +1,213 @@
+package factortest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want []Row
+		tolerance float64
+		diffs     []string
+	}{
+		{
+			name: "equal",
+			got:  []Row{{"ts": 1.0, "v": 2.0, "s": "a"}},
+			want: []Row{{"ts": 1.0, "v": 2.0, "s": "a"}},
+		},
+		{
+			name:      "relative tolerance above 1",
+			got:       []Row{{"v": 1000.5}},
+			want:      []Row{{"v": 1000.0}},
+			tolerance: 1e-3,
+		},
+		{
+			name:      "relative tolerance exceeded",
+			got:       []Row{{"v": 1002.0}},
+			want:      []Row{{"v": 1000.0}},
+			tolerance: 1e-3,
+			diffs:     []string{"row 0: v = 1002, want 1000"},
+		},
+		{
+			name:      "absolute tolerance below 1",
+			got:       []Row{{"v": 0.0005}},
+			want:      []Row{{"v": 0.0}},
+			tolerance: 1e-3,
+		},
+		{
+			name:      "absolute tolerance exceeded",
+			got:       []Row{{"v": 0.002}},
+			want:      []Row{{"v": 0.001}},
+			tolerance: 1e-4,
+			diffs:     []string{"row 0: v = 0.002, want 0.001"},
+		},
+		{
+			name:      "strings are not toleranced",
+			got:       []Row{{"v": "1.0"}},
+			want:      []Row{{"v": 1.0}},
+			tolerance: 1,
+			diffs:     []string{"row 0: v = 1.0, want 1"},
+		},
+		{
+			name:  "missing and unexpected columns",
+			got:   []Row{{"a": 1.0}},
+			want:  []Row{{"b": 1.0}},
+			diffs: []string{"row 0: unexpected a = 1", "row 0: missing b, want 1"},
+		},
+		{
+			name:  "row counts",
+			got:   []Row{{"v": 1.0}, {"v": 2.0}},
+			want:  []Row{{"v": 1.0}},
+			diffs: []string{"got 2 rows, want 1"},
+		},
+		{
+			name:  "nulls",
+			got:   []Row{{"v": nil}},
+			want:  []Row{{"v": nil}},
+			diffs: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diffs := Compare(tt.got, tt.want, tt.tolerance); !reflect.DeepEqual(diffs, tt.diffs) {
+				t.Errorf("Compare() = %q, want %q", diffs, tt.diffs)
+			}
+		})
+	}
+}
+
+func TestCompareBy(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want []Row
+		tolerance float64
+		diffs     []string
+	}{
+		{
+			name: "reordered",
+			got:  []Row{{"ts": 2.0, "v": 20.0}, {"ts": 1.0, "v": 10.0}},
+			want: []Row{{"ts": 1.0, "v": 10.0}, {"ts": 2.0, "v": 20.0}},
+		},
+		{
+			name:  "row inserted in between",
+			got:   []Row{{"ts": 1.0, "v": 10.0}, {"ts": 2.0, "v": 15.0}, {"ts": 3.0, "v": 30.0}},
+			want:  []Row{{"ts": 1.0, "v": 10.0}, {"ts": 3.0, "v": 30.0}},
+			diffs: []string{"ts 2: unexpected row"},
+		},
+		{
+			name:  "row missing",
+			got:   []Row{{"ts": 1.0, "v": 10.0}},
+			want:  []Row{{"ts": 1.0, "v": 10.0}, {"ts": 2.0, "v": 20.0}},
+			diffs: []string{"ts 2: missing row"},
+		},
+		{
+			name:      "values within tolerance",
+			got:       []Row{{"ts": 1.0, "v": 10.001}},
+			want:      []Row{{"ts": 1.0, "v": 10.0}},
+			tolerance: 1e-3,
+		},
+		{
+			name:  "values differ",
+			got:   []Row{{"ts": 1.0, "v": 11.0}},
+			want:  []Row{{"ts": 1.0, "v": 10.0}},
+			diffs: []string{"ts 1: v = 11, want 10"},
+		},
+		{
+			name:  "keys in full",
+			got:   []Row{{"ts": 1656633600000.0}},
+			want:  []Row{},
+			diffs: []string{"ts 1656633600000: unexpected row"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diffs := CompareBy(tt.got, tt.want, "ts", tt.tolerance); !reflect.DeepEqual(diffs, tt.diffs) {
+				t.Errorf("CompareBy() = %q, want %q", diffs, tt.diffs)
+			}
+		})
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		rows    []Row
+	}{
+		{
+			name:    "csv",
+			file:    "rows.csv",
+			content: "ts,price,side\n1,10.5,buy\n2,,sell\n",
+			rows: []Row{
+				{"ts": 1.0, "price": 10.5, "side": "buy"},
+				{"ts": 2.0, "price": nil, "side": "sell"},
+			},
+		},
+		{
+			name:    "empty csv",
+			file:    "rows.csv",
+			content: "",
+		},
+		{
+			name:    "json lines",
+			file:    "rows.jsonl",
+			content: "{\"ts\": 1, \"price\": 10.5}\n\n{\"ts\": 2, \"price\": null}\n",
+			rows: []Row{
+				{"ts": 1.0, "price": 10.5},
+				{"ts": 2.0, "price": nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := ReadRows(path)
+			if err != nil {
+				t.Fatalf("ReadRows() error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("ReadRows() = %v, want %v", rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestReadRowsInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.jsonl")
+	if err := os.WriteFile(path, []byte("{\"ts\": 1}\n{\"ts\":\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRows(path); err == nil {
+		t.Error("ReadRows() error = nil, want an error on line 2")
+	}
+}
+
+func TestWriteRowsRoundTrip(t *testing.T) {
+	rows := []Row{
+		{"ts": 1656633600000.0, "v": 0.1, "s": "a"},
+		{"ts": 1656633660000.0, "v": nil, "s": "b"},
+	}
+	for _, file := range []string{"rows.csv", "rows.jsonl"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+			if err := WriteRows(path, rows); err != nil {
+				t.Fatalf("WriteRows() error = %v", err)
+			}
+			got, err := ReadRows(path)
+			if err != nil {
+				t.Fatalf("ReadRows() error = %v", err)
+			}
+			if diffs := Compare(got, rows, 0); len(diffs) > 0 {
+				t.Errorf("round trip differs: %q", diffs)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package interval
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type Unit string
+
+const (
+	Second    Unit = "s"
+	Minute    Unit = "min"
+	Hour      Unit = "h"
+	Day       Unit = "D"
+	Week      Unit = "W"
+	SemiMonth Unit = "SM"
+	Month     Unit = "M"
+)
+
+// aliases maps the pandas spellings we accept to their canonical unit.
+var aliases = map[string]Unit{
+	"s":   Second,
+	"S":   Second,
+	"min": Minute,
+	"T":   Minute,
+	"h":   Hour,
+	"H":   Hour,
+	"D":   Day,
+	"d":   Day,
+	"W":   Week,
+	"SM":  SemiMonth,
+	"M":   Month,
+}
+
+var unitMs = map[Unit]int64{
+	Second: 1000,
+	Minute: 60 * 1000,
+	Hour:   60 * 60 * 1000,
+	Day:    24 * 60 * 60 * 1000,
+	Week:   7 * 24 * 60 * 60 * 1000,
+}
+
+var intervalRegexp = regexp.MustCompile(`^(\d*)([A-Za-z]+)$`)
+
+// Interval is a pandas frequency string such as "5min", parsed once on the Go side.
+type Interval struct {
+	N    int64
+	Unit Unit
+}
+
+// Parse parses and normalizes a pandas frequency string, e.g. "5T" becomes 5 Minute.
+// A missing count means 1, as in pandas.
+func Parse(s string) (Interval, error) {
+	m := intervalRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Interval{}, fmt.Errorf("invalid interval %q", s)
+	}
+	n := int64(1)
+	if m[1] != "" {
+		var err error
+		if n, err = strconv.ParseInt(m[1], 10, 64); err != nil || n <= 0 {
+			return Interval{}, fmt.Errorf("invalid interval %q", s)
+		}
+	}
+	unit, ok := aliases[m[2]]
+	if !ok {
+		return Interval{}, fmt.Errorf("invalid interval %q: unsupported unit %q", s, m[2])
+	}
+	return Interval{N: n, Unit: unit}, nil
+}
+
+// String returns the normalized pandas frequency string.
+func (i Interval) String() string {
+	return strconv.FormatInt(i.N, 10) + string(i.Unit)
+}
+
+// IsZero reports whether the interval is unset.
+func (i Interval) IsZero() bool {
+	return i.N == 0
+}
+
+// Fixed reports whether every bar of the interval has the same width.
+func (i Interval) Fixed() bool {
+	_, ok := unitMs[i.Unit]
+	return ok
+}
+
+// Milliseconds returns the bar width for fixed intervals and false for calendar intervals.
+func (i Interval) Milliseconds() (int64, bool) {
+	ms, ok := unitMs[i.Unit]
+	return i.N * ms, ok
+}
+
+// Duration is Milliseconds as a time.Duration.
+func (i Interval) Duration() (time.Duration, bool) {
+	ms, ok := i.Milliseconds()
+	return time.Duration(ms) * time.Millisecond, ok
+}
+
+// Truncate returns the open of the fixed-width bar containing ts, bars being aligned to the epoch.
+func (i Interval) Truncate(ts int64) (int64, bool) {
+	ms, ok := i.Milliseconds()
+	if !ok {
+		return 0, false
+	}
+	return ts - ts%ms, true
+}
+
+// CloseRule is how a bar labelled with its open time is relabelled with its close time:
+// intraday bars are shifted by their width, daily and longer bars are labelled by date,
+// plus a number of days for weekly and semi-monthly bars.
+type CloseRule struct {
+	OffsetMs int64 `json:"offset_ms,omitempty"`
+	DateOnly bool  `json:"date_only,omitempty"`
+	PlusDays int   `json:"plus_days,omitempty"`
+}
+
+func (i Interval) CloseRule() CloseRule {
+	switch i.Unit {
+	case Second, Minute, Hour:
+		ms, _ := i.Milliseconds()
+		return CloseRule{OffsetMs: ms}
+	case Week:
+		return CloseRule{DateOnly: true, PlusDays: 7}
+	case SemiMonth:
+		return CloseRule{DateOnly: true, PlusDays: 15}
+	default:
+		return CloseRule{DateOnly: true}
+	}
+}
+
+// Close applies the close rule to a bar open time.
+func (i Interval) Close(open time.Time) time.Time {
+	rule := i.CloseRule()
+	if !rule.DateOnly {
+		return open.Add(time.Duration(rule.OffsetMs) * time.Millisecond)
+	}
+	y, m, d := open.Date()
+	return time.Date(y, m, d+rule.PlusDays, 0, 0, 0, 0, open.Location())
+}
+
+// Arg encodes the interval for an "interval" parameter of the generated main.py,
+// which turns it back into an Interval object without parsing the frequency string.
+func (i Interval) Arg() (string, error) {
+	ms, _ := i.Milliseconds()
+	b, err := json.Marshal(struct {
+		Freq  string    `json:"freq"`
+		N     int64     `json:"n"`
+		Unit  Unit      `json:"unit"`
+		Ms    int64     `json:"ms,omitempty"`
+		Close CloseRule `json:"close"`
+	}{i.String(), i.N, i.Unit, ms, i.CloseRule()})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (i Interval) MarshalText() ([]byte, error) {
+	if i.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(i.String()), nil
+}
+
+func (i *Interval) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*i = Interval{}
+		return nil
+	}
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*i = parsed
+	return nil
+}
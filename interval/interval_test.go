@@ -0,0 +1,149 @@
+package interval
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Interval
+		err  bool
+	}{
+		{in: "5min", want: Interval{5, Minute}},
+		{in: "5T", want: Interval{5, Minute}},
+		{in: "min", want: Interval{1, Minute}},
+		{in: "30S", want: Interval{30, Second}},
+		{in: "4H", want: Interval{4, Hour}},
+		{in: "1d", want: Interval{1, Day}},
+		{in: "W", want: Interval{1, Week}},
+		{in: "SM", want: Interval{1, SemiMonth}},
+		{in: "3M", want: Interval{3, Month}},
+		{in: "", err: true},
+		{in: "5", err: true},
+		{in: "0min", err: true},
+		{in: "-5min", err: true},
+		{in: "5 min", err: true},
+		{in: "5Y", err: true},
+		{in: "99999999999999999999min", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Parse(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	for in, want := range map[string]string{"T": "1min", "15S": "15s", "2H": "2h", "d": "1D"} {
+		i, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := i.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFixed(t *testing.T) {
+	tests := []struct {
+		i     Interval
+		ms    int64
+		fixed bool
+	}{
+		{Interval{30, Second}, 30 * 1000, true},
+		{Interval{5, Minute}, 5 * 60 * 1000, true},
+		{Interval{1, Week}, 7 * 24 * 60 * 60 * 1000, true},
+		{Interval{1, SemiMonth}, 0, false},
+		{Interval{1, Month}, 0, false},
+	}
+	for _, tt := range tests {
+		ms, ok := tt.i.Milliseconds()
+		if ok != tt.fixed || tt.i.Fixed() != tt.fixed || (ok && ms != tt.ms) {
+			t.Errorf("%v.Milliseconds() = %d, %v, want %d, %v", tt.i, ms, ok, tt.ms, tt.fixed)
+		}
+		d, ok := tt.i.Duration()
+		if ok && d != time.Duration(tt.ms)*time.Millisecond {
+			t.Errorf("%v.Duration() = %v", tt.i, d)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	i := Interval{5, Minute}
+	for ts, want := range map[int64]int64{0: 0, 299999: 0, 300000: 300000, 300001: 300000} {
+		if got, ok := i.Truncate(ts); !ok || got != want {
+			t.Errorf("Truncate(%d) = %d, %v, want %d", ts, got, ok, want)
+		}
+	}
+	if _, ok := (Interval{1, Month}).Truncate(0); ok {
+		t.Error("Truncate() of a calendar interval succeeded")
+	}
+}
+
+func TestClose(t *testing.T) {
+	open := time.Date(2022, 7, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		i    Interval
+		want time.Time
+	}{
+		{Interval{5, Minute}, time.Date(2022, 7, 1, 10, 35, 0, 0, time.UTC)},
+		{Interval{1, Hour}, time.Date(2022, 7, 1, 11, 30, 0, 0, time.UTC)},
+		{Interval{1, Day}, time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{Interval{1, Week}, time.Date(2022, 7, 8, 0, 0, 0, 0, time.UTC)},
+		{Interval{1, SemiMonth}, time.Date(2022, 7, 16, 0, 0, 0, 0, time.UTC)},
+		{Interval{1, Month}, time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := tt.i.Close(open); !got.Equal(tt.want) {
+			t.Errorf("%v.Close() = %v, want %v", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestArg(t *testing.T) {
+	tests := []struct {
+		i    Interval
+		want string
+	}{
+		{Interval{5, Minute}, `{"freq":"5min","n":5,"unit":"min","ms":300000,"close":{"offset_ms":300000}}`},
+		{Interval{1, Week}, `{"freq":"1W","n":1,"unit":"W","ms":604800000,"close":{"date_only":true,"plus_days":7}}`},
+		{Interval{1, Month}, `{"freq":"1M","n":1,"unit":"M","close":{"date_only":true}}`},
+	}
+	for _, tt := range tests {
+		got, err := tt.i.Arg()
+		if err != nil || got != tt.want {
+			t.Errorf("%v.Arg() = %s, %v, want %s", tt.i, got, err, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	var i Interval
+	if err := i.UnmarshalText([]byte("15T")); err != nil || i != (Interval{15, Minute}) {
+		t.Errorf("UnmarshalText() = %v, %v", i, err)
+	}
+	if b, err := i.MarshalText(); err != nil || string(b) != "15min" {
+		t.Errorf("MarshalText() = %s, %v", b, err)
+	}
+	if err := i.UnmarshalText(nil); err != nil || !i.IsZero() {
+		t.Errorf("UnmarshalText(nil) = %v, %v", i, err)
+	}
+	if b, err := i.MarshalText(); err != nil || len(b) != 0 {
+		t.Errorf("MarshalText() of zero = %q, %v", b, err)
+	}
+	if err := i.UnmarshalText([]byte("5x")); err == nil {
+		t.Error("UnmarshalText(5x) succeeded")
+	}
+}
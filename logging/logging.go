@@ -0,0 +1,200 @@
+// Package logging writes structured log lines as text or JSON, in the style of log/slog,
+// with run-scoped fields carried by the context.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field names shared by every component, so one run can be followed end to end.
+const (
+	RunID         = "run_id"
+	Node          = "node"
+	Factor        = "factor"
+	FactorVersion = "factor_version"
+	ContainerID   = "container_id"
+	Phase         = "phase"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l <= LevelDebug:
+		return "DEBUG"
+	case l <= LevelInfo:
+		return "INFO"
+	case l <= LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// ParseLevel parses debug, info, warn or error, case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q", s)
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// output is shared by a logger and every logger derived from it.
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	json  bool
+	level Level
+}
+
+// Logger writes lines made of a message and key-value pairs, alternating as with log/slog.
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New returns a logger writing lines of format, text or json, at level or above to w.
+func New(w io.Writer, format string, level Level) *Logger {
+	return &Logger{out: &output{w: w, json: format == FormatJSON, level: level}}
+}
+
+var std = New(os.Stderr, FormatText, LevelInfo)
+
+// Default writes text lines at info level to stderr.
+func Default() *Logger {
+	return std
+}
+
+// With returns a logger adding kv to every line.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+// Ctx returns a logger adding the fields of ctx to every line.
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying kv in addition to the fields of ctx, for Logger.Ctx.
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	merged := make([]interface{}, 0, len(fields)+len(kv))
+	merged = append(merged, fields...)
+	merged = append(merged, kv...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if level < l.out.level {
+		return
+	}
+	pairs := append([]interface{}{
+		"time", time.Now().Format(time.RFC3339Nano),
+		"level", level.String(),
+		"msg", msg,
+	}, l.fields...)
+	pairs = append(pairs, kv...)
+	if len(pairs)%2 == 1 {
+		pairs = append(pairs[:len(pairs)-1], "!BADKEY", pairs[len(pairs)-1])
+	}
+
+	var buf bytes.Buffer
+	if l.out.json {
+		writeJSON(&buf, pairs)
+	} else {
+		writeText(&buf, pairs)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, pairs []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(pairs[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+		b, err := json.Marshal(value(pairs[i+1]))
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(pairs[i+1]))
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+}
+
+func writeText(buf *bytes.Buffer, pairs []interface{}) {
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(pairs[i]))
+		buf.WriteByte('=')
+		s := fmt.Sprint(value(pairs[i+1]))
+		if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
+
+// value turns errors and durations into strings, which JSON would otherwise lose.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
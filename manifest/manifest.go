@@ -0,0 +1,140 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+// Manifest describes a factor whose Python code lives in a separate file.
+type Manifest struct {
+	Name         string             `yaml:"name" json:"name"`
+	Description  string             `yaml:"description" json:"description"`
+	Params       []factor.ParamType `yaml:"params" json:"params"`
+	Dependencies []string           `yaml:"dependencies" json:"dependencies"`
+	Outputs      []string           `yaml:"outputs" json:"outputs"`
+	// Entrypoint is the factor function, Name if empty.
+	Entrypoint string `yaml:"entrypoint" json:"entrypoint"`
+	// Code is the path of the .py file, relative to the manifest.
+	Code      string           `yaml:"code" json:"code"`
+	Needs     factor.Needs     `yaml:"needs" json:"needs"`
+	Inputs    []factor.Input   `yaml:"inputs" json:"inputs"`
+	Alignment factor.Alignment `yaml:"alignment" json:"alignment"`
+}
+
+// Load reads the manifest at path and the code file it points to, and validates the factor.
+// Files ending in .json are read as JSON, anything else as YAML.
+func Load(path string) (factor.Factor, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return factor.Factor{}, err
+	}
+	var m Manifest
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&m)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(&m)
+	}
+	if err != nil {
+		return factor.Factor{}, fmt.Errorf("manifest %s: %w", path, err)
+	}
+
+	f, err := m.factor(filepath.Dir(path))
+	if err != nil {
+		return factor.Factor{}, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (m Manifest) factor(dir string) (factor.Factor, error) {
+	if m.Code == "" {
+		return factor.Factor{}, errors.New("code is required")
+	}
+	if filepath.Ext(m.Code) != ".py" {
+		return factor.Factor{}, fmt.Errorf("code %s is not a .py file", m.Code)
+	}
+	code, err := os.ReadFile(filepath.Join(dir, m.Code))
+	if err != nil {
+		return factor.Factor{}, err
+	}
+	f := factor.Factor{
+		FactorName:   m.Name,
+		FactorCode:   string(code),
+		Description:  m.Description,
+		ParamTypes:   m.Params,
+		Entrypoint:   m.Entrypoint,
+		Dependencies: m.Dependencies,
+		Outputs:      m.Outputs,
+		Needs:        m.Needs,
+		Inputs:       m.Inputs,
+		Alignment:    m.Alignment,
+	}
+	if err := f.Validate(); err != nil {
+		return factor.Factor{}, err
+	}
+	if !defines(f.FactorCode, f.Function()) {
+		return factor.Factor{}, fmt.Errorf("code %s does not define %s", m.Code, f.Function())
+	}
+	return f, nil
+}
+
+// defines reports whether code has a top-level definition of function.
+func defines(code, function string) bool {
+	return regexp.MustCompile(`(?m)^def ` + regexp.QuoteMeta(function) + `\s*\(`).MatchString(code)
+}
+
+// Filenames are the names LoadDir discovers manifests by, one per directory. Other YAML and
+// JSON files, such as fixtures or the configuration of other tools, are not manifests.
+var Filenames = []string{"factor.yaml", "factor.yml", "factor.json"}
+
+// IsManifest reports whether the file name is one of Filenames.
+func IsManifest(name string) bool {
+	for _, f := range Filenames {
+		if strings.EqualFold(filepath.Base(name), f) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDir loads every manifest found under dir, sorted by factor name. Factor names must be
+// unique, ignoring case, since they name the factor workspaces and containers.
+func LoadDir(dir string) ([]factor.Factor, error) {
+	var factors []factor.Factor
+	seen := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !IsManifest(info.Name()) {
+			return err
+		}
+		f, err := Load(path)
+		if err != nil {
+			return err
+		}
+		key := strings.ToLower(f.FactorName)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("factor %s is defined in both %s and %s", f.FactorName, other, path)
+		}
+		seen[key] = path
+		factors = append(factors, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(factors, func(i, j int) bool { return factors[i].FactorName < factors[j].FactorName })
+	return factors, nil
+}
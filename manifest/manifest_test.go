@@ -0,0 +1,151 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const macdCode = "import pandas as pd\n\ndef macd(df, fast, slow):\n    return df\n"
+
+// writeFiles writes files, named by their path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name, file, manifest string
+	}{
+		{"yaml", "macd.yaml", `
+name: MACD
+description: moving average convergence divergence
+entrypoint: macd
+code: macd.py
+params:
+  - {name: fast, type: int}
+  - {name: slow, type: int}
+outputs: [macd]
+needs:
+  fields: [price]
+`},
+		{"json", "macd.json", `{
+  "name": "MACD",
+  "description": "moving average convergence divergence",
+  "entrypoint": "macd",
+  "code": "macd.py",
+  "params": [{"name": "fast", "type": "int"}, {"name": "slow", "type": "int"}],
+  "outputs": ["macd"],
+  "needs": {"fields": ["price"]}
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{tt.file: tt.manifest, "macd.py": macdCode})
+			f, err := Load(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.FactorName != "MACD" || f.Function() != "macd" || f.FactorCode != macdCode ||
+				len(f.ParamTypes) != 2 || f.ParamTypes[1].Name != "slow" ||
+				strings.Join(f.Outputs, ",") != "macd" || strings.Join(f.Needs.Fields, ",") != "price" {
+				t.Errorf("Load() = %+v", f)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"unknown field", "name: MACD\ncode: macd.py\nentrypoint: macd\nparameters: []\n", "parameters"},
+		{"no code", "name: MACD\n", "code is required"},
+		{"not python", "name: MACD\ncode: macd.txt\n", "not a .py file"},
+		{"missing code", "name: MACD\ncode: missing.py\n", "missing.py"},
+		{"invalid name", "name: 1MACD\ncode: macd.py\nentrypoint: macd\n", "not a valid Python identifier"},
+		{"undefined function", "name: MACD\ncode: macd.py\n", "does not define MACD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"macd.yaml": tt.manifest, "macd.py": macdCode, "macd.txt": macdCode})
+			_, err := Load(filepath.Join(dir, "macd.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want one about %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDefines(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"def macd(df):\n    pass\n", true},
+		{"import x\ndef macd (df):\n    pass\n", true},
+		{"class A:\n    def macd(self):\n        pass\n", false},
+		{"def macd_signal(df):\n    pass\n", false},
+		{"# def macd(df):\n", false},
+	}
+	for _, tt := range tests {
+		if got := defines(tt.code, "macd"); got != tt.want {
+			t.Errorf("defines(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+	for name, want := range map[string]bool{
+		"factor.yaml": true, "Factor.YML": true, "macd/factor.json": true,
+		"macd.yaml": false, "factor.py": false, "factor": false,
+	} {
+		if got := IsManifest(name); got != want {
+			t.Errorf("IsManifest(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"trend/macd/factor.yaml":  "name: MACD\ncode: macd.py\nentrypoint: macd\n",
+		"trend/macd/macd.py":      macdCode,
+		"trend/macd/fixture.yaml": "rows: []\n",
+		"volume/factor.json":      `{"name": "OBV", "code": "obv.py"}`,
+		"volume/obv.py":           "def OBV(df):\n    return df\n",
+		"volume/README.md":        "not a manifest",
+		".golangci.yml":           "linters: {}\n",
+	})
+	factors, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range factors {
+		names = append(names, f.FactorName)
+	}
+	if got := strings.Join(names, ","); got != "MACD,OBV" {
+		t.Errorf("LoadDir() = %s, want MACD,OBV", got)
+	}
+
+	// names differing in case name the same workspace
+	writeFiles(t, dir, map[string]string{"other/factor.yaml": "name: macd\ncode: macd.py\n", "other/macd.py": "def macd(df):\n    return df\n"})
+	if _, err := LoadDir(dir); err == nil || !strings.Contains(err.Error(), "defined in both") {
+		t.Errorf("LoadDir() with duplicate names error = %v", err)
+	}
+}
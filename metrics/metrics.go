@@ -0,0 +1,34 @@
+package metrics
+
+// Labels are kept low-cardinality: factor names and fixed sets of values, never run IDs,
+// container names or collections.
+var (
+	Runs = NewCounter("factor_runs_total",
+		"Factor runs by factor and outcome: succeeded, failed or cancelled.", "factor", "outcome")
+	RunDuration = NewHistogram("factor_run_duration_seconds",
+		"Duration of factor runs, from rendering main.py to the exit of its container.",
+		ExponentialBuckets(1, 2, 14), "factor")
+	QueueWait = NewHistogram("factor_run_queue_wait_seconds",
+		"Time from asking the executor for a run until its container or process started.",
+		ExponentialBuckets(0.1, 2, 12), "executor")
+	RunningContainers = NewGauge("factor_running_containers",
+		"Containers or processes currently running main.py.", "executor")
+	Retries = NewCounter("factor_run_retries_total",
+		"Attempts of factor runs that failed transiently and were retried.", "factor")
+	OOMKills = NewCounter("factor_container_oom_kills_total",
+		"Factor containers killed for exceeding their memory limit.", "factor")
+	RowsRead = NewCounter("factor_rows_read_total",
+		"Rows read by factor runs over all of their inputs.", "factor")
+	RowsWritten = NewCounter("factor_rows_written_total",
+		"Rows written by factor runs.", "factor")
+	PeakMemory = NewHistogram("factor_run_peak_memory_bytes",
+		"Peak memory of factor runs, without the page cache.",
+		ExponentialBuckets(16<<20, 2, 12), "factor")
+	CPUSeconds = NewCounter("factor_run_cpu_seconds_total",
+		"CPU time used by factor runs.", "factor")
+	ImageBuildDuration = NewHistogram("factor_image_build_duration_seconds",
+		"Duration of image builds by outcome: succeeded or failed.",
+		ExponentialBuckets(1, 2, 12), "outcome")
+	ImageBuildSteps = NewCounter("factor_image_build_steps_total",
+		"Dockerfile steps of image builds by cache result: hit or miss.", "cache")
+)
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Filename is the file in the workspace the commands push their metrics to, and serve
+// exposes them from.
+const Filename = "metrics.json"
+
+// pushedSeries is a series as kept in the file of pushed metrics.
+type pushedSeries struct {
+	LabelValues []string `json:"label_values"`
+	Value       float64  `json:"value,omitempty"`
+	Counts      []uint64 `json:"counts,omitempty"`
+	Sum         float64  `json:"sum,omitempty"`
+}
+
+// snapshot holds the pushed series by metric name and series key.
+type snapshot map[string]map[string]*pushedSeries
+
+// Push adds the counters and histograms of the process to the totals in the file at path
+// and takes them off the process, so that the metrics of commands exiting after a run or
+// an image build outlive them and are exposed by serve. Gauges are values of the process
+// and are not pushed. Processes pushing concurrently wait on a lock beside path.
+func Push(path string) error {
+	if !observed() {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	// closing the lock file releases the lock
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	totals, err := readSnapshot(path)
+	if err != nil {
+		return err
+	}
+	if totals == nil {
+		totals = snapshot{}
+	}
+	mu.Lock()
+	fs := append([]*family(nil), families...)
+	mu.Unlock()
+	deltas := make(map[*family]map[string]*series)
+	for _, f := range fs {
+		if f.kind == kindGauge {
+			continue
+		}
+		f.mu.Lock()
+		delta := make(map[string]*series, len(f.series))
+		for k, s := range f.series {
+			delta[k] = s.copy()
+		}
+		f.mu.Unlock()
+		if len(delta) == 0 {
+			continue
+		}
+		deltas[f] = delta
+		if totals[f.name] == nil {
+			totals[f.name] = make(map[string]*pushedSeries)
+		}
+		for k, s := range delta {
+			p, ok := totals[f.name][k]
+			if !ok || !f.fits(p) {
+				p = &pushedSeries{LabelValues: s.labelValues}
+				if f.kind == kindHistogram {
+					p.Counts = make([]uint64, len(f.buckets)+1)
+				}
+				totals[f.name][k] = p
+			}
+			p.Value += s.value
+			for i, count := range s.counts {
+				p.Counts[i] += count
+			}
+			p.Sum += s.sum
+		}
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+	if err := writeSnapshot(path, totals); err != nil {
+		return err
+	}
+
+	// what was observed meanwhile stays for the next push
+	for f, delta := range deltas {
+		f.mu.Lock()
+		for k, d := range delta {
+			s := f.series[k]
+			s.value -= d.value
+			for i, count := range d.counts {
+				s.counts[i] -= count
+			}
+			s.sum -= d.sum
+		}
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+// observed reports whether the process has counters or histograms to push.
+func observed() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, f := range families {
+		f.mu.Lock()
+		n := len(f.series)
+		f.mu.Unlock()
+		if f.kind != kindGauge && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fits reports whether p is a series of f, rather than of a metric of the same name with
+// other labels or buckets pushed by another version.
+func (f *family) fits(p *pushedSeries) bool {
+	if len(p.LabelValues) != len(f.labels) {
+		return false
+	}
+	if f.kind == kindHistogram {
+		return len(p.Counts) == len(f.buckets)+1
+	}
+	return len(p.Counts) == 0
+}
+
+func (s *series) add(p *pushedSeries) {
+	s.value += p.Value
+	for i, count := range p.Counts {
+		s.counts[i] += count
+	}
+	s.sum += p.Sum
+}
+
+// readSnapshot reads the metrics pushed to path, none if it does not exist.
+func readSnapshot(path string) (snapshot, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, byKey := range snap {
+		for k, p := range byKey {
+			if strings.Join(p.LabelValues, "\xff") != k {
+				return nil, fmt.Errorf("%s: series %q does not match its labels", path, k)
+			}
+		}
+	}
+	return snap, nil
+}
+
+// writeSnapshot replaces the file at path, through a rename so that readers never see it
+// half written.
+func writeSnapshot(path string, snap snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), Filename)
+	counter := NewCounter("test_push_runs_total", "Runs.", "outcome")
+	gauge := NewGauge("test_push_running", "Running.")
+	histogram := NewHistogram("test_push_duration_seconds", "Durations.", []float64{1})
+
+	// two commands pushing one after the other
+	for i := 0; i < 2; i++ {
+		counter.Inc("succeeded")
+		histogram.Observe(0.5)
+		gauge.Set(3)
+		if err := Push(path); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+	counter.Inc("failed")
+
+	rec := httptest.NewRecorder()
+	Handler(path).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`test_push_runs_total{outcome="failed"} 1` + "\n",
+		`test_push_runs_total{outcome="succeeded"} 2` + "\n",
+		`test_push_duration_seconds_bucket{le="1"} 2` + "\n",
+		`test_push_duration_seconds_sum 1` + "\n",
+		`test_push_duration_seconds_count 2` + "\n",
+		// gauges are not pushed, so not counted twice
+		`test_push_running 3` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	// the pushed series are off the process
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `test_push_runs_total{outcome="succeeded"} 0`+"\n") {
+		t.Errorf("pushed counter not taken off the process:\n%s", buf.String())
+	}
+}
+
+func TestPushIgnoresMismatchedSeries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), Filename)
+	// pushed by a version with other buckets
+	err := os.WriteFile(path, []byte(`{"test_mismatch_seconds":{"":{"label_values":[],"counts":[1,2,3],"sum":4}}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewHistogram("test_mismatch_seconds", "Mismatched.", []float64{1}).Observe(0.5)
+
+	rec := httptest.NewRecorder()
+	Handler(path).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "test_mismatch_seconds_count 1\n") {
+		t.Errorf("mismatched pushed series was added:\n%s", rec.Body.String())
+	}
+
+	if err := Push(path); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	snap, err := readSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snap["test_mismatch_seconds"][""].Counts; len(got) != 2 || got[0] != 1 {
+		t.Errorf("pushed counts = %v, want [1 0]", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Package metrics keeps counters, gauges and histograms and exposes them in the Prometheus
+// text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+// family is a metric with all of its label combinations.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts are the non-cumulative bucket counts of histograms, the last one being +Inf
+	counts []uint64
+	sum    float64
+}
+
+var (
+	mu       sync.Mutex
+	families []*family
+)
+
+func register(f *family) *family {
+	f.series = make(map[string]*series)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range families {
+		if existing.name == f.name {
+			panic("metrics: duplicate metric " + f.name)
+		}
+	}
+	families = append(families, f)
+	return f
+}
+
+// with returns the series of labelValues, which must match the labels of the family.
+// The caller holds f.mu.
+func (f *family) with(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes labels %v, got %d values", f.name, f.labels, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func WriteText(w io.Writer) error {
+	return writeText(w, nil)
+}
+
+// writeText writes every metric with the series of pushed added to those of the process.
+func writeText(w io.Writer, pushed snapshot) error {
+	mu.Lock()
+	fs := append([]*family(nil), families...)
+	mu.Unlock()
+	sort.Slice(fs, func(i, j int) bool { return fs[i].name < fs[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range fs {
+		f.write(bw, pushed[f.name])
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer, pushed map[string]*pushedSeries) {
+	f.mu.Lock()
+	all := make(map[string]*series, len(f.series)+len(pushed))
+	for k, s := range f.series {
+		all[k] = s.copy()
+	}
+	f.mu.Unlock()
+	for k, p := range pushed {
+		if !f.fits(p) {
+			continue
+		}
+		s, ok := all[k]
+		if !ok {
+			s = &series{labelValues: p.LabelValues}
+			if f.kind == kindHistogram {
+				s.counts = make([]uint64, len(f.buckets)+1)
+			}
+			all[k] = s
+		}
+		s.add(p)
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := all[k]
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labelString(f.labels, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(f.buckets) {
+				le = formatFloat(f.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.labelValues, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelString(f.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelString(f.labels, s.labelValues, "", ""), cumulative)
+	}
+}
+
+func (s *series) copy() *series {
+	c := *s
+	c.counts = append([]uint64(nil), s.counts...)
+	return &c
+}
+
+// labelEscaper escapes label values as the text format expects, which differs from Go quoting.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelString(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves WriteText with the metrics pushed to path added, for /metrics.
+func Handler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushed, err := readSnapshot(path)
+		if err != nil {
+			logging.Default().Error("failed to read pushed metrics", "path", path, "error", err)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writeText(w, pushed); err != nil {
+			logging.Default().Error("failed to write metrics", "error", err)
+		}
+	})
+}
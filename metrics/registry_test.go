@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	counter := NewCounter("test_write_requests_total", "Requests by code.", "code")
+	gauge := NewGauge("test_write_in_flight", "Requests in flight.")
+	histogram := NewHistogram("test_write_duration_seconds", "Durations.", []float64{0.5, 1}, "path")
+
+	counter.Inc("200")
+	counter.Add(2, "500")
+	counter.Inc(`a"b\c` + "\n")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram.Observe(0.25, "/")
+	histogram.Observe(0.5, "/")
+	histogram.Observe(0.75, "/")
+	histogram.Observe(2, "/")
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`# HELP test_write_requests_total Requests by code.
+# TYPE test_write_requests_total counter
+test_write_requests_total{code="200"} 1
+test_write_requests_total{code="500"} 2
+test_write_requests_total{code="a\"b\\c\n"} 1
+`,
+		`# HELP test_write_in_flight Requests in flight.
+# TYPE test_write_in_flight gauge
+test_write_in_flight 1
+`,
+		`# HELP test_write_duration_seconds Durations.
+# TYPE test_write_duration_seconds histogram
+test_write_duration_seconds_bucket{path="/",le="0.5"} 2
+test_write_duration_seconds_bucket{path="/",le="1"} 3
+test_write_duration_seconds_bucket{path="/",le="+Inf"} 4
+test_write_duration_seconds_sum{path="/"} 3.5
+test_write_duration_seconds_count{path="/"} 4
+`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteText() lacks\n%s\ngot\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWriteTextSortsFamilies(t *testing.T) {
+	NewCounter("test_sort_b_total", "B.").Inc()
+	NewCounter("test_sort_a_total", "A.").Inc()
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	a := strings.Index(buf.String(), "# HELP test_sort_a_total")
+	b := strings.Index(buf.String(), "# HELP test_sort_b_total")
+	if a < 0 || b < 0 || a > b {
+		t.Errorf("families not sorted by name: a at %d, b at %d", a, b)
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	got := ExponentialBuckets(1, 2, 4)
+	want := []float64{1, 2, 4, 8}
+	if len(got) != len(want) {
+		t.Fatalf("ExponentialBuckets() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ExponentialBuckets() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCounterCannotDecrease(t *testing.T) {
+	c := NewCounter("test_decrease_total", "Decreasing.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Add(-1) did not panic")
+		}
+	}()
+	c.Add(-1)
+}
+
+func TestHandler(t *testing.T) {
+	NewCounter("test_handler_total", "Handled.").Inc()
+	rec := httptest.NewRecorder()
+	Handler(filepath.Join(t.TempDir(), Filename)).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_handler_total 1\n") {
+		t.Errorf("body lacks test_handler_total:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import "time"
+
+// Counter only goes up.
+type Counter struct{ f *family }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{register(&family{name: name, help: help, kind: kindCounter, labels: labels})}
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.f.name + " cannot decrease")
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.with(labelValues).value += v
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge goes up and down.
+type Gauge struct{ f *family }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{register(&family{name: name, help: help, kind: kindGauge, labels: labels})}
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value += v
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value = v
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations into buckets given by their upper bounds, in increasing order.
+type Histogram struct{ f *family }
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{register(&family{name: name, help: help, kind: kindHistogram, labels: labels, buckets: buckets})}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.with(labelValues)
+	i := 0
+	for i < len(h.f.buckets) && v > h.f.buckets[i] {
+		i++
+	}
+	s.counts[i]++
+	s.sum += v
+}
+
+// Since observes the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// ExponentialBuckets returns count buckets starting at start, each factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// idRegexp matches task and node IDs, which name containers, workspace directories and
+// output collections: letters, digits, dashes and underscores, starting with a letter or a
+// digit as run IDs do.
+var idRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// validateTaskID checks that taskID is safe to name the containers and collections of its
+// nodes with.
+func validateTaskID(taskID string) error {
+	if !idRegexp.MatchString(taskID) {
+		return fmt.Errorf("task ID %q is not made of letters, digits, dashes and underscores", taskID)
+	}
+	return nil
+}
+
+// source is where a node input comes from: either an upstream node or a raw collection.
+type source struct {
+	node       string
+	collection string
+}
+
+type graph struct {
+	nodes    map[string]Node
+	inputs   map[string]map[string]source
+	parents  map[string][]string
+	children map[string][]string
+	order    []string
+}
+
+// newGraph validates the pipeline and sorts its nodes topologically.
+func newGraph(p Pipeline) (*graph, error) {
+	g := &graph{
+		nodes:    make(map[string]Node, len(p.Nodes)),
+		inputs:   make(map[string]map[string]source, len(p.Nodes)),
+		parents:  make(map[string][]string),
+		children: make(map[string][]string),
+	}
+	for _, n := range p.Nodes {
+		if n.ID == "" {
+			return nil, fmt.Errorf("node for factor %q has no ID", n.Factor.FactorName)
+		}
+		if !idRegexp.MatchString(n.ID) {
+			return nil, fmt.Errorf("node ID %q is not made of letters, digits, dashes and underscores", n.ID)
+		}
+		if _, ok := g.nodes[n.ID]; ok {
+			return nil, fmt.Errorf("duplicate node ID %q", n.ID)
+		}
+		if err := n.Factor.Validate(); err != nil {
+			return nil, fmt.Errorf("node %q: %w", n.ID, err)
+		}
+		if err := n.storage().Validate(n.Factor); err != nil {
+			return nil, fmt.Errorf("node %q: %w", n.ID, err)
+		}
+		g.nodes[n.ID] = n
+		g.inputs[n.ID] = make(map[string]source)
+	}
+	for _, e := range p.Edges {
+		if _, ok := g.nodes[e.From]; !ok {
+			return nil, fmt.Errorf("edge %s -> %s: unknown node %q", e.From, e.To, e.From)
+		}
+		if _, ok := g.nodes[e.To]; !ok {
+			return nil, fmt.Errorf("edge %s -> %s: unknown node %q", e.From, e.To, e.To)
+		}
+		to := g.nodes[e.To].Factor
+		if len(to.Inputs) == 0 && e.Input != "" {
+			return nil, fmt.Errorf("edge %s -> %s: factor %s has no named inputs", e.From, e.To, to.FactorName)
+		}
+		if len(to.Inputs) > 0 && !to.HasInput(e.Input) {
+			return nil, fmt.Errorf("edge %s -> %s: factor %s has no input %q", e.From, e.To, to.FactorName, e.Input)
+		}
+		if !g.nodes[e.To].Source.Reads(g.nodes[e.From].Sink) {
+			return nil, fmt.Errorf("edge %s -> %s: source of %s cannot read the sink of %s", e.From, e.To, e.To, e.From)
+		}
+		if _, ok := g.inputs[e.To][e.Input]; ok {
+			return nil, fmt.Errorf("edge %s -> %s: input %q is fed more than once", e.From, e.To, e.Input)
+		}
+		g.inputs[e.To][e.Input] = source{node: e.From}
+		g.parents[e.To] = append(g.parents[e.To], e.From)
+		g.children[e.From] = append(g.children[e.From], e.To)
+	}
+	for _, n := range p.Nodes {
+		if err := bindCollections(n, g.inputs[n.ID]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Kahn's algorithm, keeping the declaration order among ready nodes
+	inDegree := make(map[string]int, len(p.Nodes))
+	var queue []string
+	for _, n := range p.Nodes {
+		inDegree[n.ID] = len(g.parents[n.ID])
+		if inDegree[n.ID] == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		g.order = append(g.order, id)
+		for _, child := range g.children[id] {
+			inDegree[child]--
+			if inDegree[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+	if len(g.order) != len(p.Nodes) {
+		return nil, fmt.Errorf("pipeline contains a cycle")
+	}
+	return g, nil
+}
+
+// descendants returns every node reachable from id, excluding id itself.
+func (g *graph) descendants(id string) []string {
+	var ret []string
+	seen := map[string]bool{id: true}
+	stack := append([]string(nil), g.children[id]...)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		ret = append(ret, n)
+		stack = append(stack, g.children[n]...)
+	}
+	return ret
+}
+
+// bindCollections adds the raw collections of the node to the inputs fed by edges
+// and checks that every input of its factor is bound exactly once.
+func bindCollections(n Node, inputs map[string]source) error {
+	if len(n.Factor.Inputs) == 0 {
+		if len(n.Inputs) > 0 {
+			return fmt.Errorf("node %q: factor %s has no named inputs", n.ID, n.Factor.FactorName)
+		}
+		if _, ok := inputs[""]; ok {
+			if n.Collection != "" {
+				return fmt.Errorf("node %q has both an upstream node and a collection", n.ID)
+			}
+			return nil
+		}
+		if n.Collection == "" {
+			return fmt.Errorf("node %q has neither an upstream node nor a collection", n.ID)
+		}
+		inputs[""] = source{collection: n.Collection}
+		return nil
+	}
+
+	if n.Collection != "" {
+		return fmt.Errorf("node %q: factor %s has named inputs, use Inputs instead of Collection", n.ID, n.Factor.FactorName)
+	}
+	for name, coll := range n.Inputs {
+		if !n.Factor.HasInput(name) {
+			return fmt.Errorf("node %q: factor %s has no input %q", n.ID, n.Factor.FactorName, name)
+		}
+		if _, ok := inputs[name]; ok {
+			return fmt.Errorf("node %q: input %q has both an upstream node and a collection", n.ID, name)
+		}
+		inputs[name] = source{collection: coll}
+	}
+	for _, in := range n.Factor.Inputs {
+		if _, ok := inputs[in.Name]; !ok {
+			return fmt.Errorf("node %q: input %q is not bound", n.ID, in.Name)
+		}
+	}
+	return nil
+}
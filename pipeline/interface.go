@@ -0,0 +1,7 @@
+package pipeline
+
+import "context"
+
+type Interface interface {
+	Run(ctx context.Context, taskID string, p Pipeline) (Report, error)
+}
@@ -0,0 +1,385 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+func testFactor(name string, inputs ...string) factor.Factor {
+	f := factor.Factor{FactorName: name, FactorCode: "def " + name + "(df):\n    return df\n"}
+	for _, in := range inputs {
+		f.Inputs = append(f.Inputs, factor.Input{Name: in})
+	}
+	return f
+}
+
+func node(id string, f factor.Factor, collection string) Node {
+	return Node{ID: id, Factor: f, Image: "factor-" + strings.ToLower(f.FactorName), Collection: collection}
+}
+
+func TestNewGraphOrder(t *testing.T) {
+	// a diamond, declared out of order
+	p := Pipeline{
+		Nodes: []Node{
+			node("join", testFactor("join", "left", "right"), ""),
+			node("left", testFactor("ema"), ""),
+			node("trades", testFactor("clean"), "trades"),
+			node("right", testFactor("sma"), ""),
+			node("other", testFactor("clean"), "quotes"),
+		},
+		Edges: []Edge{
+			{From: "left", To: "join", Input: "left"},
+			{From: "right", To: "join", Input: "right"},
+			{From: "trades", To: "left"},
+			{From: "trades", To: "right"},
+		},
+	}
+	g, err := newGraph(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ready nodes keep their declaration order
+	if got, want := strings.Join(g.order, " "), "trades other left right join"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	descendants := g.descendants("trades")
+	if len(descendants) != 3 {
+		t.Errorf("descendants of trades = %v", descendants)
+	}
+	if got := g.descendants("join"); len(got) != 0 {
+		t.Errorf("descendants of join = %v", got)
+	}
+	if got := g.inputs["trades"][""]; got.collection != "trades" {
+		t.Errorf("input of trades = %+v", got)
+	}
+	if got := g.inputs["join"]["right"]; got.node != "right" {
+		t.Errorf("right input of join = %+v", got)
+	}
+}
+
+func TestNewGraphErrors(t *testing.T) {
+	single := testFactor("sma")
+	named := testFactor("join", "left", "right")
+	tests := []struct {
+		name string
+		p    Pipeline
+		err  string
+	}{
+		{
+			name: "cycle",
+			p: Pipeline{
+				Nodes: []Node{node("a", single, ""), node("b", single, "")},
+				Edges: []Edge{{From: "a", To: "b"}, {From: "b", To: "a"}},
+			},
+			err: "cycle",
+		},
+		{
+			name: "duplicate ID",
+			p:    Pipeline{Nodes: []Node{node("a", single, "trades"), node("a", single, "trades")}},
+			err:  "duplicate node ID",
+		},
+		{
+			name: "no ID",
+			p:    Pipeline{Nodes: []Node{node("", single, "trades")}},
+			err:  "has no ID",
+		},
+		{
+			name: "node ID",
+			p:    Pipeline{Nodes: []Node{node("../a", single, "trades")}},
+			err:  "node ID",
+		},
+		{
+			name: "invalid factor",
+			p:    Pipeline{Nodes: []Node{node("a", factor.Factor{FactorName: "1sma"}, "trades")}},
+			err:  "not a valid Python identifier",
+		},
+		{
+			name: "unknown node",
+			p:    Pipeline{Nodes: []Node{node("a", single, "trades")}, Edges: []Edge{{From: "a", To: "b"}}},
+			err:  `unknown node "b"`,
+		},
+		{
+			name: "no input",
+			p:    Pipeline{Nodes: []Node{node("a", single, "")}},
+			err:  "neither an upstream node nor a collection",
+		},
+		{
+			name: "upstream node and collection",
+			p: Pipeline{
+				Nodes: []Node{node("a", single, "trades"), node("b", single, "trades")},
+				Edges: []Edge{{From: "a", To: "b"}},
+			},
+			err: "both an upstream node and a collection",
+		},
+		{
+			name: "input fed twice",
+			p: Pipeline{
+				Nodes: []Node{node("a", single, "trades"), node("b", single, "trades"), node("c", single, "")},
+				Edges: []Edge{{From: "a", To: "c"}, {From: "b", To: "c"}},
+			},
+			err: "fed more than once",
+		},
+		{
+			name: "unknown named input",
+			p: Pipeline{
+				Nodes: []Node{node("a", single, "trades"), node("b", named, "")},
+				Edges: []Edge{{From: "a", To: "b", Input: "middle"}},
+			},
+			err: `no input "middle"`,
+		},
+		{
+			name: "named input unbound",
+			p: Pipeline{
+				Nodes: []Node{node("a", single, "trades"), node("b", named, "")},
+				Edges: []Edge{{From: "a", To: "b", Input: "left"}},
+			},
+			err: `input "right" is not bound`,
+		},
+		{
+			name: "collection of named inputs",
+			p:    Pipeline{Nodes: []Node{node("a", named, "trades")}},
+			err:  "use Inputs instead of Collection",
+		},
+		{
+			name: "source not reading sink",
+			p: Pipeline{
+				Nodes: []Node{
+					{ID: "a", Factor: single, Collection: "trades", Sink: factor.Sink{Kind: factor.SinkFile, Options: map[string]string{factor.OptionDir: "/data"}}},
+					node("b", single, ""),
+				},
+				Edges: []Edge{{From: "a", To: "b"}},
+			},
+			err: "cannot read the sink",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newGraph(tt.p)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("newGraph() error = %v, want one about %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// fakeRunner fails the runs of the containers in failures with their errors in turn, and
+// records the arguments of every run.
+type fakeRunner struct {
+	containerize.Interface
+	workspace string
+	failures  map[string][]error
+
+	mu   sync.Mutex
+	runs map[string][][]string
+}
+
+func (f *fakeRunner) ImageDigest(_ context.Context, image string) (string, error) {
+	return image + "@sha256:0", nil
+}
+
+func (f *fakeRunner) RunFactor(_ context.Context, image, code, containerName string, args []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.runs == nil {
+		f.runs = map[string][][]string{}
+	}
+	f.runs[containerName] = append(f.runs[containerName], args)
+	if errs := f.failures[containerName]; len(errs) > 0 {
+		f.failures[containerName] = errs[1:]
+		return errs[0]
+	}
+	dir := filepath.Join(f.workspace, containerName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(factor.Stats{RowsIn: 10, RowsOut: 5})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, factor.StatsFilename), b, 0o644)
+}
+
+func newTestOrchestrator(t *testing.T, runner *fakeRunner) Interface {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.Retry = config.Retry{MaxAttempts: 1}
+	runner.workspace = cfg.Workspace
+	return New(runner, cfg, logging.New(io.Discard, "text", logging.LevelInfo))
+}
+
+// arg is the value of flag in args.
+func arg(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestRun(t *testing.T) {
+	runner := &fakeRunner{}
+	p := Pipeline{
+		Nodes: []Node{node("clean", testFactor("clean"), "trades"), node("ema", testFactor("ema"), "")},
+		Edges: []Edge{{From: "clean", To: "ema"}},
+	}
+	report, err := newTestOrchestrator(t, runner).Run(context.Background(), "task", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed() || len(report.Nodes) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	clean, ema := report.Nodes[0], report.Nodes[1]
+	if clean.OutputCollection != "task.clean.clean" || ema.InputCollections[""] != clean.OutputCollection {
+		t.Errorf("ema reads %v, clean writes %s", ema.InputCollections, clean.OutputCollection)
+	}
+	if got := arg(runner.runs["task-ema"][0], "--collection"); got != clean.OutputCollection {
+		t.Errorf("ema ran with --collection %s", got)
+	}
+	if got := arg(runner.runs["task-ema"][0], "--task_id"); got != "task.ema" {
+		t.Errorf("ema ran with --task_id %s", got)
+	}
+	prov := ema.Provenance
+	if prov.ImageDigest != "factor-ema@sha256:0" || prov.CodeHash == "" || prov.Stats.RowsOut != 5 || len(prov.Attempts) != 1 {
+		t.Errorf("provenance = %+v", prov)
+	}
+}
+
+func TestRunNamedInputs(t *testing.T) {
+	runner := &fakeRunner{}
+	join := node("join", testFactor("join", "left", "right"), "")
+	join.Inputs = map[string]string{"right": "quotes"}
+	p := Pipeline{
+		Nodes: []Node{node("clean", testFactor("clean"), "trades"), join},
+		Edges: []Edge{{From: "clean", To: "join", Input: "left"}},
+	}
+	if _, err := newTestOrchestrator(t, runner).Run(context.Background(), "task", p); err != nil {
+		t.Fatal(err)
+	}
+	args := runner.runs["task-join"][0]
+	if arg(args, "--input_left") != "task.clean.clean" || arg(args, "--input_right") != "quotes" || arg(args, "--collection") != "" {
+		t.Errorf("join ran with %v", args)
+	}
+}
+
+func TestRunSkipsDescendantsOfFailedNodes(t *testing.T) {
+	runner := &fakeRunner{failures: map[string][]error{"task-left": {&containerize.ExitError{Code: 1}}}}
+	p := Pipeline{
+		Nodes: []Node{
+			node("trades", testFactor("clean"), "trades"),
+			node("left", testFactor("ema"), ""),
+			node("right", testFactor("sma"), ""),
+			node("join", testFactor("join", "left", "right"), ""),
+			node("after", testFactor("rank"), ""),
+		},
+		Edges: []Edge{
+			{From: "trades", To: "left"},
+			{From: "trades", To: "right"},
+			{From: "left", To: "join", Input: "left"},
+			{From: "right", To: "join", Input: "right"},
+			{From: "join", To: "after"},
+		},
+	}
+	report, err := newTestOrchestrator(t, runner).Run(context.Background(), "task", p)
+	if err == nil || !strings.Contains(err.Error(), "3 of 5") {
+		t.Errorf("Run() error = %v", err)
+	}
+	if !report.Failed() {
+		t.Error("report did not fail")
+	}
+	want := map[string]State{
+		"trades": StateSucceeded,
+		"left":   StateFailed,
+		"right":  StateSucceeded,
+		"join":   StateSkipped,
+		"after":  StateSkipped,
+	}
+	for _, st := range report.Nodes {
+		if st.State != want[st.ID] {
+			t.Errorf("node %s is %s, want %s", st.ID, st.State, want[st.ID])
+		}
+	}
+	if _, ran := runner.runs["task-join"]; ran {
+		t.Error("skipped node ran")
+	}
+	var exitErr *containerize.ExitError
+	if st := report.Nodes[1]; !errors.As(st.Err, &exitErr) || st.Provenance.ExitCode != 1 {
+		t.Errorf("failed node = %+v", st)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	transient := &containerize.ExitError{Code: factor.ExitTransient}
+	tests := []struct {
+		name     string
+		failures []error
+		attempts int
+		err      bool
+	}{
+		{"transient", []error{transient}, 2, false},
+		{"exhausted", []error{transient, transient, transient}, 3, true},
+		{"permanent", []error{&containerize.ExitError{Code: 1}}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{failures: map[string][]error{"task-ema": tt.failures}}
+			n := node("ema", testFactor("ema"), "trades")
+			n.Retry = config.Retry{MaxAttempts: 3}
+			report, err := newTestOrchestrator(t, runner).Run(context.Background(), "task", Pipeline{Nodes: []Node{n}})
+			if (err != nil) != tt.err {
+				t.Errorf("Run() error = %v", err)
+			}
+			attempts := report.Nodes[0].Provenance.Attempts
+			if len(attempts) != tt.attempts || len(runner.runs["task-ema"]) != tt.attempts {
+				t.Fatalf("attempts = %+v", attempts)
+			}
+			for i, a := range attempts[:len(attempts)-1] {
+				if a.Number != i+1 || a.Class == "" || a.ExitCode == 0 {
+					t.Errorf("failed attempt = %+v", a)
+				}
+			}
+		})
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	runner := &fakeRunner{}
+	p := Pipeline{Nodes: []Node{node("a", testFactor("sma"), "")}}
+	if _, err := newTestOrchestrator(t, runner).Run(context.Background(), "task", p); err == nil {
+		t.Error("Run() of an invalid pipeline succeeded")
+	}
+	if len(runner.runs) != 0 {
+		t.Error("invalid pipeline ran")
+	}
+}
+
+func TestRunInvalidTaskID(t *testing.T) {
+	p := Pipeline{Nodes: []Node{node("a", testFactor("sma"), "trades")}}
+	for _, taskID := range []string{"", "../task", "task.1", "task 1", "-task"} {
+		runner := &fakeRunner{}
+		if _, err := newTestOrchestrator(t, runner).Run(context.Background(), taskID, p); err == nil || !strings.Contains(err.Error(), "task ID") {
+			t.Errorf("Run() of task %q error = %v", taskID, err)
+		}
+		if len(runner.runs) != 0 {
+			t.Errorf("task %q ran", taskID)
+		}
+	}
+	// run IDs
+	if err := validateTaskID(runs.NewID()); err != nil {
+		t.Error(err)
+	}
+}
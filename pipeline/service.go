@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/bars"
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/metrics"
+	"github.com/nathanusask/docker-go-demo/query"
+	"github.com/nathanusask/docker-go-demo/retry"
+	"github.com/nathanusask/docker-go-demo/tracing"
+)
+
+type orchestrator struct {
+	runner containerize.Interface
+	bars   bars.Interface
+	cfg    config.Config
+	log    *logging.Logger
+}
+
+// Run executes the pipeline, starting every node as soon as all of its upstream nodes have succeeded.
+// Nodes downstream of a failed node are skipped. The returned report is always populated
+// for a valid pipeline; err is non-nil if any node did not succeed.
+func (o orchestrator) Run(ctx context.Context, taskID string, p Pipeline) (report Report, err error) {
+	ctx = logging.WithFields(ctx, logging.RunID, taskID)
+	ctx = containerize.WithRunID(ctx, taskID)
+	ctx, span := tracing.Start(ctx, "pipeline", "run.id", taskID, "nodes", len(p.Nodes))
+	defer func() { span.End(err) }()
+	logger := o.log.Ctx(ctx)
+	if err := validateTaskID(taskID); err != nil {
+		logger.Error("invalid task ID", "error", err)
+		return Report{}, err
+	}
+	g, err := newGraph(p)
+	if err != nil {
+		logger.Error("invalid pipeline", "error", err)
+		return Report{}, err
+	}
+
+	statuses := make(map[string]*NodeStatus, len(g.order))
+	remaining := make(map[string]int, len(g.order))
+	for _, id := range g.order {
+		node := g.nodes[id]
+		statuses[id] = &NodeStatus{
+			ID:               id,
+			State:            StatePending,
+			OutputCollection: OutputCollection(taskID, node),
+		}
+		remaining[id] = len(g.parents[id])
+	}
+	for _, id := range g.order {
+		st := statuses[id]
+		st.InputCollections = make(map[string]string, len(g.inputs[id]))
+		for name, src := range g.inputs[id] {
+			if src.node != "" {
+				st.InputCollections[name] = statuses[src.node].OutputCollection
+			} else {
+				st.InputCollections[name] = src.collection
+			}
+		}
+	}
+
+	type result struct {
+		id         string
+		provenance Provenance
+		err        error
+	}
+	done := make(chan result)
+	running := 0
+	start := func(id string) {
+		st := statuses[id]
+		st.State = StateRunning
+		st.StartedAt = time.Now()
+		running++
+		node := g.nodes[id]
+		nodeCtx := logging.WithFields(ctx,
+			logging.Node, id,
+			logging.Factor, node.Factor.FactorName,
+			logging.FactorVersion, node.Factor.Version(),
+		)
+		o.log.Ctx(nodeCtx).Info("starting node", "inputs", fmt.Sprint(st.InputCollections))
+		go func(node Node, inputs map[string]string) {
+			started := time.Now()
+			ctx, span := tracing.Start(nodeCtx, "node", "node", node.ID, "factor", node.Factor.FactorName, "factor.version", node.Factor.Version())
+			provenance, err := o.runNode(ctx, taskID, node, inputs)
+			span.End(err)
+			observe(nodeCtx, node, provenance, started, err)
+			done <- result{node.ID, provenance, err}
+		}(node, st.InputCollections)
+	}
+
+	for _, id := range g.order {
+		if remaining[id] == 0 {
+			start(id)
+		}
+	}
+	for running > 0 {
+		r := <-done
+		running--
+		st := statuses[r.id]
+		st.FinishedAt = time.Now()
+		st.Provenance = r.provenance
+		if r.err != nil {
+			logger.Error("node failed", logging.Node, r.id, "error", r.err)
+			st.State = StateFailed
+			st.Err = r.err
+			for _, d := range g.descendants(r.id) {
+				if statuses[d].State == StatePending {
+					logger.Info("skipping node because an upstream node failed", logging.Node, d, "upstream", r.id)
+					statuses[d].State = StateSkipped
+					statuses[d].Err = fmt.Errorf("upstream node %q failed", r.id)
+				}
+			}
+			continue
+		}
+		logger.Info("node succeeded", logging.Node, r.id, "output", st.OutputCollection)
+		st.State = StateSucceeded
+		for _, child := range g.children[r.id] {
+			remaining[child]--
+			if remaining[child] == 0 && statuses[child].State == StatePending {
+				start(child)
+			}
+		}
+	}
+
+	report = Report{TaskID: taskID}
+	failed := 0
+	for _, id := range g.order {
+		report.Nodes = append(report.Nodes, *statuses[id])
+		if statuses[id].State != StateSucceeded {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return report, fmt.Errorf("pipeline %s: %d of %d nodes did not succeed", taskID, failed, len(g.order))
+	}
+	return report, nil
+}
+
+// observe records the metrics of a node run.
+func observe(ctx context.Context, node Node, provenance Provenance, started time.Time, err error) {
+	name := node.Factor.FactorName
+	outcome := "succeeded"
+	switch {
+	case ctx.Err() != nil:
+		outcome = "cancelled"
+	case err != nil:
+		outcome = "failed"
+	}
+	metrics.Runs.Inc(name, outcome)
+	metrics.RunDuration.Since(started, name)
+	metrics.RowsRead.Add(float64(provenance.Stats.RowsIn), name)
+	metrics.RowsWritten.Add(float64(provenance.Stats.RowsOut), name)
+	if provenance.Usage.PeakMemoryBytes > 0 {
+		metrics.PeakMemory.Observe(float64(provenance.Usage.PeakMemoryBytes), name)
+	}
+	metrics.CPUSeconds.Add(provenance.Usage.CPUSeconds, name)
+	var exitErr *containerize.ExitError
+	if errors.As(err, &exitErr) && exitErr.OOMKilled {
+		metrics.OOMKills.Inc(name)
+	}
+}
+
+func (o orchestrator) runNode(ctx context.Context, taskID string, node Node, inputs map[string]string) (Provenance, error) {
+	provenance := Provenance{FactorVersion: node.Factor.Version()}
+	_, renderSpan := tracing.Start(ctx, "render")
+	code, err := factor.RenderString(node.Factor, o.cfg.Mongo, node.storage())
+	renderSpan.End(err)
+	if err != nil {
+		return provenance, err
+	}
+	provenance.CodeHash = factor.CodeHash(code)
+	imageCtx, imageSpan := tracing.Start(ctx, "resolve image", "image", node.Image)
+	provenance.ImageDigest, err = o.runner.ImageDigest(imageCtx, node.Image)
+	imageSpan.End(err)
+	if err != nil {
+		return provenance, err
+	}
+
+	args := []string{"--task_id", nodeTaskID(taskID, node)}
+	if len(node.Factor.Inputs) == 0 {
+		inArgs, err := o.inputArgs(ctx, node, "--collection", "--pipeline", inputs[""], node.Factor.Needs)
+		if err != nil {
+			return provenance, err
+		}
+		args = append(args, inArgs...)
+	}
+	for _, in := range node.Factor.Inputs {
+		inArgs, err := o.inputArgs(ctx, node, "--input_"+in.Name, "--pipeline_"+in.Name, inputs[in.Name], in.Needs)
+		if err != nil {
+			return provenance, err
+		}
+		args = append(args, inArgs...)
+	}
+	if !node.Source.IsMongo() && node.Start < node.End {
+		args = append(args, "--start", strconv.FormatInt(node.Start, 10), "--end", strconv.FormatInt(node.End, 10))
+	}
+	params, err := node.Factor.Args(node.Params)
+	if err != nil {
+		return provenance, err
+	}
+	args = append(args, params...)
+	args = append(args, node.Args...)
+
+	// run in the resolved image so that the recorded digest is the image that ran
+	name := ContainerName(taskID, node)
+	err = o.attempt(ctx, node, &provenance, func(ctx context.Context) error {
+		return o.runner.RunFactor(ctx, provenance.ImageDigest, code, name, args)
+	})
+	var usageErr error
+	if provenance.Usage, usageErr = containerize.ReadResourceUsage(filepath.Join(o.cfg.Workspace, name)); usageErr != nil {
+		o.log.Ctx(ctx).Error("failed to read resource usage", "error", usageErr)
+	}
+	if err != nil {
+		return provenance, err
+	}
+
+	// verify what the run reports about its result
+	_, verifySpan := tracing.Start(ctx, "verify")
+	if provenance.Stats, err = factor.ReadStats(filepath.Join(o.cfg.Workspace, name)); err != nil {
+		o.log.Ctx(ctx).Error("failed to read row counts", "error", err)
+	}
+	verifySpan.SetAttributes("rows.in", provenance.Stats.RowsIn, "rows.out", provenance.Stats.RowsOut)
+	verifySpan.End(err)
+	return provenance, nil
+}
+
+// attempt calls run until it succeeds, fails permanently or the retry policy of node is
+// exhausted, recording every attempt in provenance. Only the container is run again;
+// failures preparing it are not transient. An attempt replaces the output of those before
+// it, which main.py writes aside and renames over its output collection.
+func (o orchestrator) attempt(ctx context.Context, node Node, provenance *Provenance, run func(ctx context.Context) error) error {
+	policy := node.Retry
+	if policy.MaxAttempts == 0 {
+		policy = o.cfg.Retry
+	}
+	logger := o.log.Ctx(ctx)
+	for n := 1; ; n++ {
+		attemptCtx, span := tracing.Start(ctx, "attempt", "attempt", n)
+		a := retry.Attempt{Number: n, StartedAt: time.Now()}
+		err := run(attemptCtx)
+		span.End(err)
+		a.FinishedAt = time.Now()
+		provenance.ExitCode = 0
+		var exitErr *containerize.ExitError
+		if errors.As(err, &exitErr) {
+			provenance.ExitCode = exitErr.Code
+			a.ExitCode = exitErr.Code
+		}
+		if err == nil {
+			provenance.Attempts = append(provenance.Attempts, a)
+			return nil
+		}
+		a.Error = err.Error()
+		a.Class = retry.Classify(err)
+		if ctx.Err() != nil {
+			a.Class = retry.Permanent
+		}
+		provenance.Attempts = append(provenance.Attempts, a)
+		if a.Class != retry.Retryable || n >= policy.MaxAttempts {
+			return err
+		}
+
+		backoff := retry.Backoff(policy, n)
+		logger.Warn("attempt failed, retrying", "attempt", n, "max_attempts", policy.MaxAttempts, "backoff", backoff, "error", err)
+		metrics.Retries.Inc(node.Factor.FactorName)
+		if err := retry.Sleep(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// inputArgs returns the main.py arguments reading collection, materializing bars first
+// when the factor reads bars instead of trades. Sources other than MongoDB take no pipeline
+// and filter on their own.
+func (o orchestrator) inputArgs(ctx context.Context, node Node, collectionFlag, pipelineFlag, collection string, needs factor.Needs) ([]string, error) {
+	if !node.Source.IsMongo() {
+		return []string{collectionFlag, collection}, nil
+	}
+	if !needs.Bars.IsZero() {
+		barsCollection, err := o.bars.Materialize(ctx, node.Image, collection, needs.Bars, node.Start, node.End)
+		if err != nil {
+			return nil, err
+		}
+		collection = barsCollection
+		needs = factor.Needs{Fields: needs.Fields}
+	}
+	pl, err := query.JSON(query.Build(query.Spec{Start: node.Start, End: node.End, Needs: needs}))
+	if err != nil {
+		return nil, err
+	}
+	return []string{collectionFlag, collection, pipelineFlag, pl}, nil
+}
+
+func (n Node) storage() factor.Storage {
+	return factor.Storage{Source: n.Source, Sink: n.Sink}
+}
+
+// nodeTaskID is the task ID handed to a node's main.py; it keeps output collections
+// of nodes sharing a factor apart.
+func nodeTaskID(taskID string, node Node) string {
+	return taskID + "." + node.ID
+}
+
+// OutputCollection is the collection the node writes to, mirroring the output collection
+// naming of PythonMainTemplate.
+func OutputCollection(taskID string, node Node) string {
+	return nodeTaskID(taskID, node) + "." + node.Factor.FactorName
+}
+
+// ContainerName is the name of the container running the node.
+func ContainerName(taskID string, node Node) string {
+	return strings.ToLower(taskID + "-" + node.ID)
+}
+
+func New(runner containerize.Interface, cfg config.Config, logger *logging.Logger) Interface {
+	return &orchestrator{runner, bars.New(runner, cfg.Mongo, logger), cfg, logger}
+}
@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/retry"
+)
+
+// Node is a single factor run inside a pipeline.
+type Node struct {
+	ID     string
+	Factor factor.Factor
+	Image  string
+	// Collection is the raw input collection of a single-input factor, used only when the node
+	// has no upstream edge.
+	Collection string
+	// Inputs maps named inputs of the factor that are not fed by an upstream edge to raw collections.
+	Inputs map[string]string
+	// Start and End bound the trades read from every input to [Start, End) in milliseconds;
+	// End <= Start reads everything.
+	Start int64
+	End   int64
+	// Params are the factor parameter values, validated and encoded by Factor.Args.
+	Params map[string]string
+	// Args are extra arguments passed to the generated main.py after the parameters.
+	Args []string
+	// Source and Sink default to MongoDB. A node fed by an upstream edge must read what
+	// the upstream node writes.
+	Source factor.Source
+	Sink   factor.Sink
+	// Retry is the retry policy of the node's run; zero means the configured policy.
+	Retry config.Retry
+}
+
+// Edge feeds the output collection of node From into node To.
+type Edge struct {
+	From string
+	To   string
+	// Input is the named input of To's factor fed by this edge; empty for single-input factors.
+	Input string
+}
+
+type Pipeline struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateSkipped   State = "skipped"
+)
+
+// NodeStatus is the outcome of one node of a pipeline run.
+type NodeStatus struct {
+	ID    string
+	State State
+	// InputCollections maps input names to the collections read, with the empty name
+	// standing for the --collection input of single-input factors.
+	InputCollections map[string]string
+	OutputCollection string
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	Err              error
+	Provenance       Provenance
+}
+
+// Provenance is what produced the output of a node, recorded once its container ran.
+type Provenance struct {
+	FactorVersion string
+	CodeHash      string
+	// ImageDigest is the image the node ran in, resolved before the run.
+	ImageDigest string
+	// ExitCode is the exit status of main.py; zero when it could not be started.
+	ExitCode int64
+	Stats    factor.Stats
+	// Usage is what the container used, recorded for failed runs too.
+	Usage containerize.ResourceUsage
+	// Attempts are the executions of main.py, the last one deciding the outcome.
+	Attempts []retry.Attempt
+}
+
+// Report holds the status of every node, in topological order.
+type Report struct {
+	TaskID string
+	Nodes  []NodeStatus
+}
+
+// Failed reports whether any node failed or was skipped.
+func (r Report) Failed() bool {
+	for _, n := range r.Nodes {
+		if n.State == StateFailed || n.State == StateSkipped {
+			return true
+		}
+	}
+	return false
+}
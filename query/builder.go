@@ -0,0 +1,108 @@
+package query
+
+import (
+	"encoding/json"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+// M is a MongoDB document.
+type M map[string]interface{}
+
+// Stage is a single stage of an aggregation pipeline.
+type Stage = M
+
+// Spec describes what to read from a trade collection.
+type Spec struct {
+	// Start and End bound ts to [Start, End) in milliseconds; End <= Start reads everything.
+	Start int64
+	End   int64
+	Needs factor.Needs
+}
+
+// Build generates the aggregation pipeline for spec. The time filter always comes first so
+// MongoDB can use the ts index, followed by either a projection of the needed fields or,
+// when spec.Needs.BucketMs is set, OHLCV bucketing.
+func Build(spec Spec) []Stage {
+	var stages []Stage
+	if spec.Start < spec.End {
+		stages = append(stages, Stage{"$match": M{"ts": M{"$gte": spec.Start, "$lt": spec.End}}})
+	}
+	if spec.Needs.BucketMs > 0 {
+		return append(stages, bucket(spec.Needs.BucketMs)...)
+	}
+	return append(stages, project(spec.Needs.Fields))
+}
+
+// JSON encodes the pipeline the way the generated main.py expects it in --pipeline.
+func JSON(stages []Stage) (string, error) {
+	b, err := json.Marshal(stages)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func project(fields []string) Stage {
+	projection := M{"_id": 0}
+	if len(fields) > 0 {
+		projection["ts"] = 1
+		for _, f := range fields {
+			projection[f] = 1
+		}
+	}
+	return Stage{"$project": projection}
+}
+
+// bucket aggregates trades into bars of the given width, with ts set to the bar open time.
+func bucket(ms int64) []Stage {
+	return []Stage{
+		{"$project": M{
+			"_id":       0,
+			"ts":        1,
+			"price":     M{"$toDouble": "$price"},
+			"amount":    M{"$toDouble": "$amount"},
+			"direction": 1,
+		}},
+		{"$sort": M{"ts": 1}},
+		{"$group": M{
+			"_id":         M{"$subtract": []interface{}{"$ts", M{"$mod": []interface{}{"$ts", ms}}}},
+			"open":        M{"$first": "$price"},
+			"high":        M{"$max": "$price"},
+			"low":         M{"$min": "$price"},
+			"close":       M{"$last": "$price"},
+			"volume":      M{"$sum": "$amount"},
+			"buy_volume":  M{"$sum": sideAmount("buy")},
+			"sell_volume": M{"$sum": sideAmount("sell")},
+			"trades":      M{"$sum": 1},
+		}},
+		{"$sort": M{"_id": 1}},
+		{"$project": M{
+			"_id":         0,
+			"ts":          "$_id",
+			"open":        1,
+			"high":        1,
+			"low":         1,
+			"close":       1,
+			"volume":      1,
+			"buy_volume":  1,
+			"sell_volume": 1,
+			"trades":      1,
+		}},
+	}
+}
+
+func sideAmount(direction string) M {
+	return M{"$cond": []interface{}{M{"$eq": []interface{}{"$direction", direction}}, "$amount", 0}}
+}
+
+// Merge is the final stage writing the pipeline output into collection, replacing documents
+// with the same ts. collection needs a unique index on ts.
+func Merge(collection string) Stage {
+	return Stage{"$merge": M{
+		"into":           collection,
+		"on":             "ts",
+		"whenMatched":    "replace",
+		"whenNotMatched": "insert",
+	}}
+}
@@ -0,0 +1,65 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		spec Spec
+		want string
+	}{
+		{
+			name: "everything",
+			want: `[{"$project":{"_id":0}}]`,
+		},
+		{
+			name: "time range and fields",
+			spec: Spec{Start: 1000, End: 2000, Needs: factor.Needs{Fields: []string{"price", "amount"}}},
+			want: `[{"$match":{"ts":{"$gte":1000,"$lt":2000}}},{"$project":{"_id":0,"amount":1,"price":1,"ts":1}}]`,
+		},
+		{
+			name: "empty range reads everything",
+			spec: Spec{Start: 2000, End: 1000, Needs: factor.Needs{Fields: []string{"price"}}},
+			want: `[{"$project":{"_id":0,"price":1,"ts":1}}]`,
+		},
+		{
+			name: "bucketed",
+			spec: Spec{Start: 0, End: 60000, Needs: factor.Needs{BucketMs: 60000, Fields: []string{"ignored"}}},
+			want: `[{"$match":{"ts":{"$gte":0,"$lt":60000}}},` +
+				`{"$project":{"_id":0,"amount":{"$toDouble":"$amount"},"direction":1,"price":{"$toDouble":"$price"},"ts":1}},` +
+				`{"$sort":{"ts":1}},` +
+				`{"$group":{"_id":{"$subtract":["$ts",{"$mod":["$ts",60000]}]},` +
+				`"buy_volume":{"$sum":{"$cond":[{"$eq":["$direction","buy"]},"$amount",0]}},` +
+				`"close":{"$last":"$price"},"high":{"$max":"$price"},"low":{"$min":"$price"},"open":{"$first":"$price"},` +
+				`"sell_volume":{"$sum":{"$cond":[{"$eq":["$direction","sell"]},"$amount",0]}},` +
+				`"trades":{"$sum":1},"volume":{"$sum":"$amount"}}},` +
+				`{"$sort":{"_id":1}},` +
+				`{"$project":{"_id":0,"buy_volume":1,"close":1,"high":1,"low":1,"open":1,"sell_volume":1,"trades":1,"ts":"$_id","volume":1}}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSON(Build(tt.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Build() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got, err := JSON([]Stage{Merge("out")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"$merge":{"into":"out","on":"ts","whenMatched":"replace","whenNotMatched":"insert"}}]`; got != want {
+		t.Errorf("Merge() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,9 @@
+package reconcile
+
+import "context"
+
+type Interface interface {
+	// Reconcile cleans up after the orchestrators of this instance that exited mid-run. It
+	// returns once the runs it re-attached to finished.
+	Reconcile(ctx context.Context) (Report, error)
+}
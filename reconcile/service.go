@@ -0,0 +1,200 @@
+// Package reconcile cleans up what orchestrators that exited mid-run left behind: their
+// containers, the runs they attended to and, eventually, the workspaces of these runs.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// Report is what a reconciliation found, by container name or run ID.
+type Report struct {
+	// Reattached are the runs in flight whose containers were attended to until they exited.
+	Reattached []string
+	// Orphaned are the containers of no run in flight, handled per the orphans policy.
+	Orphaned []string
+	// Lost are the runs in flight without a container, marked failed.
+	Lost []string
+	// Workspaces are the removed workspace directories of finished runs.
+	Workspaces []string
+}
+
+type reconciler struct {
+	runner containerize.Interface
+	runs   runs.Interface
+	cfg    config.Config
+	log    *logging.Logger
+}
+
+// Reconcile leaves alone the containers and runs of orchestrators that are still running,
+// which it tells by their boot IDs, see containerize.OwnerAlive.
+func (r reconciler) Reconcile(ctx context.Context) (Report, error) {
+	var report Report
+	instance := r.cfg.InstanceName()
+	logger := r.log.Ctx(ctx).With(logging.Phase, "reconcile", "instance", instance)
+	containers, err := r.runner.Containers(ctx, instance)
+	if err != nil {
+		logger.Error("failed to list containers", "error", err)
+		return report, err
+	}
+	all, err := r.runs.List()
+	if err != nil {
+		logger.Error("failed to list runs", "error", err)
+		return report, err
+	}
+	byID := make(map[string]runs.Run, len(all))
+	for _, run := range all {
+		byID[run.ID] = run
+	}
+
+	// attended are the runs with a container, which are not lost
+	attended := map[string]bool{}
+	var reattach []runs.Run
+	for _, c := range containers {
+		attended[c.RunID] = true
+		if containerize.OwnerAlive(r.cfg.Workspace, c.BootID) {
+			continue
+		}
+		if run, ok := byID[c.RunID]; ok && !run.Finished() && run.Container == c.Name {
+			reattach = append(reattach, run)
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, c.Name)
+		logger.Warn("found orphaned container", "container", c.Name, logging.RunID, c.RunID, "running", c.Running, "created", c.Created)
+		r.orphan(ctx, logger, c)
+	}
+
+	for _, run := range all {
+		if run.Finished() || attended[run.ID] || run.Instance != instance || run.BootID == "" || containerize.OwnerAlive(r.cfg.Workspace, run.BootID) {
+			continue
+		}
+		run.Status = runs.StatusFailed
+		run.Error = "the orchestrator exited before the run finished and its container is gone"
+		run.FinishedAt = time.Now()
+		if err := r.runs.Update(run); err != nil {
+			logger.Error("failed to mark lost run failed", logging.RunID, run.ID, "error", err)
+			continue
+		}
+		report.Lost = append(report.Lost, run.ID)
+		logger.Warn("marked lost run failed", logging.RunID, run.ID, logging.Factor, run.Factor)
+	}
+
+	report.Workspaces = r.removeWorkspaces(logger, all, attended)
+
+	var wg sync.WaitGroup
+	for _, run := range reattach {
+		report.Reattached = append(report.Reattached, run.ID)
+		wg.Add(1)
+		go func(run runs.Run) {
+			defer wg.Done()
+			if err := r.reattach(ctx, logger, run); err != nil && ctx.Err() == nil {
+				logger.Error("failed to re-attach to run", logging.RunID, run.ID, "error", err)
+			}
+		}(run)
+	}
+	wg.Wait()
+	return report, nil
+}
+
+// orphan applies the orphans policy to c.
+func (r reconciler) orphan(ctx context.Context, logger *logging.Logger, c containerize.Container) {
+	var err error
+	switch r.cfg.Reconcile.Orphans {
+	case config.OrphansRemove:
+		err = r.runner.Remove(ctx, c.Name)
+	case config.OrphansStop:
+		if c.Running {
+			err = r.runner.Stop(ctx, c.Name)
+		}
+	}
+	if err != nil {
+		logger.Error("failed to clean up orphaned container", "container", c.Name, "policy", r.cfg.Reconcile.Orphans, "error", err)
+	}
+}
+
+// reattach attends to the container of run until it exits and finishes the run the way
+// the orchestrator that started it would have.
+func (r reconciler) reattach(ctx context.Context, logger *logging.Logger, run runs.Run) error {
+	logger = logger.With(logging.RunID, run.ID, logging.Factor, run.Factor)
+	logger.Info("re-attaching to run", "container", run.Container)
+	// the run is this process's from now on, so other reconcilers leave it alone
+	run.BootID = containerize.BootID()
+	if err := r.runs.Update(run); err != nil {
+		return err
+	}
+
+	runErr := r.runner.Attach(containerize.WithRunID(ctx, run.ID), run.Container)
+	if ctx.Err() != nil {
+		// the container is left running for the next reconciliation
+		return ctx.Err()
+	}
+	// runs cancel may have finished the run meanwhile
+	if latest, err := r.runs.Get(run.ID); err == nil && latest.Finished() {
+		return nil
+	}
+	run.FinishedAt = time.Now()
+	var exitErr *containerize.ExitError
+	if errors.As(runErr, &exitErr) {
+		run.ExitCode = exitErr.Code
+	}
+	if runErr != nil {
+		run.Status = runs.StatusFailed
+		run.Error = runErr.Error()
+	} else {
+		run.Status = runs.StatusSucceeded
+		stats, err := factor.ReadStats(filepath.Join(r.cfg.Workspace, run.Container))
+		if err != nil {
+			logger.Error("failed to read row counts", "error", err)
+		}
+		run.RowsIn = stats.RowsIn
+		run.RowsOut = stats.RowsOut
+	}
+	logger.Info("re-attached run finished", "status", run.Status)
+	return r.runs.Update(run)
+}
+
+// removeWorkspaces removes the workspace directories of the runs that finished longer
+// than the retention ago. Only directories of known runs are removed, as the workspace
+// holds the registry and the run store too.
+func (r reconciler) removeWorkspaces(logger *logging.Logger, all []runs.Run, attended map[string]bool) []string {
+	retention := time.Duration(r.cfg.Reconcile.WorkspaceRetention)
+	if retention <= 0 {
+		return nil
+	}
+	var removed []string
+	for _, run := range all {
+		if !run.Finished() || attended[run.ID] || time.Since(run.FinishedAt) < retention {
+			continue
+		}
+		if run.Container == "" || run.Container != filepath.Base(run.Container) {
+			continue
+		}
+		dir := filepath.Join(r.cfg.Workspace, run.Container)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Error("failed to remove workspace", "dir", dir, "error", err)
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	if len(removed) > 0 {
+		logger.Info("removed workspaces of finished runs", "count", len(removed))
+	}
+	return removed
+}
+
+func New(runner containerize.Interface, runs runs.Interface, cfg config.Config, logger *logging.Logger) Interface {
+	return &reconciler{runner: runner, runs: runs, cfg: cfg, log: logger}
+}
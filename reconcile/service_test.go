@@ -0,0 +1,127 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/logging"
+	"github.com/nathanusask/docker-go-demo/runs"
+)
+
+// fakeRunner lists containers and records what is done to them.
+type fakeRunner struct {
+	containerize.Interface
+	containers []containerize.Container
+
+	mu       sync.Mutex
+	attached []string
+	removed  []string
+}
+
+func (f *fakeRunner) Containers(context.Context, string) ([]containerize.Container, error) {
+	return f.containers, nil
+}
+
+func (f *fakeRunner) Attach(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attached = append(f.attached, name)
+	return nil
+}
+
+func (f *fakeRunner) Remove(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	const instance = "host-a"
+	workspace := t.TempDir()
+	cfg := config.Default()
+	cfg.Workspace = workspace
+	cfg.Instance = instance
+	cfg.Reconcile.Orphans = config.OrphansRemove
+
+	// an exited orchestrator, whose boot ID no process holds
+	gone := "0123456789abcdef0123456789abcdef"
+	self := containerize.BootID()
+
+	store := runs.New(filepath.Join(workspace, "runs"))
+	for _, run := range []runs.Run{
+		// container of an exited orchestrator, attended to again
+		{ID: "reattach", Container: "reattach-c", Instance: instance, BootID: gone, Status: runs.StatusRunning},
+		// container of this process, left alone
+		{ID: "owned", Container: "owned-c", Instance: instance, BootID: self, Status: runs.StatusRunning},
+		// no container left of an exited orchestrator
+		{ID: "lost", Container: "lost-c", Instance: instance, BootID: gone, Status: runs.StatusRunning},
+		// no container yet of this process
+		{ID: "starting", Container: "starting-c", Instance: instance, BootID: self, Status: runs.StatusRunning},
+		// of another instance
+		{ID: "elsewhere", Container: "elsewhere-c", Instance: "host-b", BootID: gone, Status: runs.StatusRunning},
+		// recorded before boot IDs
+		{ID: "legacy", Container: "legacy-c", Instance: instance, Status: runs.StatusRunning},
+	} {
+		run.CreatedAt = time.Now()
+		if err := store.Create(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner := &fakeRunner{containers: []containerize.Container{
+		{Name: "reattach-c", RunID: "reattach", Instance: instance, BootID: gone},
+		{Name: "owned-c", RunID: "owned", Instance: instance, BootID: self, Running: true},
+		{Name: "orphan-c", RunID: "unknown", Instance: instance, BootID: gone},
+	}}
+
+	report, err := New(runner, store, cfg, logging.New(io.Discard, "text", logging.LevelInfo)).Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(what string, got []string, want ...string) {
+		t.Helper()
+		sort.Strings(got)
+		if len(got) != len(want) {
+			t.Errorf("%s = %q, want %q", what, got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s = %q, want %q", what, got, want)
+				return
+			}
+		}
+	}
+	check("reattached", report.Reattached, "reattach")
+	check("orphaned", report.Orphaned, "orphan-c")
+	check("lost", report.Lost, "lost")
+	check("attached containers", runner.attached, "reattach-c")
+	check("removed containers", runner.removed, "orphan-c")
+
+	for id, status := range map[string]runs.Status{
+		"reattach":  runs.StatusSucceeded,
+		"owned":     runs.StatusRunning,
+		"lost":      runs.StatusFailed,
+		"starting":  runs.StatusRunning,
+		"elsewhere": runs.StatusRunning,
+		"legacy":    runs.StatusRunning,
+	} {
+		run, err := store.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != status {
+			t.Errorf("run %s is %s, want %s", id, run.Status, status)
+		}
+		if id == "reattach" && run.BootID != self {
+			t.Errorf("re-attached run has boot ID %q, want this process's", run.BootID)
+		}
+	}
+}
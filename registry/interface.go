@@ -0,0 +1,13 @@
+package registry
+
+import "github.com/nathanusask/docker-go-demo/factor"
+
+// Interface stores factor definitions by name, keeping every version ever put.
+type Interface interface {
+	Put(f factor.Factor) error
+	// Get returns the latest version of the factor.
+	Get(name string) (factor.Factor, error)
+	// GetVersion returns the version of the factor identified by factor.Factor.Version.
+	GetVersion(name, version string) (factor.Factor, error)
+	List() ([]factor.Factor, error)
+}
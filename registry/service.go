@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+// ErrNotFound is returned by Get for unknown factors.
+var ErrNotFound = errors.New("factor not found")
+
+const (
+	ext         = ".yaml"
+	versionsDir = "versions"
+)
+
+var versionRegexp = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// fileRegistry keeps one YAML file per factor in dir, and every version of the factor
+// in dir/versions/<factor>/<version>.yaml.
+type fileRegistry struct {
+	dir string
+}
+
+func (r fileRegistry) Put(f factor.Factor) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, os.ModePerm); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	versionPath := r.versionPath(f.FactorName, f.Version())
+	if err := os.MkdirAll(filepath.Dir(versionPath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(versionPath, b, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path(f.FactorName), b, 0o644)
+}
+
+func (r fileRegistry) Get(name string) (factor.Factor, error) {
+	return r.read(name, r.path(name))
+}
+
+func (r fileRegistry) GetVersion(name, version string) (factor.Factor, error) {
+	if !versionRegexp.MatchString(version) {
+		return factor.Factor{}, fmt.Errorf("factor %s: invalid version %q", name, version)
+	}
+	f, err := r.read(name+"@"+version, r.versionPath(name, version))
+	if err != nil {
+		return f, err
+	}
+	// the version is the hash of the definition, so a mismatch means the file was edited
+	if f.Version() != version {
+		return f, fmt.Errorf("factor %s: version %s does not match its definition", name, version)
+	}
+	return f, nil
+}
+
+func (r fileRegistry) read(name, path string) (factor.Factor, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return factor.Factor{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return factor.Factor{}, err
+	}
+	var f factor.Factor
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return factor.Factor{}, fmt.Errorf("factor %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func (r fileRegistry) List() ([]factor.Factor, error) {
+	entries, err := os.ReadDir(r.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []factor.Factor
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		f, err := r.Get(strings.TrimSuffix(e.Name(), ext))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, f)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].FactorName < ret[j].FactorName })
+	return ret, nil
+}
+
+func (r fileRegistry) path(name string) string {
+	return filepath.Join(r.dir, strings.ToLower(name)+ext)
+}
+
+func (r fileRegistry) versionPath(name, version string) string {
+	return filepath.Join(r.dir, versionsDir, strings.ToLower(name), version+ext)
+}
+
+func New(dir string) Interface {
+	return &fileRegistry{dir}
+}
@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+func testFactor(name, code string) factor.Factor {
+	return factor.Factor{FactorName: name, FactorCode: code, ParamTypes: []factor.ParamType{{Name: "fast", Type: "int"}}}
+}
+
+func TestPutGet(t *testing.T) {
+	r := New(t.TempDir())
+	v1 := testFactor("MACD", "def MACD(df):\n    return df\n")
+	if err := r.Put(v1); err != nil {
+		t.Fatal(err)
+	}
+	v2 := testFactor("MACD", "def MACD(df, fast=12):\n    return df\n")
+	if err := r.Put(v2); err != nil {
+		t.Fatal(err)
+	}
+
+	// names are looked up ignoring case
+	got, err := r.Get("macd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FactorCode != v2.FactorCode || got.Version() != v2.Version() {
+		t.Errorf("Get() = %+v, want the latest version", got)
+	}
+	old, err := r.GetVersion("MACD", v1.Version())
+	if err != nil || old.FactorCode != v1.FactorCode {
+		t.Errorf("GetVersion() = %+v, %v", old, err)
+	}
+	if _, err := r.Get("RSI"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an unknown factor error = %v", err)
+	}
+	if _, err := r.GetVersion("MACD", "0123456789ab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVersion() of an unknown version error = %v", err)
+	}
+}
+
+func TestPutInvalid(t *testing.T) {
+	r := New(t.TempDir())
+	if err := r.Put(testFactor("MACD signal", "")); err == nil {
+		t.Error("Put() of an invalid factor succeeded")
+	}
+}
+
+func TestGetVersionInvalid(t *testing.T) {
+	dir := t.TempDir()
+	r := New(dir)
+	f := testFactor("MACD", "def MACD(df):\n    return df\n")
+	if err := r.Put(f); err != nil {
+		t.Fatal(err)
+	}
+	// versions name files, so they must not escape the registry
+	if _, err := r.GetVersion("MACD", "../../macd"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVersion() of a path error = %v", err)
+	}
+
+	// an edited version no longer matches its hash
+	path := filepath.Join(dir, versionsDir, "macd", f.Version()+ext)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(b), "return df", "return df * 2", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetVersion("MACD", f.Version()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("GetVersion() of an edited version error = %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	r := New(t.TempDir())
+	if fs, err := r.List(); err != nil || len(fs) != 0 {
+		t.Errorf("List() of an empty registry = %v, %v", fs, err)
+	}
+	for _, name := range []string{"RSI", "MACD", "ATR"} {
+		if err := r.Put(testFactor(name, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range fs {
+		names = append(names, f.FactorName)
+	}
+	if got := strings.Join(names, ","); got != "ATR,MACD,RSI" {
+		t.Errorf("List() = %s", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Package retry tells failures of runs worth another attempt from failures that would only
+// fail again, and spaces out the attempts.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+// Class is how a failure of a run is classified.
+type Class string
+
+const (
+	// Retryable failures may not happen again, such as a Docker daemon restarting or
+	// main.py losing its MongoDB connection.
+	Retryable Class = "retryable"
+	// Permanent failures happen again on every attempt, such as a syntax error in the
+	// factor code or an invalid parameter.
+	Permanent Class = "permanent"
+)
+
+// Attempt is one execution of a run.
+type Attempt struct {
+	// Number counts attempts from 1.
+	Number     int       `json:"number"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ExitCode   int64     `json:"exit_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Class is the class of Error; empty for the attempt that succeeded.
+	Class Class `json:"class,omitempty"`
+}
+
+// Classify classifies the error of a failed attempt. Failures it does not recognize are
+// permanent, so that retries never hide a bug.
+func Classify(err error) Class {
+	var exitErr *containerize.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		// a container running out of memory runs out again with the same limit
+		if exitErr.Code == factor.ExitTransient && !exitErr.OOMKilled {
+			return Retryable
+		}
+		return Permanent
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// cancelled runs are not to run again, and runs timing out would time out again
+		return Permanent
+	case client.IsErrConnectionFailed(err), errdefs.IsUnavailable(err):
+		return Retryable
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err):
+		// the Kubernetes API server is overloaded or restarting; conflicts such as objects
+		// that already exist are not retried, as they would conflict again
+		return Retryable
+	case errdefs.IsConflict(err):
+		// the container of an earlier attempt is still being removed
+		return Retryable
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		// the daemon went away while following the container
+		return Retryable
+	}
+	return Permanent
+}
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Backoff is the wait after the failed attempt number attempt: the initial backoff of
+// policy doubled for every earlier attempt, capped at the maximum backoff. Half of the wait
+// is random, so that runs failing together do not retry together.
+func Backoff(policy config.Retry, attempt int) time.Duration {
+	d := time.Duration(policy.InitialBackoff)
+	max := time.Duration(policy.MaxBackoff)
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return half + time.Duration(jitter.Int63n(int64(d-half)+1))
+}
+
+// Sleep waits for d or until ctx is done, returning the error of ctx then.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
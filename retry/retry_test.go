@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/containerize"
+	"github.com/nathanusask/docker-go-demo/factor"
+)
+
+func TestClassify(t *testing.T) {
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"transient exit", &containerize.ExitError{Code: factor.ExitTransient}, Retryable},
+		{"wrapped transient exit", fmt.Errorf("node: %w", &containerize.ExitError{Code: factor.ExitTransient}), Retryable},
+		{"transient exit killed for memory", &containerize.ExitError{Code: factor.ExitTransient, OOMKilled: true}, Permanent},
+		{"exit", &containerize.ExitError{Code: 1}, Permanent},
+		{"cancelled", context.Canceled, Permanent},
+		{"timed out", fmt.Errorf("wait: %w", context.DeadlineExceeded), Permanent},
+		{"daemon unavailable", errdefs.Unavailable(errors.New("restarting")), Retryable},
+		{"container being removed", errdefs.Conflict(errors.New("removal in progress")), Retryable},
+		{"connection reset", fmt.Errorf("follow: %w", syscall.ECONNRESET), Retryable},
+		{"connection refused", syscall.ECONNREFUSED, Retryable},
+		{"log cut short", io.ErrUnexpectedEOF, Retryable},
+		{"api server throttling", apierrors.NewTooManyRequests("slow down", 1), Retryable},
+		{"api server unavailable", apierrors.NewServiceUnavailable("restarting"), Retryable},
+		{"api server timeout", apierrors.NewServerTimeout(jobs, "create", 1), Retryable},
+		{"api server error", apierrors.NewInternalError(errors.New("etcd")), Retryable},
+		{"job exists", apierrors.NewAlreadyExists(jobs, "macd"), Permanent},
+		{"job conflict", apierrors.NewConflict(jobs, "macd", errors.New("modified")), Permanent},
+		{"forbidden", apierrors.NewForbidden(jobs, "macd", errors.New("rbac")), Permanent},
+		{"unknown", errors.New("syntax error"), Permanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := config.Retry{InitialBackoff: config.Duration(time.Second), MaxBackoff: config.Duration(5 * time.Second)}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			// half of the wait is random
+			if got := Backoff(policy, tt.attempt); got < tt.want/2 || got > tt.want {
+				t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tt.attempt, got, tt.want/2, tt.want)
+			}
+		}
+	}
+	if got := Backoff(config.Retry{}, 3); got != 0 {
+		t.Errorf("Backoff() without a backoff = %v, want 0", got)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if err := Sleep(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("Sleep() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep() of a cancelled context error = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package runlog
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many lines a subscriber may fall behind before it is dropped.
+const subscriberBuffer = 1024
+
+// Broker fans the lines written to the logs of runs out to subscribers, reading each log
+// once however many subscribe to it.
+type Broker struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+// topic is a log followed for its subscribers; lines before offset are delivered.
+type topic struct {
+	dir    string
+	offset int64
+	subs   map[*Subscription]struct{}
+	stop   chan struct{}
+}
+
+// Subscription receives the lines of a log.
+type Subscription struct {
+	// Lines receives lines in order, and is closed when the subscriber fell behind too far
+	// to catch up or the subscription is cancelled.
+	Lines <-chan Line
+
+	lines  chan Line
+	broker *Broker
+	topic  *topic
+	once   sync.Once
+}
+
+// NewBroker returns a broker reading new lines every interval.
+func NewBroker(interval time.Duration) *Broker {
+	return &Broker{interval: interval, topics: map[string]*topic{}}
+}
+
+// Subscribe returns the lines of the log of dir selected by q, and a subscription to the
+// lines written after them.
+func (b *Broker) Subscribe(dir string, q Query) ([]Line, *Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[dir]
+	if !ok {
+		_, offset, err := readFrom(dir, 0, -1)
+		if err != nil {
+			return nil, nil, err
+		}
+		t = &topic{dir: dir, offset: offset, subs: map[*Subscription]struct{}{}, stop: make(chan struct{})}
+		b.topics[dir] = t
+		go b.tail(t)
+	}
+	// the backlog ends where the topic takes over
+	lines, _, err := readFrom(dir, 0, t.offset)
+	if err != nil {
+		if !ok {
+			b.close(t)
+		}
+		return nil, nil, err
+	}
+	ch := make(chan Line, subscriberBuffer)
+	sub := &Subscription{Lines: ch, lines: ch, broker: b, topic: t}
+	t.subs[sub] = struct{}{}
+	return q.apply(lines), sub, nil
+}
+
+// Sync delivers the lines written to the log so far, for a subscriber to drain before
+// it ends with the run.
+func (s *Subscription) Sync() error {
+	return s.broker.poll(s.topic)
+}
+
+// Cancel ends the subscription, and the following of its log once it had the last.
+func (s *Subscription) Cancel() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.cancel()
+	if len(s.topic.subs) == 0 && s.broker.topics[s.topic.dir] == s.topic {
+		s.broker.close(s.topic)
+	}
+}
+
+func (s *Subscription) cancel() {
+	s.once.Do(func() {
+		delete(s.topic.subs, s)
+		close(s.lines)
+	})
+}
+
+// close stops following t; b.mu is held.
+func (b *Broker) close(t *topic) {
+	delete(b.topics, t.dir)
+	close(t.stop)
+}
+
+func (b *Broker) tail(t *topic) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			// a failed read is retried on the next tick; subscribers see no lines meanwhile
+			_ = b.poll(t)
+		}
+	}
+}
+
+// poll delivers the lines written to the log of t since the last poll.
+func (b *Broker) poll(t *topic) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines, offset, err := readFrom(t.dir, t.offset, -1)
+	t.offset = offset
+	for _, line := range lines {
+		for sub := range t.subs {
+			select {
+			case sub.lines <- line:
+			default:
+				// a slow subscriber must not hold up the others
+				sub.cancel()
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package runlog
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// receive returns the n next lines of sub.
+func receive(t *testing.T, sub *Subscription, n int) []Line {
+	t.Helper()
+	var lines []Line
+	for len(lines) < n {
+		select {
+		case line, ok := <-sub.Lines:
+			if !ok {
+				t.Fatalf("subscription closed after %d lines", len(lines))
+			}
+			lines = append(lines, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d lines, want %d", len(lines), n)
+		}
+	}
+	return lines
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "before")
+	// polling is left to Sync
+	b := NewBroker(time.Hour)
+
+	backlog, sub, err := b.Subscribe(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+	if got := texts(backlog); !equalStrings(got, []string{"stdout: before"}) {
+		t.Errorf("backlog = %q", got)
+	}
+
+	writeLines(t, dir, StreamStderr, "after")
+	if err := sub.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{StreamAttempt + ": --- attempt 2 ---", "stderr: after"}
+	if got := texts(receive(t, sub, 2)); !equalStrings(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+
+	// a later subscriber shares the topic, and its backlog ends where the topic is
+	backlog, other, err := b.Subscribe(dir, Query{Tail: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Cancel()
+	if got := texts(backlog); !equalStrings(got, []string{"stderr: after"}) {
+		t.Errorf("backlog of the second subscriber = %q", got)
+	}
+	if len(b.topics) != 1 {
+		t.Errorf("%d topics, want 1", len(b.topics))
+	}
+}
+
+func TestBrokerTail(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "before")
+	b := NewBroker(time.Millisecond)
+	_, sub, err := b.Subscribe(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+	writeLines(t, dir, StreamStdout, "after")
+	if got := receive(t, sub, 2)[1].Text; got != "after" {
+		t.Errorf("line = %q, want after", got)
+	}
+}
+
+func TestBrokerCancel(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "line")
+	b := NewBroker(time.Hour)
+	_, first, err := b.Subscribe(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := b.Subscribe(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Cancel()
+	if _, ok := <-first.Lines; ok {
+		t.Error("lines of a cancelled subscription are open")
+	}
+	if len(b.topics) != 1 {
+		t.Error("log not followed for the remaining subscriber")
+	}
+	second.Cancel()
+	// cancelling twice is harmless
+	second.Cancel()
+	if len(b.topics) != 0 {
+		t.Error("log still followed without subscribers")
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "start")
+	b := NewBroker(time.Hour)
+	_, sub, err := b.Subscribe(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+
+	text := make([]string, subscriberBuffer+1)
+	for i := range text {
+		text[i] = strconv.Itoa(i)
+	}
+	writeLines(t, dir, StreamStdout, text...)
+	if err := sub.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range sub.Lines {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("received %d lines before being dropped, want %d", n, subscriberBuffer)
+	}
+}
+
+func TestBrokerSubscribeMissingLog(t *testing.T) {
+	b := NewBroker(time.Hour)
+	// the log of a run that wrote nothing yet
+	backlog, sub, err := b.Subscribe(t.TempDir(), Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+	if len(backlog) != 0 {
+		t.Errorf("backlog = %v", backlog)
+	}
+}
@@ -0,0 +1,257 @@
+// Package runlog keeps the output of factor runs as timestamped lines in the run's workspace
+// directory, where it outlives the container, and fans new lines out to subscribers.
+package runlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Filename is the file in a run's workspace directory holding its log, one Line per line.
+const Filename = "logs.jsonl"
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamAttempt holds the lines marking where the log of a retried attempt of a run
+	// starts, after the log of the attempts before it.
+	StreamAttempt = "attempt"
+)
+
+// Line is a line of output of a run, without its line break.
+type Line struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Text   string    `json:"text"`
+}
+
+// Query selects lines of a log; zero fields select every line.
+type Query struct {
+	// Since selects lines written at or after it.
+	Since time.Time
+	// Tail selects the last Tail lines of those.
+	Tail int
+}
+
+func (q Query) apply(lines []Line) []Line {
+	if !q.Since.IsZero() {
+		i := 0
+		for i < len(lines) && lines[i].Time.Before(q.Since) {
+			i++
+		}
+		lines = lines[i:]
+	}
+	if q.Tail > 0 && len(lines) > q.Tail {
+		lines = lines[len(lines)-q.Tail:]
+	}
+	return lines
+}
+
+// Writer writes the log of a run, one io.Writer per stream.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewWriter starts the log of an attempt of the run working in dir. The logs of earlier
+// attempts are kept, the new one following a line of StreamAttempt.
+func NewWriter(dir string) (*Writer, error) {
+	lines, offset, err := readFrom(dir, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	w, err := openAt(dir, offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return w, nil
+	}
+	attempt := 2
+	for _, line := range lines {
+		if line.Stream == StreamAttempt {
+			attempt++
+		}
+	}
+	if err := w.write(Line{Time: time.Now(), Stream: StreamAttempt, Text: fmt.Sprintf("--- attempt %d ---", attempt)}); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// OpenWriter continues the log of the run working in dir, which another process started,
+// and returns the time of its last line, zero without one.
+func OpenWriter(dir string) (*Writer, time.Time, error) {
+	var last time.Time
+	lines, offset, err := readFrom(dir, 0, -1)
+	if err != nil {
+		return nil, last, err
+	}
+	if len(lines) > 0 {
+		last = lines[len(lines)-1].Time
+	}
+	w, err := openAt(dir, offset)
+	return w, last, err
+}
+
+// openAt opens the log of dir for writing after its first offset bytes, dropping a line
+// that a process did not finish writing.
+func openAt(dir string, offset int64) (*Writer, error) {
+	f, err := os.OpenFile(filepath.Join(dir, Filename), os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Writer{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Stream returns the writer of the named stream. It writes complete lines, timestamped
+// when they are complete; closing it writes what is left of the last line.
+func (w *Writer) Stream(name string) io.WriteCloser {
+	return &streamWriter{w: w, stream: name}
+}
+
+func (w *Writer) write(line Line) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(line)
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+type streamWriter struct {
+	w      *Writer
+	stream string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, b...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := s.line(s.buf[:i]); err != nil {
+			return len(b), err
+		}
+		s.buf = s.buf[i+1:]
+	}
+}
+
+func (s *streamWriter) line(text []byte) error {
+	return s.w.write(Line{Time: time.Now(), Stream: s.stream, Text: string(bytes.TrimSuffix(text, []byte("\r")))})
+}
+
+func (s *streamWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.line(s.buf)
+	s.buf = nil
+	return err
+}
+
+// Read returns the lines of the log of dir selected by q.
+func Read(dir string, q Query) ([]Line, error) {
+	lines, _, err := readFrom(dir, 0, -1)
+	return q.apply(lines), err
+}
+
+// readFrom reads the complete lines of the log of dir from offset up to limit, or to the
+// end with a negative limit, and returns the offset following the last of them.
+func readFrom(dir string, offset, limit int64) ([]Line, int64, error) {
+	f, err := os.Open(filepath.Join(dir, Filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, offset, nil
+	}
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var lines []Line
+	r := bufio.NewReader(f)
+	for limit < 0 || offset < limit {
+		b, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial line is read again once complete
+			break
+		}
+		if err != nil {
+			return lines, offset, err
+		}
+		offset += int64(len(b))
+		var line Line
+		if err := json.Unmarshal(b, &line); err != nil {
+			return lines, offset, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, offset, nil
+}
+
+// Follow calls fn with the lines of the log of dir selected by q, and then with every
+// line written until running reports false, polling every interval.
+func Follow(ctx context.Context, dir string, q Query, interval time.Duration, running func() bool, fn func(Line) error) error {
+	lines, offset, err := readFrom(dir, 0, -1)
+	if err != nil {
+		return err
+	}
+	for _, line := range q.apply(lines) {
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	for {
+		// checked before reading, so that the last read follows the end of the run
+		done := !running()
+		if lines, offset, err = readFrom(dir, offset, -1); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
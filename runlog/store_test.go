@@ -0,0 +1,167 @@
+package runlog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLines writes text as lines of stream to a new attempt of the log of dir.
+func writeLines(t *testing.T, dir, stream string, text ...string) {
+	t.Helper()
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := w.Stream(stream)
+	for _, line := range text {
+		if _, err := io.WriteString(s, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func texts(lines []Line) []string {
+	var ret []string
+	for _, line := range lines {
+		ret = append(ret, line.Stream+": "+line.Text)
+	}
+	return ret
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewWriterKeepsEarlierAttempts(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "first")
+	writeLines(t, dir, StreamStderr, "second")
+	writeLines(t, dir, StreamStdout, "third")
+
+	lines, err := Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"stdout: first",
+		"attempt: --- attempt 2 ---",
+		"stderr: second",
+		"attempt: --- attempt 3 ---",
+		"stdout: third",
+	}
+	if got := texts(lines); !equalStrings(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := w.Stream(StreamStdout)
+	for _, chunk := range []string{"a", "b\r\nc\n", "\n", "unterminated"} {
+		if _, err := io.WriteString(s, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stdout: ab", "stdout: c", "stdout: ", "stdout: unterminated"}
+	if got := texts(lines); !equalStrings(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestOpenWriterDropsPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, dir, StreamStdout, "complete")
+	f, err := os.OpenFile(filepath.Join(dir, Filename), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2022-07-01T00:00:00Z","stream":"stdout","te`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	w, last, err := OpenWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.IsZero() {
+		t.Error("last = zero, want the time of the complete line")
+	}
+	s := w.Stream(StreamStdout)
+	if _, err := io.WriteString(s, "continued\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	lines, err := Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stdout: complete", "stdout: continued"}
+	if got := texts(lines); !equalStrings(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	base := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	var lines []Line
+	for i := 0; i < 5; i++ {
+		lines = append(lines, Line{Time: base.Add(time.Duration(i) * time.Second), Stream: StreamStdout, Text: string(rune('a' + i))})
+	}
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all", Query{}, []string{"a", "b", "c", "d", "e"}},
+		{"since", Query{Since: base.Add(3 * time.Second)}, []string{"d", "e"}},
+		{"since after the end", Query{Since: base.Add(time.Minute)}, []string{}},
+		{"tail", Query{Tail: 2}, []string{"d", "e"}},
+		{"tail longer than the log", Query{Tail: 10}, []string{"a", "b", "c", "d", "e"}},
+		{"since and tail", Query{Since: base.Add(time.Second), Tail: 3}, []string{"c", "d", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, line := range tt.query.apply(lines) {
+				got = append(got, line.Text)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
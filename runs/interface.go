@@ -0,0 +1,12 @@
+package runs
+
+// Interface stores run records.
+type Interface interface {
+	Create(run Run) error
+	Update(run Run) error
+	Get(id string) (Run, error)
+	// List returns all runs, most recent first.
+	List() ([]Run, error)
+	// Query returns the runs matching filter, most recent first.
+	Query(filter Filter) ([]Run, error)
+}
@@ -0,0 +1,123 @@
+package runs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get for unknown runs.
+var ErrNotFound = errors.New("run not found")
+
+const ext = ".json"
+
+// fileStore keeps one JSON file per run in dir.
+type fileStore struct {
+	dir string
+}
+
+func (s fileStore) Create(run Run) error {
+	if _, err := os.Stat(s.path(run.ID)); err == nil {
+		return fmt.Errorf("run %s already exists", run.ID)
+	}
+	return s.write(run)
+}
+
+func (s fileStore) Update(run Run) error {
+	if _, err := s.Get(run.ID); err != nil {
+		return err
+	}
+	return s.write(run)
+}
+
+func (s fileStore) Get(id string) (Run, error) {
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Run{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Run{}, err
+	}
+	var run Run
+	if err := json.Unmarshal(b, &run); err != nil {
+		return Run{}, fmt.Errorf("run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+func (s fileStore) List() ([]Run, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []Run
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		run, err := s.Get(strings.TrimSuffix(e.Name(), ext))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, run)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].CreatedAt.After(ret[j].CreatedAt) })
+	return ret, nil
+}
+
+func (s fileStore) Query(filter Filter) ([]Run, error) {
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var ret []Run
+	for _, run := range all {
+		if filter.Match(run) {
+			ret = append(ret, run)
+		}
+	}
+	return ret, nil
+}
+
+// write replaces the run file atomically so readers never see a partial record.
+func (s fileStore) write(run Run) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(run.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(run.ID))
+}
+
+func (s fileStore) path(id string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// NewID returns a new run ID, sortable by creation time.
+func NewID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+func New(dir string) Interface {
+	return &fileStore{dir}
+}
@@ -0,0 +1,87 @@
+package runs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	store := New(dir)
+	if runs, err := store.List(); err != nil || len(runs) != 0 {
+		t.Errorf("List() of a new store = %v, %v", runs, err)
+	}
+
+	created := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	run := Run{ID: "r1", Factor: "MACD", Status: StatusRunning, CreatedAt: created}
+	if err := store.Create(run); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(run); err == nil {
+		t.Error("Create() of an existing run succeeded")
+	}
+	run.Status = StatusSucceeded
+	run.RowsOut = 5
+	if err := store.Update(run); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusSucceeded || got.RowsOut != 5 || !got.CreatedAt.Equal(created) || !got.Finished() {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	if err := store.Update(Run{ID: "r2"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of an unknown run error = %v", err)
+	}
+	if _, err := store.Get("r2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an unknown run error = %v", err)
+	}
+	// nothing is left of the atomic writes
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("store holds %d files, want 1", len(entries))
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	store := New(dir)
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"b", "c", "a"} {
+		if err := store.Create(Run{ID: id, CreatedAt: start.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files of other tools are ignored
+	if err := os.WriteFile(filepath.Join(dir, "README"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids string
+	for _, run := range runs {
+		ids += run.ID
+	}
+	if ids != "acb" {
+		t.Errorf("List() = %s, want the most recent first", ids)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if !regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]{8}$`).MatchString(a) || a == b {
+		t.Errorf("NewID() = %s, %s", a, b)
+	}
+}
@@ -0,0 +1,92 @@
+package runs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/factor"
+	"github.com/nathanusask/docker-go-demo/retry"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Run is a single execution of a factor, with enough provenance to trace and reproduce its output.
+type Run struct {
+	ID            string            `json:"id"`
+	Factor        string            `json:"factor"`
+	FactorVersion string            `json:"factor_version,omitempty"`
+	CodeHash      string            `json:"code_hash,omitempty"`
+	Params        map[string]string `json:"params,omitempty"`
+	Collection    string            `json:"collection"`
+	// Inputs are the collections read by named inputs.
+	Inputs map[string]string `json:"inputs,omitempty"`
+	Start  int64             `json:"start,omitempty"`
+	End    int64             `json:"end,omitempty"`
+	Image  string            `json:"image"`
+	// ImageDigest is the immutable reference of Image the run used.
+	ImageDigest string        `json:"image_digest,omitempty"`
+	Source      factor.Source `json:"source,omitempty"`
+	Sink        factor.Sink   `json:"sink,omitempty"`
+	Container   string        `json:"container"`
+	Output      string        `json:"output"`
+	// RerunOf is the run this run reproduces.
+	RerunOf  string `json:"rerun_of,omitempty"`
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int64  `json:"exit_code"`
+	RowsIn   int64  `json:"rows_in"`
+	RowsOut  int64  `json:"rows_out"`
+	// PeakMemoryBytes and CPUSeconds are what the container used, zero when not sampled.
+	PeakMemoryBytes uint64  `json:"peak_memory_bytes,omitempty"`
+	CPUSeconds      float64 `json:"cpu_seconds,omitempty"`
+	// Retry is the retry policy of the run and Attempts its executions, the last one
+	// deciding the outcome.
+	Retry    *config.Retry   `json:"retry,omitempty"`
+	Attempts []retry.Attempt `json:"attempts,omitempty"`
+	// Host and OrchestratorVersion identify the orchestrator that executed the run, and
+	// Instance and BootID the process of it attending to the run, see containerize.BootID.
+	Host                string    `json:"host,omitempty"`
+	OrchestratorVersion string    `json:"orchestrator_version,omitempty"`
+	Instance            string    `json:"instance,omitempty"`
+	BootID              string    `json:"boot_id,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	StartedAt           time.Time `json:"started_at,omitempty"`
+	FinishedAt          time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the run is in a final state.
+func (r Run) Finished() bool {
+	return r.Status != StatusRunning
+}
+
+// Filter selects runs; zero fields match every run.
+type Filter struct {
+	// Factor matches factor names case-insensitively.
+	Factor string
+	Status Status
+	// Since and Until bound CreatedAt to [Since, Until).
+	Since time.Time
+	Until time.Time
+}
+
+func (f Filter) Match(r Run) bool {
+	switch {
+	case f.Factor != "" && !strings.EqualFold(f.Factor, r.Factor):
+		return false
+	case f.Status != "" && f.Status != r.Status:
+		return false
+	case !f.Since.IsZero() && r.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.CreatedAt.Before(f.Until):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package runs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	noon := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	run := Run{ID: "r1", Factor: "MACD", Status: StatusFailed, CreatedAt: noon}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"everything", Filter{}, true},
+		{"factor ignoring case", Filter{Factor: "macd"}, true},
+		{"other factor", Filter{Factor: "rsi"}, false},
+		{"status", Filter{Status: StatusFailed}, true},
+		{"other status", Filter{Status: StatusSucceeded}, false},
+		{"since", Filter{Since: noon}, true},
+		{"since later", Filter{Since: noon.Add(time.Second)}, false},
+		{"until later", Filter{Until: noon.Add(time.Second)}, true},
+		{"until", Filter{Until: noon}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(run); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	store := New(t.TempDir())
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	for i, run := range []Run{
+		{ID: "a", Factor: "MACD", Status: StatusSucceeded},
+		{ID: "b", Factor: "RSI", Status: StatusSucceeded},
+		{ID: "c", Factor: "MACD", Status: StatusFailed},
+		{ID: "d", Factor: "MACD", Status: StatusSucceeded},
+	} {
+		run.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		if err := store.Create(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := store.Query(Filter{Factor: "MACD", Status: StatusSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != "d" || runs[1].ID != "a" {
+		t.Errorf("Query() = %+v", runs)
+	}
+}
@@ -0,0 +1,8 @@
+package secrets
+
+import "context"
+
+// Provider resolves secrets by name, e.g. "mongo_username".
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
@@ -0,0 +1,33 @@
+package secrets
+
+import "context"
+
+// Where the generated main.py looks for MongoDB credentials.
+const (
+	MongoMountPath   = "/run/secrets/mongo.json"
+	MongoEnvUsername = "MONGO_USERNAME"
+	MongoEnvPassword = "MONGO_PASSWORD"
+)
+
+type MongoCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c MongoCredentials) Empty() bool {
+	return c.Username == ""
+}
+
+// Mongo resolves the "mongo_username" and "mongo_password" secrets. Both missing means
+// an unauthenticated connection.
+func Mongo(ctx context.Context, p Provider) (MongoCredentials, error) {
+	username, err := Optional(ctx, p, "mongo_username")
+	if err != nil {
+		return MongoCredentials{}, err
+	}
+	password, err := Optional(ctx, p, "mongo_password")
+	if err != nil {
+		return MongoCredentials{}, err
+	}
+	return MongoCredentials{username, password}, nil
+}
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanusask/docker-go-demo/config"
+)
+
+// ErrNotFound is returned by providers for unknown secrets.
+var ErrNotFound = errors.New("secret not found")
+
+const envPrefix = "FACTOR_SECRET_"
+
+// envProvider reads secret "name" from FACTOR_SECRET_NAME.
+type envProvider struct{}
+
+func (envProvider) Get(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(envPrefix + strings.ToUpper(name))
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return v, nil
+}
+
+// fileProvider reads secret "name" from the file of the same name in dir, the layout
+// of Docker and Kubernetes secret mounts.
+type fileProvider struct {
+	dir string
+}
+
+func (p fileProvider) Get(_ context.Context, name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// vaultProvider is a local stand-in for a vault: a JSON object of secrets in a file
+// only its owner may read.
+type vaultProvider struct {
+	path string
+}
+
+func (p vaultProvider) Get(_ context.Context, name string) (string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("vault %s is accessible by other users (mode %v)", p.path, info.Mode().Perm())
+	}
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", err
+	}
+	var vault map[string]string
+	if err := json.Unmarshal(b, &vault); err != nil {
+		return "", fmt.Errorf("vault %s: %w", p.path, err)
+	}
+	v, ok := vault[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return v, nil
+}
+
+// Optional returns the secret or "" when the provider does not have it.
+func Optional(ctx context.Context, p Provider, name string) (string, error) {
+	v, err := p.Get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return v, err
+}
+
+func New(cfg config.Secrets) (Provider, error) {
+	switch cfg.Provider {
+	case config.SecretsEnv:
+		return envProvider{}, nil
+	case config.SecretsFile:
+		return fileProvider{cfg.Path}, nil
+	case config.SecretsVault:
+		return vaultProvider{cfg.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q", cfg.Provider)
+	}
+}
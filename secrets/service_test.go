@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nathanusask/docker-go-demo/config"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("FACTOR_SECRET_MONGO_USERNAME", "reader")
+	p, err := New(config.Secrets{Provider: config.SecretsEnv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.Get(context.Background(), "mongo_username"); err != nil || v != "reader" {
+		t.Errorf("Get() = %q, %v", v, err)
+	}
+	if _, err := p.Get(context.Background(), "mongo_password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing secret error = %v", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mongo_password"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(config.Secrets{Provider: config.SecretsFile, Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the trailing newline of secret files is not part of the secret
+	if v, err := p.Get(context.Background(), "mongo_password"); err != nil || v != "s3cret" {
+		t.Errorf("Get() = %q, %v", v, err)
+	}
+	if _, err := p.Get(context.Background(), "mongo_username"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing secret error = %v", err)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	if err := os.WriteFile(path, []byte(`{"mongo_username": "reader"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(config.Secrets{Provider: config.SecretsVault, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if v, err := p.Get(ctx, "mongo_username"); err != nil || v != "reader" {
+		t.Errorf("Get() = %q, %v", v, err)
+	}
+	if _, err := p.Get(ctx, "mongo_password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing secret error = %v", err)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(ctx, "mongo_username"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() from a vault others may read error = %v", err)
+	}
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := New(config.Secrets{Provider: "keychain"}); err == nil {
+		t.Error("New() of an unknown provider succeeded")
+	}
+}
+
+// secretsMap resolves the secrets it holds.
+type secretsMap map[string]string
+
+func (s secretsMap) Get(_ context.Context, name string) (string, error) {
+	v, ok := s[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func TestMongo(t *testing.T) {
+	ctx := context.Background()
+	creds, err := Mongo(ctx, secretsMap{"mongo_username": "reader", "mongo_password": "s3cret"})
+	if err != nil || creds != (MongoCredentials{"reader", "s3cret"}) {
+		t.Errorf("Mongo() = %+v, %v", creds, err)
+	}
+	creds, err = Mongo(ctx, secretsMap{})
+	if err != nil || !creds.Empty() {
+		t.Errorf("Mongo() without secrets = %+v, %v", creds, err)
+	}
+}
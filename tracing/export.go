@@ -0,0 +1,323 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nathanusask/docker-go-demo/config"
+	"github.com/nathanusask/docker-go-demo/logging"
+)
+
+const (
+	queueSize     = 2048
+	maxBatch      = 512
+	batchInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+type exporter interface {
+	export(ctx context.Context, spans []SpanData) error
+}
+
+// batcher exports queued spans in the background, in batches of up to maxBatch spans
+// or every batchInterval.
+type batcher struct {
+	exp   exporter
+	log   *logging.Logger
+	spans chan SpanData
+	done  chan struct{}
+}
+
+var (
+	mu      sync.RWMutex
+	current *batcher
+)
+
+// Setup starts exporting spans as configured; spans are not recorded at all with the none
+// exporter. The returned function exports the queued spans and stops, and must be called
+// before exiting.
+func Setup(cfg config.Tracing, logger *logging.Logger) (func(context.Context) error, error) {
+	var exp exporter
+	switch cfg.Exporter {
+	case config.TracingNone, "":
+		return func(context.Context) error { return nil }, nil
+	case config.TracingStdout:
+		exp = &writerExporter{w: os.Stdout}
+	case config.TracingOTLP:
+		exp = &otlpExporter{
+			url:     strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+			service: cfg.ServiceName,
+			client:  &http.Client{Timeout: exportTimeout},
+		}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	b := &batcher{exp: exp, log: logger, spans: make(chan SpanData, queueSize), done: make(chan struct{})}
+	go b.run()
+	mu.Lock()
+	current = b
+	mu.Unlock()
+	return shutdown, nil
+}
+
+func shutdown(ctx context.Context) error {
+	mu.Lock()
+	b := current
+	current = nil
+	if b != nil {
+		close(b.spans)
+	}
+	mu.Unlock()
+	if b == nil {
+		return nil
+	}
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current != nil
+}
+
+// enqueue drops the span rather than blocking a run when the queue is full.
+func enqueue(data SpanData) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return
+	}
+	select {
+	case current.spans <- data:
+	default:
+		current.log.Warn("dropped span, export queue is full", "span", data.Name)
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := b.exp.export(ctx, batch); err != nil {
+			b.log.Error("failed to export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case data, ok := <-b.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Import exports the spans main.py wrote to path, if it wrote any. Spans with invalid
+// IDs are skipped.
+func Import(path string) error {
+	if !enabled() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var data SpanData
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !validID(data.TraceID, 16) || !validID(data.SpanID, 8) {
+			continue
+		}
+		enqueue(data)
+	}
+	return scanner.Err()
+}
+
+// writerExporter writes spans as JSON lines.
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (e *writerExporter) export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, span := range spans {
+		if err := enc.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otlpExporter posts spans to an OTLP/HTTP collector in the JSON encoding of
+// ExportTraceServiceRequest.
+type otlpExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+func (e *otlpExporter) export(ctx context.Context, spans []SpanData) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.StartUnixNano, 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndUnixNano, 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.Error != "" {
+			s.Status = &otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		converted = append(converted, s)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": e.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": e.service},
+				"spans": converted,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector %s returned %s: %s", e.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	ret := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		ret = append(ret, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+	return ret
+}
+
+// otlpValue maps attribute values to OTLP types. Whole float64s, as decoded from the JSON
+// spans of main.py, become integers.
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		return otlpAnyValue{IntValue: strconv.Itoa(v)}
+	case int64:
+		return otlpAnyValue{IntValue: strconv.FormatInt(v, 10)}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return otlpAnyValue{IntValue: strconv.FormatInt(int64(v), 10)}
+		}
+		return otlpAnyValue{DoubleValue: &v}
+	case time.Duration:
+		s := v.String()
+		return otlpAnyValue{StringValue: &s}
+	}
+	s := fmt.Sprint(v)
+	return otlpAnyValue{StringValue: &s}
+}
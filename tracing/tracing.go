@@ -0,0 +1,131 @@
+// Package tracing records spans of image builds and runs and exports them to an OTLP
+// collector or stdout. Generated main.py files continue the trace of their run from the
+// TRACEPARENT environment variable and leave their spans in SpansFilename for Import.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvTraceparent holds the W3C traceparent of the span a factor container runs in.
+	EnvTraceparent = "TRACEPARENT"
+	// SpansFilename is the file in the run's working directory main.py appends its spans to,
+	// one SpanData per line.
+	SpansFilename = "spans.jsonl"
+)
+
+// SpanData is a finished span, as exported and as written by main.py.
+type SpanData struct {
+	Name          string                 `json:"name"`
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	StartUnixNano int64                  `json:"start_unix_nano"`
+	EndUnixNano   int64                  `json:"end_unix_nano"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	// Error is the error the span ended with, empty when it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Span is a span in progress. A nil *Span, returned while tracing is disabled, does nothing.
+type Span struct {
+	mu   sync.Mutex
+	data SpanData
+}
+
+type spanKey struct{}
+
+// Start starts a span named name, a child of the span of ctx if there is one, and returns
+// a context carrying it. kv are attribute keys and values, alternating.
+func Start(ctx context.Context, name string, kv ...interface{}) (context.Context, *Span) {
+	if !enabled() {
+		return ctx, nil
+	}
+	data := SpanData{
+		Name:          name,
+		SpanID:        newID(8),
+		StartUnixNano: time.Now().UnixNano(),
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		data.TraceID = parent.data.TraceID
+		data.ParentSpanID = parent.data.SpanID
+	} else {
+		data.TraceID = newID(16)
+	}
+	span := &Span{data: data}
+	span.SetAttributes(kv...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttributes adds kv, alternating keys and values, to the span.
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{}, len(kv)/2)
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		s.data.Attributes[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+}
+
+// End ends the span, failed when err is non-nil, and queues it for export.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	data := s.data
+	s.mu.Unlock()
+	data.EndUnixNano = time.Now().UnixNano()
+	if err != nil {
+		data.Error = err.Error()
+	}
+	enqueue(data)
+}
+
+// Traceparent formats the span as a W3C traceparent header, sampled.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.data.TraceID + "-" + s.data.SpanID + "-01"
+}
+
+// Env returns the environment variables continuing the trace of ctx in a factor
+// container, none when ctx carries no span.
+func Env(ctx context.Context) []string {
+	span, ok := ctx.Value(spanKey{}).(*Span)
+	if !ok {
+		return nil
+	}
+	return []string{EnvTraceparent + "=" + span.Traceparent()}
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; a time-based ID keeps spans apart
+		copy(b, fmt.Sprintf("%0*x", n, time.Now().UnixNano()))
+	}
+	return hex.EncodeToString(b)
+}
+
+// validID reports whether id is n bytes of lowercase hex, not all zero, as in traceparent.
+func validID(id string, n int) bool {
+	if len(id) != 2*n || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
@@ -0,0 +1,30 @@
+// Package version identifies the orchestrator build recorded with every run.
+package version
+
+import "runtime/debug"
+
+// Version can be set at build time with -ldflags "-X github.com/nathanusask/docker-go-demo/version.Version=v1.2.3".
+var Version = ""
+
+// String returns Version, or the module version and VCS revision stamped by the Go toolchain.
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v += "+" + s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				v += "-dirty"
+			}
+		}
+	}
+	return v
+}